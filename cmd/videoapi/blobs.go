@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/warpcomdev/videoapi/internal/blob"
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// blobStores builds the stores for media files and for the trash,
+// according to MEDIA_STORE: "local" (default) or "s3".
+func blobStores() (media crud.BlobStore, trash crud.BlobStore) {
+	switch strings.ToLower(os.Getenv("MEDIA_STORE")) {
+	case "", "local":
+		return localStores()
+	case "s3":
+		return s3Stores()
+	default:
+		panic("MEDIA_STORE must be local or s3")
+	}
+}
+
+// localStores keeps the media in FINALDIR and the trash in TRASHDIR
+func localStores() (crud.BlobStore, crud.BlobStore) {
+	finalFolder := os.Getenv("FINALDIR")
+	if finalFolder == "" {
+		panic("FINALDIR must be set")
+	}
+	// Deleted media is kept out of FINALDIR, so it is not served
+	trashFolder := os.Getenv("TRASHDIR")
+	if trashFolder == "" {
+		trashFolder = filepath.Join(filepath.Dir(filepath.Clean(finalFolder)), "trash")
+	}
+	media, err := blob.NewLocal(finalFolder)
+	dieOnError("Failed to create FINALDIR:", err)
+	trash, err := blob.NewLocal(trashFolder)
+	dieOnError("Failed to create TRASHDIR:", err)
+	return media, trash
+}
+
+// s3Stores keeps the media and the trash in the same bucket,
+// with different prefixes so that the trash is not served.
+func s3Stores() (crud.BlobStore, crud.BlobStore) {
+	config := blob.S3Config{
+		Endpoint:  os.Getenv("S3_ENDPOINT"),
+		Region:    os.Getenv("S3_REGION"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		AccessKey: envOr("S3_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+		SecretKey: envOr("S3_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+	}
+	mediaPrefix := envOr("S3_PREFIX", "media/")
+	trashPrefix := envOr("S3_TRASH_PREFIX", "trash/")
+	if strings.HasPrefix(mediaPrefix, trashPrefix) || strings.HasPrefix(trashPrefix, mediaPrefix) {
+		panic("S3_PREFIX and S3_TRASH_PREFIX must not overlap")
+	}
+	store, err := blob.NewS3(config)
+	dieOnError("Invalid S3 configuration:", err)
+	return store.WithPrefix(mediaPrefix), store.WithPrefix(trashPrefix)
+}
+
+// envOr returns the environment variable, or the default value if empty
+func envOr(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	_ "github.com/lib/pq"
+	_ "github.com/sijms/go-ora/v2"
+	"github.com/warpcomdev/videoapi/internal/store"
+	_ "modernc.org/sqlite"
+)
+
+// Pragmas applied to every sqlite connection, unless the
+// connection string already includes its own parameters.
+// Transactions take the write lock when they begin, so that
+// concurrent writers wait for it instead of failing as busy.
+const sqlitePragmas = "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+// dialectFor selects the database driver and SQL dialect from the
+// scheme of the connection string. Returns the data source name
+// that must be provided to the driver.
+func dialectFor(connStr string) (driver, dsn string, dialect store.Dialect, err error) {
+	scheme, path, found := strings.Cut(connStr, "://")
+	if !found {
+		// A plain file path is an embedded sqlite database
+		scheme, path = "sqlite", connStr
+	}
+	switch strings.ToLower(scheme) {
+	case "oracle":
+		return "oracle", connStr, store.Oracle(), nil
+	case "postgres", "postgresql":
+		return "postgres", connStr, store.Postgres(), nil
+	case "sqlite", "file":
+		if path == "" {
+			return "", "", store.Dialect{}, fmt.Errorf("missing sqlite database path")
+		}
+		if !strings.Contains(path, "?") {
+			path = path + sqlitePragmas
+		}
+		return "sqlite", path, store.Sqlite(), nil
+	}
+	return "", "", store.Dialect{}, fmt.Errorf("unsupported database scheme %s", scheme)
+}
+
+// connect to the database and adapt the column mapper to the dialect
+func connect(driver string, dialect store.Dialect, connStr string) (*sqlx.DB, error) {
+	db, err := sqlx.Connect(driver, connStr)
+	if err != nil {
+		return nil, err
+	}
+	// Models tag their columns in uppercase, but each database
+	// reports the column names folded in its own way.
+	db.Mapper = reflectx.NewMapperTagFunc("db", strings.ToLower, dialect.Fold)
+	return db, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/warpcomdev/videoapi/internal/audit"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	"github.com/warpcomdev/videoapi/internal/migrate"
+	"github.com/warpcomdev/videoapi/internal/models"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+func importUsage() {
+	fmt.Println("\nvideoapi import")
+	fmt.Println("\tvideoapi import creates cameras or users from a csv or json file.")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("\tvideoapi import [-dry-run] [-upsert] <connection string> <camera|user> <file>")
+	fmt.Println()
+	fmt.Println("The file type is chosen by extension: .csv, or .json / .ndjson.")
+	fmt.Println("csv files must have a header line with the attribute names.")
+	fmt.Println("All the rows are validated before writing any of them, and")
+	fmt.Println("they are written in a single transaction.")
+	fmt.Println()
+	os.Exit(1)
+}
+
+// importer is the Importer of a store, with typed results
+type importer interface {
+	ImportRows(ctx context.Context, rows []crud.ImportRow, opts crud.ImportOptions) (crud.ImportResponse, error)
+}
+
+// runImport implements the "import" subcommand
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = importUsage
+	dryRun := flags.Bool("dry-run", false, "validate and roll back")
+	upsert := flags.Bool("upsert", false, "update existing resources")
+	flags.Parse(args)
+	if flags.NArg() != 3 {
+		importUsage()
+	}
+	connStr := os.ExpandEnv(flags.Arg(0))
+	resource, path := flags.Arg(1), flags.Arg(2)
+
+	mediaType := "application/json"
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		mediaType = "text/csv"
+	}
+	file, err := os.Open(path)
+	dieOnError("Can't open file:", err)
+	defer file.Close()
+	rows, err := crud.ImportRows(file, mediaType)
+	dieOnError("Invalid file:", err)
+
+	driver, dsn, dialect, err := dialectFor(connStr)
+	dieOnError("Invalid connection string:", err)
+	db, err := connect(driver, dialect, dsn)
+	dieOnError("Can't create connection:", err)
+	defer db.Close()
+	migrator, err := migrate.New(db, dialect, models.Migrations())
+	dieOnError("Invalid migrations:", err)
+	dieOnError("Schema check failed:", migrator.Check(context.Background()))
+
+	// No statement cache, each query runs once
+	querier := SqlxQuerier{DB: db, Dialect: dialect}
+	executor := SqlxExecutor{DB: db, Dialect: dialect}
+	// Same auditing as the API. Entries have no actor,
+	// and share a request id for the whole import.
+	auditDescriptor := models.AuditDescriptor()
+	auditStore := store.New[models.AuditEntry](
+		querier, executor, auditDescriptor.TableName, auditDescriptor.FilterSet, dialect,
+	)
+	var target importer
+	switch resource {
+	case "camera":
+		descriptor := models.CameraDescriptor()
+		target = store.Adapt[models.Camera](store.New[models.Camera](
+			querier, executor, descriptor.TableName, descriptor.FilterSet, dialect,
+		).WithAuditor(audit.Log{Resource: "camera", Store: auditStore}).
+			WithHistory(descriptor.HistoryTable, audit.Actor))
+	case "user":
+		descriptor := models.UserDescriptor()
+		target = store.Adapt[models.User](store.New[models.User](
+			querier, executor, descriptor.TableName, descriptor.FilterSet, dialect,
+		).WithAuditor(audit.Log{Resource: "user", Store: auditStore}))
+	default:
+		importUsage()
+	}
+
+	requestID := audit.NewID()
+	ctx := audit.WithRequestID(context.Background(), requestID)
+	result, err := target.ImportRows(ctx, rows, crud.ImportOptions{
+		DryRun: *dryRun,
+		Upsert: *upsert,
+	})
+	dieOnError("Import failed:", err)
+	for _, item := range result.Results {
+		if item.Error != "" {
+			fmt.Printf("line %d: %s (%d)\n", item.Line, item.Error, item.Status)
+		}
+	}
+	fmt.Printf("created %d, updated %d, failed %d\n", result.Created, result.Updated, result.Failed)
+	switch {
+	case result.Committed:
+		fmt.Printf("import committed, request id %s in the audit log\n", requestID)
+	case result.DryRun && result.Failed == 0:
+		fmt.Println("dry run, import rolled back")
+	default:
+		fmt.Println("import rolled back")
+		os.Exit(1)
+	}
+}
@@ -4,12 +4,24 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/warpcomdev/videoapi/internal/audit"
 )
 
+// Longest request id accepted from the client
+const maxRequestID = 128
+
+// logHandler logs every request, with an id that is
+// returned in the X-Request-Id header and saved in the audit log.
 func logHandler(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		handler.ServeHTTP(w, r)
-		log.Printf("HTTP %s %s %s %s", r.RemoteAddr, r.Method, r.URL, time.Since(start))
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > maxRequestID {
+			id = audit.NewID()
+		}
+		w.Header().Set("X-Request-Id", id)
+		handler.ServeHTTP(w, r.WithContext(audit.WithRequestID(r.Context(), id)))
+		log.Printf("HTTP %s %s %s %s %s", r.RemoteAddr, r.Method, r.URL, time.Since(start), id)
 	})
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/warpcomdev/videoapi/internal/migrate"
+	"github.com/warpcomdev/videoapi/internal/models"
+)
+
+func migrateUsage() {
+	fmt.Println("\nvideoapi migrate")
+	fmt.Println("\tvideoapi migrate manages the version of the database schema.")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("\tvideoapi migrate <connection string> status")
+	fmt.Println("\tvideoapi migrate <connection string> up [version]")
+	fmt.Println("\tvideoapi migrate <connection string> down <version>")
+	fmt.Println("\tvideoapi migrate <connection string> baseline <version>")
+	fmt.Println()
+	fmt.Println("Use baseline to adopt databases whose tables were created by")
+	fmt.Println("previous releases, without schema version information.")
+	fmt.Println()
+	os.Exit(1)
+}
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(args []string) {
+	if len(args) < 2 {
+		migrateUsage()
+	}
+	connStr := os.ExpandEnv(args[0])
+	action := args[1]
+	version := 0
+	if len(args) > 2 {
+		var err error
+		version, err = strconv.Atoi(args[2])
+		dieOnError("Invalid version:", err)
+	} else if action == "down" || action == "baseline" {
+		migrateUsage()
+	}
+
+	driver, dsn, dialect, err := dialectFor(connStr)
+	dieOnError("Invalid connection string:", err)
+	db, err := connect(driver, dialect, dsn)
+	dieOnError("Can't create connection:", err)
+	defer db.Close()
+	migrator, err := migrate.New(db, dialect, models.Migrations())
+	dieOnError("Invalid migrations:", err)
+
+	ctx := context.Background()
+	switch action {
+	case "status":
+	case "up":
+		err = migrator.Up(ctx, version)
+	case "down":
+		err = migrator.Down(ctx, version)
+	case "baseline":
+		err = migrator.Baseline(ctx, version)
+	default:
+		migrateUsage()
+	}
+	dieOnError("Migration failed:", err)
+	current, err := migrator.Current(ctx)
+	dieOnError("Can't read schema version:", err)
+	fmt.Printf("schema version %d, latest %d\n", current, migrator.Latest())
+}
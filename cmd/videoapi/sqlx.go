@@ -3,41 +3,54 @@ package main
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/warpcomdev/videoapi/internal/store"
 )
 
-// Builds a "OFFSET x LIMIT x" clause the oracle way
-func oracleLimiter(offset, limit int) string {
-	return fmt.Sprintf("OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
-}
-
-// Basic implementation of Querier for sqlx
-// TODO: add statement cache
+// Basic implementation of Querier for sqlx.
+// Cache is optional, if nil statements are not reused.
+// Queries built from the request filters are never cached.
 type SqlxQuerier struct {
-	DB *sqlx.DB
+	DB      *sqlx.DB
+	Dialect store.Dialect
+	Cache   *StmtCache
 }
 
 // GetContext implements store.Querier
 func (q SqlxQuerier) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	err := q.DB.GetContext(ctx, dest, replaceOraPlaceholders(query), args...)
-	return err
+	query = q.Dialect.Rebind(query)
+	if q.Cache == nil || store.IsDynamicQuery(ctx) {
+		return q.DB.GetContext(ctx, dest, query, q.Dialect.BindArgs(args)...)
+	}
+	stmt, release, err := q.Cache.Prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return stmt.GetContext(ctx, dest, q.Dialect.BindArgs(args)...)
 }
 
 // SelectContext implements store.Querier
 func (q SqlxQuerier) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	err := q.DB.SelectContext(ctx, dest, replaceOraPlaceholders(query), args...)
-	return err
+	query = q.Dialect.Rebind(query)
+	if q.Cache == nil || store.IsDynamicQuery(ctx) {
+		return q.DB.SelectContext(ctx, dest, query, q.Dialect.BindArgs(args)...)
+	}
+	stmt, release, err := q.Cache.Prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return stmt.SelectContext(ctx, dest, q.Dialect.BindArgs(args)...)
 }
 
 // Basic implementation of Prepared Statement for sqlx
 type SqlxStatement struct {
 	Stmt        *sql.Stmt
 	queryString string
+	// release the cached statement, if any
+	release func()
 }
 
 // QueryString implements Statement
@@ -47,7 +60,11 @@ func (stmt SqlxStatement) QueryString() string {
 
 // Close implements Statement
 func (stmt SqlxStatement) Close() error {
-	return stmt.Stmt.Close()
+	err := stmt.Stmt.Close()
+	if stmt.release != nil {
+		stmt.release()
+	}
+	return err
 }
 
 // Execute implements Statement
@@ -61,9 +78,16 @@ func (stmt SqlxStatement) Execute(ctx context.Context, params ...any) (int, erro
 }
 
 // Basic implementations of Transaction for sqlx
-// TODO: Add statement cache
+// Cache is optional, if nil statements are not reused.
 type SqlxTransaction struct {
-	Tx *sqlx.Tx
+	Tx      *sqlx.Tx
+	Dialect store.Dialect
+	Cache   *StmtCache
+}
+
+// GetContext implements store.Transaction
+func (tx SqlxTransaction) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return tx.Tx.GetContext(ctx, dest, tx.Dialect.Rebind(query), tx.Dialect.BindArgs(args)...)
 }
 
 // PrepareNamed implements Transaction
@@ -74,34 +98,21 @@ func (tx SqlxTransaction) PrepareNamed(ctx context.Context, sql string, params i
 	}
 	// For some reason, go-ora library does not provide the proper placeholders
 	// to sqlx. So we must do our own replacement
-	sql = replaceOraPlaceholders(sql)
-	stmt, err := tx.Tx.PrepareContext(ctx, sql)
+	sql = tx.Dialect.Rebind(sql)
+	if tx.Cache == nil {
+		stmt, err := tx.Tx.PrepareContext(ctx, sql)
+		if err != nil {
+			return nil, nil, err
+		}
+		return SqlxStatement{Stmt: stmt, queryString: sql}, tx.Dialect.BindArgs(args), nil
+	}
+	cached, release, err := tx.Cache.Prepare(ctx, sql)
 	if err != nil {
 		return nil, nil, err
 	}
-	return SqlxStatement{Stmt: stmt, queryString: sql}, args, nil
-}
-
-func replaceOraPlaceholders(query string) string {
-	// for some reason, go-ora does not seem to replace placeholders properly...
-	// Replace every '?' by consecutive :1, :2, etc
-	var sb strings.Builder
-	match := 1
-	for {
-		index := strings.Index(query, "?")
-		if index < 0 {
-			sb.WriteString(query)
-			return sb.String()
-		}
-		sb.WriteString(query[0:index])
-		sb.WriteString(":")
-		sb.WriteString(strconv.Itoa(match))
-		match += 1
-		if len(query) <= index+1 {
-			return sb.String()
-		}
-		query = query[index+1:]
-	}
+	// Binds the cached statement to the transaction's connection
+	stmt := tx.Tx.StmtxContext(ctx, cached)
+	return SqlxStatement{Stmt: stmt.Stmt, queryString: sql, release: release}, tx.Dialect.BindArgs(args), nil
 }
 
 // Commit implements store.Transaction
@@ -116,7 +127,9 @@ func (tx SqlxTransaction) Rollback() {
 
 // Basic implementations of store.Executor for sqlx
 type SqlxExecutor struct {
-	DB *sqlx.DB
+	DB      *sqlx.DB
+	Dialect store.Dialect
+	Cache   *StmtCache
 }
 
 // Begin implements store.Executor
@@ -125,5 +138,5 @@ func (e SqlxExecutor) Begin(ctx context.Context) (store.Transaction, error) {
 	if err != nil {
 		return nil, err
 	}
-	return SqlxTransaction{Tx: tx}, nil
+	return SqlxTransaction{Tx: tx, Dialect: e.Dialect, Cache: e.Cache}, nil
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	stmtCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "videoapi_stmt_cache_hits_total",
+		Help: "Number of prepared statements found in the cache",
+	})
+	stmtCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "videoapi_stmt_cache_misses_total",
+		Help: "Number of statements that had to be prepared",
+	})
+	stmtCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "videoapi_stmt_cache_evictions_total",
+		Help: "Number of prepared statements evicted from the cache",
+	})
+	stmtCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "videoapi_stmt_cache_size",
+		Help: "Number of prepared statements in the cache",
+	})
+)
+
+// StmtCache is a bounded LRU cache of prepared statements, keyed by
+// the SQL text. Statements are prepared on the *sqlx.DB, so database/sql
+// prepares them again on any connection they are used with, and reuses
+// the connection's statement when used inside a transaction.
+type StmtCache struct {
+	db      *sqlx.DB
+	size    int
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// cachedStmt is reference counted, so that statements
+// evicted while still in use are not closed until released.
+type cachedStmt struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+// NewStmtCache creates a cache holding up to size statements
+func NewStmtCache(db *sqlx.DB, size int) *StmtCache {
+	return &StmtCache{
+		db:      db,
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Prepare returns a cached statement for the query, preparing it if needed.
+// The release function must be called once the statement is no longer used.
+func (c *StmtCache) Prepare(ctx context.Context, query string) (*sqlx.Stmt, func(), error) {
+	if entry, ok := c.acquire(query); ok {
+		stmtCacheHits.Inc()
+		return entry.stmt, func() { c.release(entry) }, nil
+	}
+	stmtCacheMisses.Inc()
+	stmt, err := c.db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry := c.insert(query, stmt)
+	return entry.stmt, func() { c.release(entry) }, nil
+}
+
+// acquire a reference to a cached statement
+func (c *StmtCache) acquire(query string) (*cachedStmt, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[query]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cachedStmt)
+	entry.refs++
+	return entry, true
+}
+
+// insert a new statement in the cache, evicting the least recently used
+func (c *StmtCache) insert(query string, stmt *sqlx.Stmt) *cachedStmt {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// Somebody else might have prepared the same query meanwhile
+	if elem, ok := c.entries[query]; ok {
+		stmt.Close()
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*cachedStmt)
+		entry.refs++
+		return entry
+	}
+	entry := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.entries[query] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		evicted := oldest.Value.(*cachedStmt)
+		delete(c.entries, evicted.query)
+		evicted.evicted = true
+		if evicted.refs <= 0 {
+			evicted.stmt.Close()
+		}
+		stmtCacheEvictions.Inc()
+	}
+	stmtCacheSize.Set(float64(c.lru.Len()))
+	return entry
+}
+
+// release a reference to the statement, closing it if evicted
+func (c *StmtCache) release(entry *cachedStmt) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs <= 0 {
+		entry.stmt.Close()
+	}
+}
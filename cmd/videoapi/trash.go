@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// How often to look for expired items in the trash
+const purgeInterval = time.Hour
+
+// purger removes for good the resources deleted before the given time
+type purger interface {
+	Purge(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// trashBin is a kind of resource to purge
+type trashBin struct {
+	name   string
+	purger purger
+}
+
+// purgeTrash removes for good the resources deleted more than retention
+// ago, in the order of the bins. Runs forever.
+func purgeTrash(retention time.Duration, bins []trashBin) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		before := time.Now().Add(-retention)
+		for _, bin := range bins {
+			purged, err := bin.purger.Purge(context.Background(), before)
+			if len(purged) > 0 {
+				log.Printf("purged %d %s from the trash", len(purged), bin.name)
+			}
+			if err != nil {
+				log.Printf("failed to purge %s: %v", bin.name, err)
+			}
+		}
+		<-ticker.C
+	}
+}
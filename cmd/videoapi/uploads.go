@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// uploadPurger removes the uploads not completed in time
+type uploadPurger interface {
+	PurgeUploads(before time.Time) ([]string, error)
+}
+
+// purgeUploads removes the resumable uploads created more than
+// retention ago and not completed. Runs forever.
+func purgeUploads(retention time.Duration, purgers map[string]uploadPurger) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		before := time.Now().Add(-retention)
+		for name, purger := range purgers {
+			purged, err := purger.PurgeUploads(before)
+			if len(purged) > 0 {
+				log.Printf("purged %d expired %s uploads", len(purged), name)
+			}
+			if err != nil {
+				log.Printf("failed to purge %s uploads: %v", name, err)
+			}
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/auth"
+	"github.com/warpcomdev/videoapi/internal/models"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+type requestKey struct{}
+
+// WithRequestID appends the request id to the context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, id)
+}
+
+// RequestIDFrom returns the request id in the context, if any
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestKey{}).(string)
+	return id
+}
+
+// NewID builds a random id, prefixed with the current time
+// so that ids sort in the order they were created
+func NewID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405.000000Z"), hex.EncodeToString(suffix))
+}
+
+// Log implements store.Auditor, saving the changes
+// made to the named resource in the audit log
+type Log struct {
+	Resource string
+	Store    store.Resource[models.AuditEntry]
+}
+
+// Attributes whose values are never logged, only the fact that they changed
+var redacted = map[string]bool{
+	"password": true,
+}
+
+// Actor implements store.ActorFunc, with the claims in the context
+func Actor(ctx context.Context) (string, string) {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return "", ""
+	}
+	return claims.Subject, string(claims.Role)
+}
+
+// Audit implements store.Auditor
+func (l Log) Audit(ctx context.Context, change store.Change) error {
+	changes, err := diff(change.Before, change.After)
+	if err != nil {
+		return err
+	}
+	entry := models.AuditEntry{
+		Action:       string(change.Action),
+		ResourceType: l.Resource,
+		ResourceID:   change.ID,
+	}
+	entry.ID = NewID()
+	// Changes made without claims, e.g. by the alertmanager
+	// hook or the trash purge, have no actor.
+	if actor, role := Actor(ctx); actor != "" {
+		entry.Actor.String, entry.Actor.Valid = actor, true
+		entry.Role.String, entry.Role.Valid = role, true
+	}
+	if id := RequestIDFrom(ctx); id != "" {
+		entry.RequestID.String, entry.RequestID.Valid = id, true
+	}
+	entry.Changes.String, entry.Changes.Valid = string(changes), true
+	_, err = l.Store.Post(ctx, entry)
+	return err
+}
+
+// attribChange holds the values of an attribute before and after a change
+type attribChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// diff returns the attributes that are different in before and after,
+// as a json object. Either of them can be nil.
+func diff(before, after any) ([]byte, error) {
+	prev, err := attribs(before)
+	if err != nil {
+		return nil, err
+	}
+	next, err := attribs(after)
+	if err != nil {
+		return nil, err
+	}
+	// Missing attributes are the same as null
+	changes := make(map[string]attribChange)
+	for name, value := range prev {
+		if !isNull(value) || !isNull(next[name]) {
+			if !bytes.Equal(value, next[name]) {
+				changes[name] = attribChange{Before: value, After: next[name]}
+			}
+		}
+	}
+	for name, value := range next {
+		if _, ok := prev[name]; !ok && !isNull(value) {
+			changes[name] = attribChange{After: value}
+		}
+	}
+	// modified_at always changes, and is the time of the audit entry.
+	// transcode_progress is updated without audit, while transcoding.
+	delete(changes, "modified_at")
+	delete(changes, "transcode_progress")
+	for name := range changes {
+		if redacted[name] {
+			changes[name] = attribChange{}
+		}
+	}
+	return json.Marshal(changes)
+}
+
+// attribs returns the json attributes of the resource
+func attribs(resource any) (map[string]json.RawMessage, error) {
+	if resource == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isNull is true for missing or null json values
+func isNull(value json.RawMessage) bool {
+	return len(value) == 0 || string(value) == "null"
+}
@@ -86,6 +86,11 @@ func ClaimsFrom(ctx context.Context) (Claims, error) {
 	return claims, nil
 }
 
+// NewContext appends the claims to the context
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsID, claims)
+}
+
 // WithClaims appends Role information to the request context
 func WithClaims(jwtKey []byte, handler http.Handler) http.Handler {
 	wrapper := func(w http.ResponseWriter, r *http.Request) {
@@ -94,12 +99,31 @@ func WithClaims(jwtKey []byte, handler http.Handler) http.Handler {
 			WriteError(w, err, http.StatusUnauthorized)
 			return
 		}
-		ctx := context.WithValue(r.Context(), claimsID, role)
-		handler.ServeHTTP(w, r.WithContext(ctx))
+		handler.ServeHTTP(w, r.WithContext(NewContext(r.Context(), role)))
 	}
 	return http.HandlerFunc(wrapper)
 }
 
+// WithRoles appends Role information to the request context, like
+// WithClaims, and rejects the users without any of the given roles
+func WithRoles(jwtKey []byte, handler http.Handler, roles ...models.Role) http.Handler {
+	wrapper := func(w http.ResponseWriter, r *http.Request) {
+		claims, err := ClaimsFrom(r.Context())
+		if err != nil {
+			WriteError(w, err, http.StatusUnauthorized)
+			return
+		}
+		for _, role := range roles {
+			if claims.Role == role {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		WriteError(w, crud.ErrUnauthorized, http.StatusUnauthorized)
+	}
+	return WithClaims(jwtKey, http.HandlerFunc(wrapper))
+}
+
 type errResult struct {
 	Error string `json:"error"`
 }
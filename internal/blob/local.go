@@ -0,0 +1,166 @@
+// Package blob implements crud.BlobStore backends for the media files
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Local keeps blobs as files below a root folder
+type Local struct {
+	root string
+}
+
+// NewLocal creates the root folder, if it does not exist
+func NewLocal(root string) (Local, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return Local{}, err
+	}
+	return Local{root: root}, nil
+}
+
+// Path implements crud.LocalBlobStore
+func (l Local) Path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(crud.CleanKey(key)))
+}
+
+// Put implements crud.BlobStore. The file is written
+// with a temporary name, and renamed when complete.
+func (l Local) Put(ctx context.Context, key string, r io.Reader, size int64) (err error) {
+	finalPath := l.Path(key)
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(finalPath), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+	if _, err = io.Copy(tmpFile, r); err != nil {
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), finalPath)
+}
+
+// PutFile implements crud.LocalBlobStore. The file is renamed,
+// or copied if it is in a different filesystem.
+func (l Local) PutFile(ctx context.Context, key string, filePath string) error {
+	finalPath := l.Path(key)
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(filePath, finalPath); err == nil {
+		return nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return notFound(err)
+	}
+	defer file.Close()
+	if err := l.Put(ctx, key, file, -1); err != nil {
+		return err
+	}
+	return os.Remove(filePath)
+}
+
+// Get implements crud.BlobStore. The reader is an *os.File.
+func (l Local) Get(ctx context.Context, key string) (io.ReadCloser, crud.BlobInfo, error) {
+	file, err := os.Open(l.Path(key))
+	if err != nil {
+		return nil, crud.BlobInfo{}, notFound(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, crud.BlobInfo{}, err
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, crud.BlobInfo{}, crud.ErrNotFound
+	}
+	return file, infoOf(crud.CleanKey(key), stat), nil
+}
+
+// Stat implements crud.BlobStore
+func (l Local) Stat(ctx context.Context, key string) (crud.BlobInfo, error) {
+	stat, err := os.Stat(l.Path(key))
+	if err != nil {
+		return crud.BlobInfo{}, notFound(err)
+	}
+	if stat.IsDir() {
+		return crud.BlobInfo{}, crud.ErrNotFound
+	}
+	return infoOf(crud.CleanKey(key), stat), nil
+}
+
+// Delete implements crud.BlobStore
+func (l Local) Delete(ctx context.Context, key string) error {
+	return notFound(os.Remove(l.Path(key)))
+}
+
+// List implements crud.BlobStore, in lexical order
+func (l Local) List(ctx context.Context, prefix string, f func(crud.BlobInfo) error) error {
+	// Only walk the folder that contains the prefix
+	folder := ""
+	if index := strings.LastIndex(prefix, "/"); index >= 0 {
+		folder = prefix[:index]
+	}
+	err := filepath.WalkDir(l.Path(folder), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip temporary files of Put
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return f(infoOf(key, stat))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func infoOf(key string, stat fs.FileInfo) crud.BlobInfo {
+	return crud.BlobInfo{
+		Key:     path.Clean(key),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}
+}
+
+// notFound replaces fs.ErrNotExist with crud.ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return crud.ErrNotFound
+	}
+	return err
+}
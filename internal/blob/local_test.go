@@ -0,0 +1,91 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// traversalKeys try to escape the root of the store
+var traversalKeys = []string{
+	"../outside",
+	"../../outside",
+	"camera/../../outside",
+	"/outside",
+	`..\outside`,
+}
+
+func TestLocalPathStaysInRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	local, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := append(traversalKeys, "..%2foutside", "..%2F..%2Foutside")
+	for _, key := range keys {
+		got := local.Path(key)
+		if !strings.HasPrefix(got, root+string(filepath.Separator)) {
+			t.Errorf("Path(%q) = %q, outside of %q", key, got, root)
+		}
+	}
+	// Encoded separators are part of the file name
+	if got, want := local.Path("..%2foutside"), filepath.Join(root, "..%2foutside"); got != want {
+		t.Errorf("Path(%q) = %q, want %q", "..%2foutside", got, want)
+	}
+}
+
+func TestLocalPutStaysInRoot(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	local, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range traversalKeys {
+		if err := local.Put(ctx, key, strings.NewReader(key), -1); err != nil {
+			t.Fatalf("Put(%q) failed: %v", key, err)
+		}
+		if _, err := os.Stat(filepath.Join(base, "outside")); err == nil {
+			t.Fatalf("Put(%q) wrote outside of the root", key)
+		}
+		body, _, err := local.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q) failed: %v", key, err)
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != key {
+			t.Errorf("Get(%q) = %q, want %q", key, data, key)
+		}
+	}
+}
+
+func TestLocalGetStaysInRoot(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	if err := os.WriteFile(filepath.Join(base, "outside"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewLocal(filepath.Join(base, "root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range traversalKeys {
+		if body, _, err := local.Get(ctx, key); !errors.Is(err, crud.ErrNotFound) {
+			if err == nil {
+				body.Close()
+			}
+			t.Errorf("Get(%q) = %v, want %v", key, err, crud.ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// S3Config configures the connection to an S3 compatible service
+type S3Config struct {
+	// Endpoint URL, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://localhost:9000. Buckets are addressed by path.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Prefix prepended to every key, e.g. "media/"
+	Prefix string
+}
+
+// S3 keeps blobs in a bucket of an S3 compatible service.
+// Requests are signed with AWS signature version 4.
+type S3 struct {
+	config S3Config
+	base   *url.URL
+	client *http.Client
+}
+
+// NewS3 checks the configuration and builds the store
+func NewS3(config S3Config) (S3, error) {
+	if config.Bucket == "" {
+		return S3{}, errors.New("S3 bucket must be set")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	base, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return S3{}, err
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return S3{}, fmt.Errorf("invalid S3 endpoint %s", config.Endpoint)
+	}
+	return S3{
+		config: config,
+		base:   base,
+		client: &http.Client{},
+	}, nil
+}
+
+// WithPrefix returns a copy of the store that prepends
+// the prefix to the keys, e.g. to keep the trash apart.
+func (s S3) WithPrefix(prefix string) S3 {
+	s.config.Prefix = prefix
+	return s
+}
+
+// s3Error is the body of failed requests
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// Put implements crud.BlobStore. S3 needs the size in advance,
+// blobs of unknown size are read into memory first.
+func (s S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if size < 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, nil, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get implements crud.BlobStore. The reader can seek,
+// reading from the new offset with a range request.
+func (s S3) Get(ctx context.Context, key string) (io.ReadCloser, crud.BlobInfo, error) {
+	key = crud.CleanKey(key)
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil, 0)
+	if err != nil {
+		return nil, crud.BlobInfo{}, err
+	}
+	info := s.infoOf(key, resp)
+	return &s3Object{
+		store: s,
+		ctx:   ctx,
+		key:   key,
+		size:  info.Size,
+		body:  resp.Body,
+	}, info, nil
+}
+
+// Stat implements crud.BlobStore
+func (s S3) Stat(ctx context.Context, key string) (crud.BlobInfo, error) {
+	key = crud.CleanKey(key)
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil, 0)
+	if err != nil {
+		return crud.BlobInfo{}, err
+	}
+	resp.Body.Close()
+	return s.infoOf(key, resp), nil
+}
+
+// Delete implements crud.BlobStore. S3 does not report missing
+// objects when deleting, so they are checked first.
+func (s S3) Delete(ctx context.Context, key string) error {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listResult is the body of a ListObjectsV2 response
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// List implements crud.BlobStore, a page at a time
+func (s S3) List(ctx context.Context, prefix string, f func(crud.BlobInfo) error) error {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", s.config.Prefix+prefix)
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, item := range result.Contents {
+			info := crud.BlobInfo{
+				Key:     strings.TrimPrefix(item.Key, s.config.Prefix),
+				Size:    item.Size,
+				ModTime: item.LastModified,
+			}
+			if err := f(info); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s S3) infoOf(key string, resp *http.Response) crud.BlobInfo {
+	info := crud.BlobInfo{
+		Key:  key,
+		Size: resp.ContentLength,
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info
+}
+
+// do sends a signed request for the object with the given key,
+// or for the bucket if key is empty. Fails if the status is not 2xx.
+func (s S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	target := *s.base
+	target.Path = target.Path + "/" + s.config.Bucket + "/"
+	if key != "" {
+		target.Path += s.config.Prefix + crud.CleanKey(key)
+	}
+	// Send the path encoded exactly as signed
+	target.RawPath = uriEncode(target.Path, false)
+	target.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	s.sign(req, target.Path)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, crud.ErrNotFound
+	}
+	var failure s3Error
+	xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&failure)
+	return nil, fmt.Errorf("S3 %s %s failed with status %d: %s %s", method, target.Path, resp.StatusCode, failure.Code, failure.Message)
+}
+
+// Payloads are not signed, so that they can be streamed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// sign adds the AWS signature version 4 headers to the request
+func (s S3) sign(req *http.Request, path string) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := strings.Join([]string{now.Format("20060102"), s.config.Region, "s3", "aws4_request"}, "/")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(path, false),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + unsignedPayload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	key := []byte("AWS4" + s.config.SecretKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by key, as required by the signature
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but unreserved characters,
+// and slashes unless encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			sb.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+// s3Object reads an object, and supports seeking
+// by requesting the rest of the object from the offset.
+type s3Object struct {
+	store  S3
+	ctx    context.Context
+	key    string
+	size   int64
+	offset int64
+	// body reads the object from bodyOffset. Seeking is lazy,
+	// so that seeking to the end and back keeps the body.
+	body       io.ReadCloser
+	bodyOffset int64
+}
+
+// Read implements io.Reader
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body != nil && o.bodyOffset != o.offset {
+		o.body.Close()
+		o.body = nil
+	}
+	if o.body == nil {
+		header := http.Header{}
+		header.Set("Range", "bytes="+strconv.FormatInt(o.offset, 10)+"-")
+		resp, err := o.store.do(o.ctx, http.MethodGet, o.key, nil, header, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		o.body, o.bodyOffset = resp.Body, o.offset
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	o.bodyOffset = o.offset
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the beginning of the object")
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+// Close implements io.Closer
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	return o.body.Close()
+}
@@ -0,0 +1,172 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlobInfo describes a blob in a BlobStore
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore keeps the media files. Keys are slash separated paths.
+// Get, Stat and Delete fail with ErrNotFound for missing blobs.
+type BlobStore interface {
+	// Put saves the blob, replacing any previous one with the same key.
+	// Size is -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get streams the blob. The reader may also implement io.Seeker.
+	Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	// List calls f for every blob whose key begins with prefix
+	List(ctx context.Context, prefix string, f func(BlobInfo) error) error
+}
+
+// LocalBlobStore is implemented by blob stores that keep blobs
+// in the local filesystem, and can move files without copying them
+type LocalBlobStore interface {
+	BlobStore
+	// Path of the file with the blob
+	Path(key string) string
+	// PutFile moves the file to the store
+	PutFile(ctx context.Context, key string, filePath string) error
+}
+
+// CleanKey removes any relative path elements from the key,
+// so it can not escape the store. Backslashes are taken as separators,
+// like windows does. Returns "" if nothing is left.
+func CleanKey(key string) string {
+	key = strings.ReplaceAll(key, "\\", "/")
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
+// PutFile saves the local file in the store, moving
+// it if the store supports it, or copying it otherwise.
+func PutFile(ctx context.Context, blobs BlobStore, key string, filePath string) error {
+	if local, ok := blobs.(LocalBlobStore); ok {
+		return local.PutFile(ctx, key, filePath)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	size := int64(-1)
+	if stat, err := file.Stat(); err == nil {
+		size = stat.Size()
+	}
+	return blobs.Put(ctx, key, file, size)
+}
+
+// moveBlobs moves the blobs whose key begins with prefix between stores
+func moveBlobs(ctx context.Context, from, to BlobStore, prefix string) error {
+	var infos []BlobInfo
+	if err := from.List(ctx, prefix, func(info BlobInfo) error {
+		infos = append(infos, info)
+		return nil
+	}); err != nil {
+		return err
+	}
+	var err error
+	for _, info := range infos {
+		err = errors.Join(err, moveBlob(ctx, from, to, info))
+	}
+	return err
+}
+
+// moveBlob moves a single blob between stores
+func moveBlob(ctx context.Context, from, to BlobStore, info BlobInfo) error {
+	if local, ok := from.(LocalBlobStore); ok {
+		if err := PutFile(ctx, to, info.Key, local.Path(info.Key)); err != nil {
+			return err
+		}
+		// PutFile may have already moved the file
+		if err := from.Delete(ctx, info.Key); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	body, _, err := from.Get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := to.Put(ctx, info.Key, body, info.Size); err != nil {
+		return err
+	}
+	return from.Delete(ctx, info.Key)
+}
+
+// removeBlobs removes all the blobs whose key begins with prefix
+func removeBlobs(ctx context.Context, blobs BlobStore, prefix string) error {
+	var keys []string
+	if err := blobs.List(ctx, prefix, func(info BlobInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	}); err != nil {
+		return err
+	}
+	var err error
+	for _, key := range keys {
+		if delErr := blobs.Delete(ctx, key); delErr != nil && !errors.Is(delErr, ErrNotFound) {
+			err = errors.Join(err, delErr)
+		}
+	}
+	return err
+}
+
+// BlobHandler serves the blobs in the store. Range and conditional
+// requests are supported if the blob reader implements io.Seeker.
+func BlobHandler(blobs BlobStore) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			JsonError(w, ErrUnsupportedMethod)
+			return
+		}
+		key := CleanKey(r.URL.Path)
+		if key == "" {
+			JsonError(w, ErrNotFound)
+			return
+		}
+		body, info, err := blobs.Get(r.Context(), key)
+		if err != nil {
+			JsonError(w, err)
+			return
+		}
+		defer body.Close()
+		if seeker, ok := body.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, path.Base(key), info.ModTime, seeker)
+			return
+		}
+		if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		if info.Size >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		}
+		if !info.ModTime.IsZero() {
+			w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			log.Printf("Failed to deliver blob %s: %s", key, err.Error())
+		}
+	}
+	return http.HandlerFunc(handler)
+}
@@ -0,0 +1,27 @@
+package crud
+
+import "testing"
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "camera/video.mp4", want: "camera/video.mp4"},
+		{key: "../video.mp4", want: "video.mp4"},
+		{key: "../../etc/passwd", want: "etc/passwd"},
+		{key: "camera/../../etc/passwd", want: "etc/passwd"},
+		{key: "/etc/passwd", want: "etc/passwd"},
+		{key: "//camera//./video.mp4", want: "camera/video.mp4"},
+		{key: "..%2f..%2fetc%2fpasswd", want: "..%2f..%2fetc%2fpasswd"},
+		{key: `..\..\etc\passwd`, want: "etc/passwd"},
+		{key: "..", want: ""},
+		{key: "/", want: ""},
+		{key: "", want: ""},
+	}
+	for _, test := range tests {
+		if got := CleanKey(test.key); got != test.want {
+			t.Errorf("CleanKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package crud
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Path of the bulk endpoint, relative to the resource
+const BULK_PATH = "_bulk"
+
+// Maximum number of operations in a single bulk request
+const maxBulkOperations = 1000
+
+// BulkOp is the kind of operation in a bulk request
+type BulkOp string
+
+const (
+	BULK_CREATE BulkOp = "create"
+	BULK_UPDATE BulkOp = "update"
+	BULK_PATCH  BulkOp = "patch"
+	BULK_DELETE BulkOp = "delete"
+)
+
+// BulkOperation is a single item of a bulk request
+type BulkOperation struct {
+	Op BulkOp `json:"op"`
+	// Resource id, mandatory except for create
+	ID string `json:"id,omitempty"`
+	// Resource for create / update, merge patch for patch
+	Data json.RawMessage `json:"data,omitempty"`
+	// Optional precondition, same as the If-Match header
+	IfMatch string `json:"if_match,omitempty"`
+}
+
+// BulkResult is the outcome of a single operation
+type BulkResult struct {
+	Op     BulkOp `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkResponse is the outcome of a bulk request
+type BulkResponse struct {
+	// False if the changes were rolled back
+	Committed bool         `json:"committed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// Valid checks the operation has all the required attributes
+func (op BulkOperation) Valid() bool {
+	switch op.Op {
+	case BULK_CREATE:
+		return len(op.Data) > 0
+	case BULK_UPDATE, BULK_PATCH:
+		return op.ID != "" && len(op.Data) > 0
+	case BULK_DELETE:
+		return op.ID != ""
+	}
+	return false
+}
+
+// bulkOperations reads the operations from the request body,
+// either as a json array or as newline delimited json.
+func bulkOperations(r *http.Request) ([]BulkOperation, error) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, ErrUnsupportedMediaType
+		}
+		switch mediaType {
+		case "application/json", "application/x-ndjson", "application/ndjson":
+		default:
+			return nil, ErrUnsupportedMediaType
+		}
+	}
+	items, err := jsonItems(r.Body, maxBulkOperations)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > maxBulkOperations {
+		return nil, ErrBulkTooLarge
+	}
+	ops := make([]BulkOperation, 0, len(items))
+	for _, item := range items {
+		var op BulkOperation
+		if err := json.Unmarshal(item, &op); err != nil {
+			return nil, ErrInvalidJson
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, ErrEmptyBody
+	}
+	return ops, nil
+}
+
+// jsonItems reads the items of a json array or of newline delimited json.
+// Stops reading after max + 1 items, so the caller can tell the body is
+// too large.
+func jsonItems(r io.Reader, max int) ([]json.RawMessage, error) {
+	body := bufio.NewReader(r)
+	// Skip whitespace to tell arrays from ndjson
+	isArray := false
+	for {
+		b, err := body.ReadByte()
+		if err == io.EOF {
+			return nil, ErrEmptyBody
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			isArray = b == '['
+			body.UnreadByte()
+			break
+		}
+	}
+	dec := json.NewDecoder(body)
+	var items []json.RawMessage
+	if isArray {
+		// Item by item, not to hold a whole large array in memory
+		if _, err := dec.Token(); err != nil {
+			return nil, ErrInvalidJson
+		}
+		for dec.More() && len(items) <= max {
+			var item json.RawMessage
+			if err := dec.Decode(&item); err != nil {
+				return nil, ErrInvalidJson
+			}
+			items = append(items, item)
+		}
+		if len(items) > max {
+			return items, nil
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, ErrInvalidJson
+		}
+		return items, nil
+	}
+	for len(items) <= max {
+		var item json.RawMessage
+		err := dec.Decode(&item)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidJson
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
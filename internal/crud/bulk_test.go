@@ -0,0 +1,74 @@
+package crud
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// endlessItems is a body that never ends, with the
+// given prefix followed by the item over and over
+type endlessItems struct {
+	prefix string
+	item   string
+}
+
+func (e *endlessItems) Read(p []byte) (int, error) {
+	if e.prefix != "" {
+		n := copy(p, e.prefix)
+		e.prefix = e.prefix[n:]
+		return n, nil
+	}
+	n := 0
+	for n+len(e.item) <= len(p) {
+		n += copy(p[n:], e.item)
+	}
+	return n, nil
+}
+
+func TestJsonItemsStopsAfterMax(t *testing.T) {
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{name: "array", body: &endlessItems{prefix: " [", item: `{"op": "delete", "id": "a"},`}},
+		{name: "ndjson", body: &endlessItems{item: `{"op": "delete", "id": "a"}` + "\n"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items, err := jsonItems(test.body, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 11 {
+				t.Errorf("got %d items, want 11", len(items))
+			}
+		})
+	}
+}
+
+func TestJsonItems(t *testing.T) {
+	tests := []struct {
+		body  string
+		items int
+		err   error
+	}{
+		{body: `[{"a": 1}, {"a": 2}]`, items: 2},
+		{body: "\n  []", items: 0},
+		{body: "{\"a\": 1}\n{\"a\": 2}\n{\"a\": 3}", items: 3},
+		{body: `[{"a": 1}, {"a": 2}`, err: ErrInvalidJson},
+		{body: `[{"a": 1} {"a": 2}]`, err: ErrInvalidJson},
+		{body: "   ", err: ErrEmptyBody},
+	}
+	for _, test := range tests {
+		items, err := jsonItems(strings.NewReader(test.body), 10)
+		if !errors.Is(err, test.err) {
+			t.Errorf("jsonItems(%q) = %v, want %v", test.body, err, test.err)
+			continue
+		}
+		if len(items) != test.items {
+			t.Errorf("jsonItems(%q) got %d items, want %d", test.body, len(items), test.items)
+		}
+	}
+}
@@ -53,6 +53,52 @@ func (err Error) HttpError() (int, string) {
 		return http.StatusUnauthorized, "invalid role"
 	case ErrorMissingRole:
 		return http.StatusUnauthorized, "missing role"
+	case ErrInvalidCursor:
+		return http.StatusBadRequest, "invalid cursor"
+	case ErrInvalidPatch:
+		return http.StatusBadRequest, "merge patch must be a json object"
+	case ErrInvalidAttribute:
+		return http.StatusBadRequest, "unknown attribute or null value for mandatory attribute"
+	case ErrPreconditionFailed:
+		return http.StatusPreconditionFailed, "resource has been modified"
+	case ErrBulkTooLarge:
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("bulk requests are limited to %d operations", maxBulkOperations)
+	case ErrInvalidBulkOperation:
+		return http.StatusBadRequest, "bulk operation must have a valid op, and id or data as required"
+	case ErrBulkAborted:
+		return http.StatusFailedDependency, "not executed, a previous operation failed"
+	case ErrInvalidField:
+		return http.StatusBadRequest, "fields must be attributes of the resource"
+	case ErrInvalidExpression:
+		return http.StatusBadRequest, "filter must be an expression like (field op 'value' and ...) or ..."
+	case ErrFilterTooComplex:
+		return http.StatusBadRequest, fmt.Sprintf("filter expressions are limited to %d characters, %d conditions and %d levels of nesting", maxExprLength, maxExprConditions, maxExprDepth)
+	case ErrInvalidGeo:
+		return http.StatusBadRequest, "near must be lat,lon, radius a distance like 500m or 2km, bbox minLon,minLat,maxLon,maxLat, and sorting by distance needs near"
+	case ErrInvalidFormat:
+		return http.StatusBadRequest, "format must be json, geojson, csv or ndjson"
+	case ErrInvalidAggregation:
+		return http.StatusBadRequest, "group_by must be attributes among camera, severity and tag, and bucket one of hour, day or week"
+	case ErrImportTooLarge:
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("imports are limited to %d rows", maxImportRows)
+	case ErrAlreadyExists:
+		return http.StatusConflict, "resource already exists"
+	case ErrImportAborted:
+		return http.StatusFailedDependency, "not executed, other rows failed"
+	case ErrInvalidImport:
+		return http.StatusBadRequest, "import must be a csv file with a header line, or json objects"
+	case ErrInvalidUpload:
+		return http.StatusBadRequest, "upload must have a positive size and a supported content_type"
+	case ErrUploadOffset:
+		return http.StatusConflict, "Upload-Offset does not match the size of the upload"
+	case ErrUploadTooLarge:
+		return http.StatusRequestEntityTooLarge, "chunk exceeds the size of the upload"
+	case ErrUploadIncomplete:
+		return http.StatusConflict, "upload is not complete"
+	case ErrUploadBusy:
+		return http.StatusConflict, "upload is being used by another request"
+	case ErrInvalidOffset:
+		return http.StatusBadRequest, "offset must be a non negative number"
 	default:
 		return http.StatusInternalServerError, fmt.Sprintf("error code %d", err)
 	}
@@ -87,4 +133,27 @@ const (
 	ErrorInvalidToken
 	ErrorInvalidRole
 	ErrorMissingRole
+	ErrInvalidCursor
+	ErrInvalidPatch
+	ErrInvalidAttribute
+	ErrPreconditionFailed
+	ErrBulkTooLarge
+	ErrInvalidBulkOperation
+	ErrBulkAborted
+	ErrInvalidField
+	ErrInvalidExpression
+	ErrFilterTooComplex
+	ErrInvalidAggregation
+	ErrInvalidGeo
+	ErrInvalidFormat
+	ErrImportTooLarge
+	ErrInvalidImport
+	ErrAlreadyExists
+	ErrImportAborted
+	ErrInvalidUpload
+	ErrUploadOffset
+	ErrUploadTooLarge
+	ErrUploadIncomplete
+	ErrUploadBusy
+	ErrInvalidOffset
 )
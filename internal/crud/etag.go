@@ -0,0 +1,67 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tagged is implemented by results that carry an entity tag
+type Tagged interface {
+	ETag() string
+}
+
+// ETag builds a strong entity tag from the version
+// (last modification time) of a resource.
+func ETag(version time.Time) string {
+	return `"` + strconv.FormatInt(version.UnixNano(), 16) + `"`
+}
+
+// ParseETag returns the version of a tag generated by ETag
+func ParseETag(tag string) (time.Time, error) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return time.Time{}, errors.New("entity tag must be a quoted string")
+	}
+	nanos, err := strconv.ParseInt(tag[1:len(tag)-1], 16, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// splitETags splits the list of tags in If-Match or If-None-Match headers
+func splitETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// noneMatch evaluates the If-None-Match header, using weak comparison
+func noneMatch(header string, etag string) bool {
+	for _, tag := range splitETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return false
+		}
+	}
+	return true
+}
+
+type ifMatchKey struct{}
+
+// WithIfMatch saves the tags of the If-Match header in the context
+func WithIfMatch(ctx context.Context, tags []string) context.Context {
+	return context.WithValue(ctx, ifMatchKey{}, tags)
+}
+
+// IfMatchFrom returns the tags of the If-Match header, if any.
+// A tag "*" matches any existing resource.
+func IfMatchFrom(ctx context.Context) ([]string, bool) {
+	tags, ok := ctx.Value(ifMatchKey{}).([]string)
+	return tags, ok && len(tags) > 0
+}
@@ -0,0 +1,40 @@
+package crud
+
+import (
+	"context"
+	"io"
+	"mime"
+	"strings"
+)
+
+// Exporter is implemented by resources that can stream
+// all the resources matching a query, without pagination.
+type Exporter interface {
+	// Export the resources matching the query, in query.Format
+	Export(ctx context.Context, query Query) (io.ReadCloser, error)
+}
+
+// Media types of the streaming formats, for content negotiation
+var exportTypes = map[string]Format{
+	"text/csv":             FORMAT_CSV,
+	"application/x-ndjson": FORMAT_NDJSON,
+	"application/ndjson":   FORMAT_NDJSON,
+}
+
+// acceptFormat returns the first streaming format in the Accept header,
+// or "" if there is none. Quality values are not taken into account.
+func acceptFormat(header string) Format {
+	if header == "" {
+		return ""
+	}
+	for _, item := range strings.Split(header, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		if format, ok := exportTypes[mediaType]; ok {
+			return format
+		}
+	}
+	return ""
+}
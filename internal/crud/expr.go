@@ -0,0 +1,332 @@
+package crud
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Limits of filter expressions, so that a single request
+// can not build an arbitrarily complex query.
+const (
+	maxExprLength     = 4096
+	maxExprDepth      = 8
+	maxExprConditions = 64
+)
+
+// ExprOp is the boolean operator of a filter expression node
+type ExprOp string
+
+const (
+	EXPR_AND ExprOp = "and"
+	EXPR_OR  ExprOp = "or"
+	EXPR_NOT ExprOp = "not"
+)
+
+// Expr is a node of a filter expression. Leaves have a Cond with
+// a single value, or all the values of a list operator, and inner
+// nodes an Op and the Terms it combines.
+type Expr struct {
+	Op    ExprOp
+	Terms []Expr
+	Cond  *Filter
+}
+
+// String formats the expression so that ParseExpr reads it back
+func (e Expr) String() string {
+	var sb strings.Builder
+	e.format(&sb)
+	return sb.String()
+}
+
+func (e Expr) format(sb *strings.Builder) {
+	if e.Cond != nil {
+		sb.WriteString(e.Cond.Field)
+		sb.WriteString(" ")
+		sb.WriteString(string(e.Cond.Operator))
+		switch {
+		case e.Cond.Operator.List():
+			sb.WriteString(" (")
+			for idx, v := range e.Cond.Values {
+				if idx > 0 {
+					sb.WriteString(", ")
+				}
+				formatValue(sb, v)
+			}
+			sb.WriteString(")")
+		case !e.Cond.Operator.Unary():
+			sb.WriteString(" ")
+			formatValue(sb, e.Cond.Values[0])
+		}
+		return
+	}
+	if e.Op == EXPR_NOT {
+		sb.WriteString("not ")
+	}
+	sb.WriteString("(")
+	for idx, term := range e.Terms {
+		if idx > 0 {
+			sb.WriteString(" ")
+			sb.WriteString(string(e.Op))
+			sb.WriteString(" ")
+		}
+		term.format(sb)
+	}
+	sb.WriteString(")")
+}
+
+// formatValue writes the value quoted
+func formatValue(sb *strings.Builder, v string) {
+	sb.WriteString("'")
+	sb.WriteString(strings.ReplaceAll(v, "'", "''"))
+	sb.WriteString("'")
+}
+
+// ParseExpr parses a filter expression like
+//
+//	(camera eq 'A' and tags eq 'x') or camera in ('B', 'C')
+//
+// Values can be quoted with single quotes (doubled to escape them),
+// or bare if they have no spaces, commas or parenthesis.
+func ParseExpr(text string) (*Expr, error) {
+	if len(text) > maxExprLength {
+		return nil, ErrFilterTooComplex
+	}
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	p := exprParser{tokens: tokens}
+	expr, err := p.or(1)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, ErrInvalidExpression
+	}
+	return &expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenQuoted
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// is checks if the token is the given (case insensitive) keyword
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// tokenize splits the expression in words, quoted values and punctuation
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	runes := []rune(text)
+	for pos := 0; pos < len(runes); {
+		char := runes[pos]
+		switch {
+		case unicode.IsSpace(char):
+			pos++
+		case char == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			pos++
+		case char == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			pos++
+		case char == ',':
+			tokens = append(tokens, token{kind: tokenComma})
+			pos++
+		case char == '\'':
+			var sb strings.Builder
+			closed := false
+			for pos++; pos < len(runes); pos++ {
+				if runes[pos] == '\'' {
+					if pos+1 < len(runes) && runes[pos+1] == '\'' {
+						sb.WriteRune('\'')
+						pos++
+						continue
+					}
+					closed = true
+					pos++
+					break
+				}
+				sb.WriteRune(runes[pos])
+			}
+			if !closed {
+				return nil, ErrInvalidExpression
+			}
+			tokens = append(tokens, token{kind: tokenQuoted, text: sb.String()})
+		default:
+			start := pos
+			for pos < len(runes) && !unicode.IsSpace(runes[pos]) && !strings.ContainsRune("(),'", runes[pos]) {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[start:pos])})
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser is a recursive descent parser, with the usual
+// precedence: not binds tighter than and, and tighter than or.
+type exprParser struct {
+	tokens     []token
+	pos        int
+	conditions int
+}
+
+func (p *exprParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *exprParser) next() (token, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return t, ok
+}
+
+// or := and ("or" and)*
+func (p *exprParser) or(depth int) (Expr, error) {
+	return p.binary(depth, EXPR_OR, p.and)
+}
+
+// and := not ("and" not)*
+func (p *exprParser) and(depth int) (Expr, error) {
+	return p.binary(depth, EXPR_AND, p.not)
+}
+
+// binary parses a list of terms separated by the operator
+func (p *exprParser) binary(depth int, op ExprOp, term func(int) (Expr, error)) (Expr, error) {
+	first, err := term(depth)
+	if err != nil {
+		return Expr{}, err
+	}
+	terms := []Expr{first}
+	for {
+		t, ok := p.peek()
+		if !ok || !t.is(string(op)) {
+			break
+		}
+		p.pos++
+		next, err := term(depth)
+		if err != nil {
+			return Expr{}, err
+		}
+		terms = append(terms, next)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return Expr{Op: op, Terms: terms}, nil
+}
+
+// not := "not" not | "(" or ")" | condition
+func (p *exprParser) not(depth int) (Expr, error) {
+	if depth > maxExprDepth {
+		return Expr{}, ErrFilterTooComplex
+	}
+	t, ok := p.peek()
+	if !ok {
+		return Expr{}, ErrInvalidExpression
+	}
+	switch {
+	case t.is(string(EXPR_NOT)):
+		p.pos++
+		term, err := p.not(depth + 1)
+		if err != nil {
+			return Expr{}, err
+		}
+		return Expr{Op: EXPR_NOT, Terms: []Expr{term}}, nil
+	case t.kind == tokenOpen:
+		p.pos++
+		inner, err := p.or(depth + 1)
+		if err != nil {
+			return Expr{}, err
+		}
+		if t, ok := p.next(); !ok || t.kind != tokenClose {
+			return Expr{}, ErrInvalidExpression
+		}
+		return inner, nil
+	}
+	return p.condition()
+}
+
+// condition := field operator [value | "(" value ("," value)* ")"]
+func (p *exprParser) condition() (Expr, error) {
+	p.conditions++
+	if p.conditions > maxExprConditions {
+		return Expr{}, ErrFilterTooComplex
+	}
+	field, ok := p.next()
+	if !ok || field.kind != tokenWord {
+		return Expr{}, ErrInvalidExpression
+	}
+	// Avoid SQL injection by checking column name
+	if !isColumnName(field.text) {
+		return Expr{}, ErrInvalidColumn
+	}
+	opToken, ok := p.next()
+	if !ok || opToken.kind != tokenWord {
+		return Expr{}, ErrInvalidExpression
+	}
+	op := Operator(strings.ToLower(opToken.text))
+	if !op.Valid() {
+		return Expr{}, ErrInvalidOperator
+	}
+	cond := &Filter{
+		Field:    field.text,
+		Operator: op,
+		Values:   []string{""},
+	}
+	if op.Unary() {
+		return Expr{Cond: cond}, nil
+	}
+	t, ok := p.next()
+	if !ok {
+		return Expr{}, ErrInvalidExpression
+	}
+	switch t.kind {
+	case tokenWord, tokenQuoted:
+		cond.Values[0] = t.text
+	case tokenOpen:
+		// List of values, only for list operators
+		if !op.List() {
+			return Expr{}, ErrInvalidExpression
+		}
+		var values []string
+		for {
+			v, ok := p.next()
+			if !ok || (v.kind != tokenWord && v.kind != tokenQuoted) {
+				return Expr{}, ErrInvalidExpression
+			}
+			values = append(values, v.text)
+			sep, ok := p.next()
+			if !ok {
+				return Expr{}, ErrInvalidExpression
+			}
+			if sep.kind == tokenClose {
+				break
+			}
+			if sep.kind != tokenComma {
+				return Expr{}, ErrInvalidExpression
+			}
+		}
+		cond.Values = values
+	default:
+		return Expr{}, ErrInvalidExpression
+	}
+	return Expr{Cond: cond}, nil
+}
@@ -0,0 +1,38 @@
+package crud
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExprListValues(t *testing.T) {
+	tests := []struct {
+		text   string
+		values []string
+	}{
+		{text: "camera in ('a,b', 'c')", values: []string{"a,b", "c"}},
+		{text: "camera in ('it''s', b)", values: []string{"it's", "b"}},
+		{text: "camera in 'a,b'", values: []string{"a,b"}},
+		{text: "camera eq 'a,b'", values: []string{"a,b"}},
+	}
+	for _, test := range tests {
+		expr, err := ParseExpr(test.text)
+		if err != nil {
+			t.Errorf("ParseExpr(%q) failed: %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(expr.Cond.Values, test.values) {
+			t.Errorf("ParseExpr(%q) values = %q, want %q", test.text, expr.Cond.Values, test.values)
+		}
+		again, err := ParseExpr(expr.String())
+		if err != nil || !reflect.DeepEqual(again, expr) {
+			t.Errorf("ParseExpr(%q) does not read back %q", expr.String(), test.text)
+		}
+	}
+}
+
+func TestParseExprListOnlyForListOperators(t *testing.T) {
+	if _, err := ParseExpr("camera eq ('a', 'b')"); err != ErrInvalidExpression {
+		t.Errorf("got error %v, want %v", err, ErrInvalidExpression)
+	}
+}
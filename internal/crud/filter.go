@@ -12,19 +12,18 @@ type Filter struct {
 	Values   []string
 }
 
-// merge identical strings
+// merge identical strings, keeping the order of the first ones.
+// Sort columns depend on it, cursors are encoded in that order.
 func merge(values []string) []string {
 	set := make(map[string]struct{})
+	result := make([]string, 0, len(values))
 	for _, v := range values {
 		v := strings.TrimSpace(v)
-		if v != "" {
+		if _, ok := set[v]; !ok && v != "" {
 			set[v] = struct{}{}
+			result = append(result, v)
 		}
 	}
-	result := make([]string, 0, len(set))
-	for k := range set {
-		result = append(result, k)
-	}
 	return result
 }
 
@@ -38,6 +37,29 @@ func isColumnName(name string) bool {
 	return true
 }
 
+// fieldsFrom builds the list of fields from comma separated values,
+// keeping the order and removing duplicates
+func fieldsFrom(values []string) ([]string, error) {
+	var fields []string
+	seen := make(map[string]struct{})
+	for _, v := range values {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !isColumnName(field) {
+				return nil, ErrInvalidField
+			}
+			if _, ok := seen[field]; !ok {
+				seen[field] = struct{}{}
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
+
 // FiltersFrom build list of filters from url query values
 func filtersFrom(params map[string][]string) ([]Filter, error) {
 	filters := make(map[string]Filter, len(params))
@@ -84,6 +106,12 @@ func filtersFrom(params map[string][]string) ([]Filter, error) {
 	result := make([]Filter, 0, len(filters))
 	for _, v := range filters {
 		v.Values = merge(v.Values)
+		if v.Operator.Unary() {
+			// Keep a single condition, whatever the values
+			v.Values = []string{""}
+		} else if len(v.Values) == 0 {
+			return nil, ErrInvalidFilter
+		}
 		result = append(result, v)
 	}
 	return result, nil
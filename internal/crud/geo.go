@@ -0,0 +1,149 @@
+package crud
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Name of the pseudo attribute with the distance to Geo.Near,
+// that results can be sorted by.
+const DISTANCE = "distance"
+
+// GeoPoint is a WGS84 position, in degrees
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoBox is a bounding box, from the south west to the north east corner
+type GeoBox struct {
+	SouthWest GeoPoint
+	NorthEast GeoPoint
+}
+
+// Contains checks if the point is inside the box, borders included
+func (b GeoBox) Contains(p GeoPoint) bool {
+	return p.Latitude >= b.SouthWest.Latitude && p.Latitude <= b.NorthEast.Latitude &&
+		p.Longitude >= b.SouthWest.Longitude && p.Longitude <= b.NorthEast.Longitude
+}
+
+// Geo filters resources by position
+type Geo struct {
+	// Point to compute distances from, if any
+	Near *GeoPoint
+	// Maximum distance to Near, in meters. 0 for no limit.
+	Radius float64
+	// Bounding box the resources must be in, if any
+	BBox *GeoBox
+}
+
+// HasFilter is true if the resources must be filtered by position
+func (g Geo) HasFilter() bool {
+	return g.BBox != nil || (g.Near != nil && g.Radius > 0)
+}
+
+// geoFrom builds the geo filter from url query values:
+// near=lat,lon, radius=500m|2km and bbox=minLon,minLat,maxLon,maxLat.
+func geoFrom(params url.Values) (Geo, error) {
+	var geo Geo
+	if near := params.Get("near"); near != "" {
+		coords, err := parseCoords(near, 2)
+		if err != nil {
+			return Geo{}, err
+		}
+		geo.Near = &GeoPoint{Latitude: coords[0], Longitude: coords[1]}
+		if !geo.Near.valid() {
+			return Geo{}, ErrInvalidGeo
+		}
+	}
+	if radius := params.Get("radius"); radius != "" {
+		if geo.Near == nil {
+			return Geo{}, ErrInvalidGeo
+		}
+		meters, err := parseDistance(radius)
+		if err != nil {
+			return Geo{}, err
+		}
+		geo.Radius = meters
+	}
+	if bbox := params.Get("bbox"); bbox != "" {
+		// Same order as GeoJSON: longitude first
+		coords, err := parseCoords(bbox, 4)
+		if err != nil {
+			return Geo{}, err
+		}
+		geo.BBox = &GeoBox{
+			SouthWest: GeoPoint{Latitude: coords[1], Longitude: coords[0]},
+			NorthEast: GeoPoint{Latitude: coords[3], Longitude: coords[2]},
+		}
+		if !geo.BBox.SouthWest.valid() || !geo.BBox.NorthEast.valid() ||
+			geo.BBox.SouthWest.Latitude > geo.BBox.NorthEast.Latitude ||
+			geo.BBox.SouthWest.Longitude > geo.BBox.NorthEast.Longitude {
+			return Geo{}, ErrInvalidGeo
+		}
+	}
+	return geo, nil
+}
+
+// valid checks the coordinates are in range
+func (p GeoPoint) valid() bool {
+	return p.Latitude >= -90 && p.Latitude <= 90 && p.Longitude >= -180 && p.Longitude <= 180
+}
+
+// parseCoords parses a comma separated list of exactly n numbers
+func parseCoords(text string, n int) ([]float64, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != n {
+		return nil, ErrInvalidGeo
+	}
+	coords := make([]float64, 0, n)
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, ErrInvalidGeo
+		}
+		coords = append(coords, v)
+	}
+	return coords, nil
+}
+
+// parseDistance parses a positive distance in m or km, meters by default
+func parseDistance(text string) (float64, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(text, "km"):
+		text, scale = strings.TrimSuffix(text, "km"), 1000
+	case strings.HasSuffix(text, "m"):
+		text = strings.TrimSuffix(text, "m")
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || v <= 0 {
+		return 0, ErrInvalidGeo
+	}
+	return v * scale, nil
+}
+
+// formatCoords formats coordinates the way parseCoords reads them
+func formatCoords(coords ...float64) string {
+	parts := make([]string, 0, len(coords))
+	for _, c := range coords {
+		parts = append(parts, strconv.FormatFloat(c, 'f', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
+
+// set adds the geo filter to url query values
+func (g Geo) set(query url.Values) {
+	if g.Near != nil {
+		query.Set("near", formatCoords(g.Near.Latitude, g.Near.Longitude))
+	}
+	if g.Radius > 0 {
+		query.Set("radius", fmt.Sprintf("%sm", strconv.FormatFloat(g.Radius, 'f', -1, 64)))
+	}
+	if g.BBox != nil {
+		query.Set("bbox", formatCoords(g.BBox.SouthWest.Longitude, g.BBox.SouthWest.Latitude, g.BBox.NorthEast.Longitude, g.BBox.NorthEast.Latitude))
+	}
+}
@@ -14,6 +14,7 @@ type Frontend interface {
 	Get(r *http.Request) (io.ReadCloser, error)
 	Post(r *http.Request) (io.ReadCloser, error)
 	Put(r *http.Request) error
+	Patch(r *http.Request) error
 	Delete(r *http.Request) error
 }
 
@@ -25,6 +26,10 @@ func NewHandler(crud Frontend) http.Handler {
 			err     error
 		)
 		defer exhaust(r.Body)
+		// Preconditions for optimistic concurrency
+		if tags := splitETags(r.Header.Get("If-Match")); len(tags) > 0 {
+			r = r.WithContext(WithIfMatch(r.Context(), tags))
+		}
 		switch r.Method {
 		case http.MethodGet:
 			result, err = crud.Get(r)
@@ -34,12 +39,24 @@ func NewHandler(crud Frontend) http.Handler {
 		case http.MethodPut:
 			err = crud.Put(r)
 			emptyOk = true
+		case http.MethodPatch:
+			err = crud.Patch(r)
+			emptyOk = true
 		case http.MethodDelete:
 			err = crud.Delete(r)
 			emptyOk = true
 		default:
 			err = ErrUnsupportedMethod
 		}
+		if tagged, ok := result.(Tagged); ok && err == nil {
+			etag := tagged.ETag()
+			w.Header().Set("ETag", etag)
+			if !noneMatch(r.Header.Get("If-None-Match"), etag) {
+				exhaust(result)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
 		query := r.URL.Query()
 		redirectOnError := query.Get("redirectOnError")
 		redirectOnSuccess := query.Get("redirectOnSuccess")
@@ -81,23 +98,30 @@ func NewHandler(crud Frontend) http.Handler {
 	return http.HandlerFunc(handler)
 }
 
+// Typed is implemented by replies that are not plain json
+type Typed interface {
+	ContentType() string
+}
+
 type queryError struct {
 	Error string `json:"error"`
 }
 
-// JsonError writes an error to the response
-func JsonError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
-	reply := queryError{Error: err.Error()}
+// ErrorStatus returns the http status code and message for the error
+func ErrorStatus(err error) (int, string) {
 	var knownError Error
 	if errors.As(err, &knownError) {
-		code, msg := knownError.HttpError()
-		reply.Error = msg
-		w.WriteHeader(code)
-	} else {
-		w.WriteHeader(http.StatusInternalServerError)
+		return knownError.HttpError()
 	}
-	json.NewEncoder(w).Encode(reply)
+	return http.StatusInternalServerError, err.Error()
+}
+
+// JsonError writes an error to the response
+func JsonError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	code, msg := ErrorStatus(err)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(queryError{Error: msg})
 }
 
 func jsonReply(resp io.ReadCloser, err error, w http.ResponseWriter, emptyOk bool) {
@@ -114,7 +138,11 @@ func jsonReply(resp io.ReadCloser, err error, w http.ResponseWriter, emptyOk boo
 		return
 	}
 	defer resp.Close()
-	w.Header().Set("Content-Type", "application/json")
+	contentType := "application/json"
+	if typed, ok := resp.(Typed); ok {
+		contentType = typed.ContentType()
+	}
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
 	if _, err := io.Copy(w, resp); err != nil {
 		log.Printf("Failed to deliver GET reply: %s", err.Error())
@@ -0,0 +1,246 @@
+package crud_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/warpcomdev/videoapi/internal/auth"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	"github.com/warpcomdev/videoapi/internal/models"
+	"github.com/warpcomdev/videoapi/internal/policy"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// newCameraHandler serves the cameras from an in-memory store,
+// with the policy applied to users of the given role.
+func newCameraHandler(t *testing.T, role models.Role) http.Handler {
+	return serveCameras(t, role, []models.Camera{
+		{Model: models.Model{ID: "cam1"}, Name: "North gate", Latitude: 40.1, Longitude: -3.1},
+		{Model: models.Model{ID: "cam2"}, Name: "north parking", Latitude: 40.2, Longitude: -3.2},
+		{Model: models.Model{ID: "cam3"}, Name: "South gate", Latitude: 40.3, Longitude: -3.3},
+	})
+}
+
+// serveCameras serves the given cameras from an in-memory store
+func serveCameras(t *testing.T, role models.Role, list []models.Camera) http.Handler {
+	t.Helper()
+	cameras := store.NewMemory[models.Camera](models.CameraDescriptor().FilterSet)
+	for _, camera := range list {
+		if _, err := cameras.Post(context.Background(), camera); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := crud.NewHandler(crud.FromResource(store.Adapt[models.Camera](policy.CameraPolicy{CameraStore: cameras})))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := auth.NewContext(r.Context(), auth.Claims{Role: role, Name: "test"})
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// listCameras returns the status and the ids of the cameras listed
+func listCameras(t *testing.T, handler http.Handler, query url.Values) (int, []string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil))
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var result struct {
+		Data []models.Camera `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(result.Data))
+	for _, camera := range result.Data {
+		ids = append(ids, camera.ID)
+	}
+	return w.Code, ids
+}
+
+func TestHandlerListFilters(t *testing.T) {
+	handler := newCameraHandler(t, models.ROLE_READ_ONLY)
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+		ids    []string
+	}{
+		{
+			name:   "sorted ascending",
+			query:  url.Values{"sort": {"name"}, "ascending": {"true"}},
+			status: http.StatusOK,
+			ids:    []string{"cam1", "cam3", "cam2"},
+		},
+		{
+			name:   "offset and limit",
+			query:  url.Values{"sort": {"id"}, "ascending": {"true"}, "offset": {"1"}, "limit": {"1"}},
+			status: http.StatusOK,
+			ids:    []string{"cam2"},
+		},
+		{
+			name:   "like is case sensitive",
+			query:  url.Values{"q-name-like": {"north%"}},
+			status: http.StatusOK,
+			ids:    []string{"cam2"},
+		},
+		{
+			name:   "ilike is not",
+			query:  url.Values{"q-name-ilike": {"north%"}, "sort": {"id"}, "ascending": {"true"}},
+			status: http.StatusOK,
+			ids:    []string{"cam1", "cam2"},
+		},
+		{
+			name:   "in list",
+			query:  url.Values{"q-id-in": {"cam1, cam3"}, "sort": {"id"}, "ascending": {"true"}},
+			status: http.StatusOK,
+			ids:    []string{"cam1", "cam3"},
+		},
+		{
+			name:   "inner or",
+			query:  url.Values{"q-id-eq": {"cam1", "cam3"}, "inner-op": {"or"}, "sort": {"id"}, "ascending": {"true"}},
+			status: http.StatusOK,
+			ids:    []string{"cam1", "cam3"},
+		},
+		{
+			name:   "outer or",
+			query:  url.Values{"q-latitude-lt": {"40.15"}, "q-latitude-gt": {"40.25"}, "outer-op": {"or"}, "sort": {"id"}, "ascending": {"true"}},
+			status: http.StatusOK,
+			ids:    []string{"cam1", "cam3"},
+		},
+		{
+			name:   "expression",
+			query:  url.Values{"filter": {"name ilike '%gate' and latitude gt 40.2"}},
+			status: http.StatusOK,
+			ids:    []string{"cam3"},
+		},
+		{
+			name:   "NULL",
+			query:  url.Values{"q-name-eq": {"NULL"}},
+			status: http.StatusOK,
+			ids:    []string{},
+		},
+		{
+			name:   "NULL with other operator",
+			query:  url.Values{"q-name-gt": {"NULL"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown filter column",
+			query:  url.Values{"q-foo-eq": {"1"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "negative offset",
+			query:  url.Values{"offset": {"-1"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown sort column",
+			query:  url.Values{"sort": {"foo"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "trash",
+			query:  url.Values{"include_deleted": {"true"}},
+			status: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, ids := listCameras(t, handler, test.query)
+			if status != test.status {
+				t.Fatalf("got status %d, want %d", status, test.status)
+			}
+			if strings.Join(ids, ",") != strings.Join(test.ids, ",") {
+				t.Errorf("got %v, want %v", ids, test.ids)
+			}
+		})
+	}
+}
+
+func TestHandlerCursorTwoColumns(t *testing.T) {
+	var list []models.Camera
+	for i, name := range []string{"b", "a", "b", "a", "b", "a", "b"} {
+		list = append(list, models.Camera{
+			Model:     models.Model{ID: fmt.Sprintf("cam%d", i)},
+			Name:      name,
+			Latitude:  float64(40 + i%3),
+			Longitude: -3,
+		})
+	}
+	handler := serveCameras(t, models.ROLE_READ_ONLY, list)
+	want := []string{"cam3", "cam1", "cam5", "cam0", "cam6", "cam4", "cam2"}
+	var got []string
+	next := "sort=name&sort=latitude&ascending=true&limit=2"
+	for pages := 0; next != "" && pages < 10; pages++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+next, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s got status %d: %s", next, w.Code, w.Body.String())
+		}
+		var result struct {
+			Data []models.Camera `json:"data"`
+			Next string          `json:"next"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		for _, camera := range result.Data {
+			got = append(got, camera.ID)
+		}
+		next = result.Next
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHandlerWriteRoles(t *testing.T) {
+	body := `{"id": "cam4", "name": "West gate", "latitude": 40.4, "longitude": -3.4}`
+	tests := []struct {
+		role   models.Role
+		status int
+	}{
+		{role: models.ROLE_READ_ONLY, status: http.StatusUnauthorized},
+		{role: models.ROLE_READ_WRITE, status: http.StatusUnauthorized},
+		{role: models.ROLE_ADMIN, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		handler := newCameraHandler(t, test.role)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != test.status {
+			t.Errorf("POST by %s got status %d, want %d", test.role, w.Code, test.status)
+		}
+	}
+}
+
+func TestHandlerIfMatch(t *testing.T) {
+	handler := newCameraHandler(t, models.ROLE_ADMIN)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cam1", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET got status %d and etag %q", w.Code, etag)
+	}
+	patch := func(etag string) int {
+		r := httptest.NewRequest(http.MethodPatch, "/cam1", strings.NewReader(`{"name": "Renamed"}`))
+		r.Header.Set("If-Match", etag)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	if status := patch(`"stale"`); status != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with stale etag got status %d, want %d", status, http.StatusPreconditionFailed)
+	}
+	if status := patch(etag); status != http.StatusOK && status != http.StatusNoContent {
+		t.Errorf("PATCH with current etag got status %d", status)
+	}
+}
@@ -0,0 +1,48 @@
+package crud
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Path of the history of a resource, relative to the resource id
+const HISTORY_PATH = "_history"
+
+// Path of the revert endpoint, relative to a version in the history
+const REVERT_PATH = "_revert"
+
+// Historian is implemented by resources that keep their previous versions
+type Historian interface {
+	// History returns the previous versions of the resource
+	History(ctx context.Context, id string) (io.ReadCloser, error)
+	// Revert the resource to the given version
+	Revert(ctx context.Context, id string, version string) error
+}
+
+// historyId returns the id in a path like `<id>/_history`, if it is one
+func historyId(path string) (string, bool) {
+	id, ok := strings.CutSuffix(strings.Trim(path, "/"), "/"+HISTORY_PATH)
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// revertId returns the id and version in a path like
+// `<id>/_history/<version>/_revert`, if it is one
+func revertId(path string) (string, string, bool) {
+	prefix, ok := strings.CutSuffix(strings.Trim(path, "/"), "/"+REVERT_PATH)
+	if !ok {
+		return "", "", false
+	}
+	sep := strings.LastIndex(prefix, "/"+HISTORY_PATH+"/")
+	if sep <= 0 {
+		return "", "", false
+	}
+	version := prefix[sep+len(HISTORY_PATH)+2:]
+	if version == "" || strings.Contains(version, "/") {
+		return "", "", false
+	}
+	return prefix[:sep], version, true
+}
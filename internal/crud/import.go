@@ -0,0 +1,150 @@
+package crud
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime"
+	"strings"
+)
+
+// Path of the import endpoint, relative to the resource
+const IMPORT_PATH = "_import"
+
+// Maximum number of rows in a single import
+const maxImportRows = 10000
+
+// ImportRow is a single resource read from the import source
+type ImportRow struct {
+	// Line of the csv file, or position of the json item, starting at 1
+	Line int
+	// Json object with the attributes of the resource, for json sources
+	Data []byte
+	// Text of each attribute, for csv sources
+	Values map[string]string
+}
+
+// ImportOptions change how rows are imported
+type ImportOptions struct {
+	// Validate and write the rows, but roll back the transaction
+	DryRun bool
+	// Update the resources that already exist, instead of failing
+	Upsert bool
+}
+
+// ImportResult is the outcome of importing a single row
+type ImportResult struct {
+	Line   int    `json:"line"`
+	ID     string `json:"id,omitempty"`
+	Op     BulkOp `json:"op,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportResponse is the outcome of an import
+type ImportResponse struct {
+	DryRun bool `json:"dry_run"`
+	// False if no row was written, either because some of them
+	// failed or because of the dry run.
+	Committed bool           `json:"committed"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Failed    int            `json:"failed"`
+	Results   []ImportResult `json:"results"`
+}
+
+// Importer is implemented by resources that can be created in bulk
+type Importer interface {
+	// Import validates all the rows, and then creates or updates
+	// the resources in a single transaction.
+	Import(ctx context.Context, rows []ImportRow, opts ImportOptions) (io.ReadCloser, error)
+}
+
+// ImportRows reads the rows from a csv file with a header line, or from
+// a json array or newline delimited json, depending on the media type.
+func ImportRows(r io.Reader, mediaType string) ([]ImportRow, error) {
+	var (
+		rows []ImportRow
+		err  error
+	)
+	switch mediaType {
+	case "text/csv":
+		rows, err = csvRows(r)
+	case "", "application/json", "application/x-ndjson", "application/ndjson":
+		rows, err = jsonRows(r)
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrEmptyBody
+	}
+	if len(rows) > maxImportRows {
+		return nil, ErrImportTooLarge
+	}
+	return rows, nil
+}
+
+// jsonRows reads the rows from json items
+func jsonRows(r io.Reader) ([]ImportRow, error) {
+	items, err := jsonItems(r, maxImportRows)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]ImportRow, 0, len(items))
+	for idx, item := range items {
+		rows = append(rows, ImportRow{Line: idx + 1, Data: item})
+	}
+	return rows, nil
+}
+
+// csvRows reads the rows from csv records. The first one must have
+// the names of the attributes. Empty values are skipped.
+func csvRows(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrEmptyBody
+	}
+	if err != nil {
+		return nil, ErrInvalidImport
+	}
+	for idx, name := range header {
+		header[idx] = strings.ToLower(strings.TrimSpace(name))
+	}
+	var rows []ImportRow
+	for len(rows) <= maxImportRows {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidImport
+		}
+		line, _ := reader.FieldPos(0)
+		row := ImportRow{Line: line, Values: make(map[string]string, len(record))}
+		for idx, value := range record {
+			if value != "" {
+				row.Values[header[idx]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// importMediaType checks the content type of an import request
+func importMediaType(contentType string) (string, error) {
+	if contentType == "" {
+		return "", nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ErrUnsupportedMediaType
+	}
+	return mediaType, nil
+}
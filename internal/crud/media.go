@@ -14,50 +14,139 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// Path of the tag summary endpoint, relative to the resource
+const TAGS_PATH = "_tags"
+
+// TagCounter is implemented by resources with tags
+type TagCounter interface {
+	// Tags counts the resources with each tag, per camera
+	Tags(ctx context.Context, query Query) (io.ReadCloser, error)
+}
+
+// Transcoder converts media files to a format the browsers can play,
+// in the background. The media_url is updated when complete.
+type Transcoder interface {
+	// Transcode schedules the conversion of the file of the media,
+	// if its content type needs it. Previous conversions are discarded.
+	Transcode(ctx context.Context, id, mediaURL, contentType string) error
+}
+
+// Thumbnailer makes reduced versions of the media files, so that
+// clients can show them without downloading the whole file.
+type Thumbnailer interface {
+	// Thumbnails makes a still thumbnail and an animated preview of
+	// the file, next to it. Returns the paths of the files made,
+	// empty for those not supported or failed.
+	Thumbnails(ctx context.Context, srcPath string) (thumbnail, preview string, err error)
+}
+
 type MediaFrontend struct {
-	nested      ResourceFrontend
-	unpoliced   Resource
-	tmpFolder   string
-	finalFolder string
-	mimeTypes   map[string]string
-	ffmpegPath  string
+	nested    ResourceFrontend
+	unpoliced Resource
+	tmpFolder string
+	blobs     BlobStore
+	// Deleted media files are moved here, if not nil
+	trash     BlobStore
+	mimeTypes map[string]string
+	// Optional, converts the uploaded files
+	transcoder Transcoder
+	// Optional, makes thumbnails of the uploaded files
+	thumbnailer Thumbnailer
+	// Optional, makes thumbnails after replying to the upload
+	background *thumbnailQueue
+	uploads    *uploadLocks
 }
 
-// FromMedia creates a new MediaFrontend
-func FromMedia(r Resource, unpoliced Resource, tmpFolder, finalFolder string, mimeTypes map[string]string, ffmpegPath string) MediaFrontend {
+// FromMedia creates a new MediaFrontend. If trash is not nil, the
+// files of deleted media are kept there until purged, instead of removed.
+func FromMedia(r Resource, unpoliced Resource, tmpFolder string, blobs, trash BlobStore, mimeTypes map[string]string) MediaFrontend {
 	for _, ext := range mimeTypes {
 		if !strings.HasPrefix(ext, ".") {
 			panic("mimetype extensions must begin with `.`")
 		}
 	}
 	return MediaFrontend{
-		nested:      FromResource(r),
-		unpoliced:   unpoliced,
-		tmpFolder:   tmpFolder,
-		finalFolder: finalFolder,
-		mimeTypes:   mimeTypes,
-		ffmpegPath:  ffmpegPath,
+		nested:    FromResource(r),
+		unpoliced: unpoliced,
+		tmpFolder: tmpFolder,
+		blobs:     blobs,
+		trash:     trash,
+		mimeTypes: mimeTypes,
+		uploads:   &uploadLocks{},
 	}
 }
 
-// MediaFolder returns the root media folder
-func (h MediaFrontend) MediaFolder() string {
-	return h.finalFolder
+// WithTranscoder returns a copy of the frontend that
+// transcodes the files after they are uploaded
+func (h MediaFrontend) WithTranscoder(t Transcoder) MediaFrontend {
+	h.transcoder = t
+	return h
+}
+
+// WithThumbnailer returns a copy of the frontend that
+// makes thumbnails of the files when they are uploaded
+func (h MediaFrontend) WithThumbnailer(t Thumbnailer) MediaFrontend {
+	h.thumbnailer = t
+	return h
+}
+
+// WithBackgroundThumbnailer returns a copy of the frontend that makes
+// thumbnails of the files in the background, after they are uploaded.
+// For thumbnailers too slow to run inside the request.
+func (h MediaFrontend) WithBackgroundThumbnailer(t Thumbnailer) MediaFrontend {
+	h.background = newThumbnailQueue(t)
+	return h
+}
+
+// Blobs returns the store of the media files
+func (h MediaFrontend) Blobs() BlobStore {
+	return h.blobs
 }
 
 // Get handler
 func (h MediaFrontend) Get(r *http.Request) (io.ReadCloser, error) {
+	if strings.Trim(r.URL.Path, "/") == TAGS_PATH {
+		return h.tags(r)
+	}
+	if id, ok := uploadId(r.URL.Path); ok {
+		return h.getUpload(r, id)
+	}
 	return h.nested.Get(r)
 }
 
+// tags handler, for GET requests to TAGS_PATH.
+// Supports the same filters as the list request.
+func (h MediaFrontend) tags(r *http.Request) (io.ReadCloser, error) {
+	counter, ok := h.nested.resource.(TagCounter)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	query, err := queryFrom(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	return counter.Tags(r.Context(), query)
+}
+
 type mediaResponse struct {
-	ID       string `json:"id"`
-	MediaURL string `json:"media_url"`
+	ID           string `json:"id"`
+	MediaURL     string `json:"media_url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	PreviewURL   string `json:"preview_url,omitempty"`
+}
+
+// mediaFiles are the paths of the files of an upload, before they
+// are moved to the blob store, or their keys after. Thumbnail and
+// preview are empty if missing.
+type mediaFiles struct {
+	media     string
+	thumbnail string
+	preview   string
 }
 
 // Post handler
@@ -69,17 +158,28 @@ func (h MediaFrontend) Post(r *http.Request) (io.ReadCloser, error) {
 	if id == "" {
 		return h.nested.Post(r)
 	}
+	if id == BULK_PATH {
+		return h.bulk(r)
+	}
+	if id, ok := restoreId(id); ok {
+		return nil, h.restore(r, id)
+	}
+	if id, ok := uploadId(id); ok {
+		return h.createUpload(r, id)
+	}
+	if id, ok := commitId(id); ok {
+		return h.commitUpload(r, id)
+	}
 	mr, err := r.MultipartReader()
 	if err != nil {
 		return nil, err
 	}
 	requestParams := make(map[string]string)
-	requestParams["id"] = id
-	idFolder := idFolder(id)
 	escapeId := escapeId(id)
 	var (
-		fileExt string
-		tmpPath string
+		fileExt  string
+		fileType string
+		tmpPath  string
 	)
 	// We must clean "tmpPath" variable if upload succeeds
 	defer func() {
@@ -87,7 +187,7 @@ func (h MediaFrontend) Post(r *http.Request) (io.ReadCloser, error) {
 			os.Remove(tmpPath)
 		}
 	}()
-	// This closure will update tmpPath and fileExt above
+	// This closure will update tmpPath, fileExt and fileType above
 	processPart := func(p *multipart.Part) error {
 		defer exhaust(p)
 		formName := p.FormName()
@@ -118,6 +218,7 @@ func (h MediaFrontend) Post(r *http.Request) (io.ReadCloser, error) {
 			if err != nil {
 				return err
 			}
+			fileType = contentType
 			tmpPath, err = saveTmpFile(h.tmpFolder, escapeId, p)
 			if err != nil {
 				return err
@@ -141,49 +242,82 @@ func (h MediaFrontend) Post(r *http.Request) (io.ReadCloser, error) {
 	if tmpPath == "" {
 		return nil, ErrMultipartNoFile
 	}
-	// Try to transcode AVI files, so that they can be played in the browser
-	if h.ffmpegPath != "" && strings.HasSuffix(strings.ToLower(fileExt), ".avi") {
-		transcode := func() {
-			// try to convert to mp4 using ffmpeg
-			// this is a best effort, so we ignore errors
-			// and just keep the original file
-			outPath := strings.TrimSuffix(tmpPath, fileExt) + ".mp4"
-			// See https://superuser.com/questions/710008/how-to-get-rid-of-ffmpeg-pts-has-no-value-error
-			// for an explanation of -fflags
-			// See also https://stackoverflow.com/questions/39426006/after-video-codec-copy-to-mp4-format-with-ffmpeg-new-video-has-no-screen-and-has
-			// for an explanation of transcoding
-			cmd := exec.CommandContext(r.Context(), h.ffmpegPath, "-fflags", "+genpts", "-i", tmpPath, "-c:v", "libx264", "-pix_fmt", "yuv420p", "-preset", "medium", "-movflags", "+faststart", "-y", outPath)
-			if err := cmd.Run(); err != nil {
-				log.Printf("ffmpeg failed: %v", err)
-				return
-			}
-			log.Printf("ffmpeg transcoded %s to %s", tmpPath, outPath)
-			// ffmpeg succeeded, so we can delete the original file
-			os.Remove(tmpPath)
-			// and update tmpPath and fileExt
-			tmpPath = outPath
-			fileExt = ".mp4"
+	result, err := h.finish(r.Context(), id, fileExt, fileType, tmpPath, requestParams)
+	if err != nil {
+		return nil, err
+	}
+	// The file has been moved to the blob store
+	tmpPath = ""
+	return result, nil
+}
+
+// finish makes the thumbnails, moves the uploaded files to the blob
+// store, saves the meta file and schedules transcoding. Returns the id,
+// media_url and thumbnail urls of the media. Thumbnails made in the
+// background are not in the response, nor in the media until complete.
+func (h MediaFrontend) finish(ctx context.Context, id, fileExt, fileType, tmpPath string, requestParams map[string]string) (io.ReadCloser, error) {
+	idFolder := idFolder(id)
+	escapeId := escapeId(id)
+	files := mediaFiles{media: tmpPath}
+	// Thumbnails are made from the original, before transcoding
+	var thumbnailSrc string
+	if h.background != nil {
+		var err error
+		if thumbnailSrc, err = thumbnailSource(tmpPath); err != nil {
+			log.Printf("failed to keep media %s for its thumbnails: %v", id, err)
+		} else {
+			h.background.claim(id, thumbnailSrc)
 		}
-		transcode()
 	}
-	mediaURL, err := h.commitTmpFile(r.Context(), id, idFolder, escapeId, fileExt, tmpPath)
+	if h.thumbnailer != nil {
+		var err error
+		files.thumbnail, files.preview, err = h.thumbnailer.Thumbnails(ctx, tmpPath)
+		if err != nil {
+			log.Printf("failed to make thumbnails of media %s: %v", id, err)
+		}
+		defer func() {
+			for _, path := range []string{files.thumbnail, files.preview} {
+				if path != "" {
+					os.Remove(path)
+				}
+			}
+		}()
+	}
+	keys, err := h.commitTmpFiles(ctx, id, idFolder, escapeId, fileExt, files)
 	if err != nil {
+		os.Remove(tmpPath)
+		if thumbnailSrc != "" {
+			h.background.release(id, thumbnailSrc)
+			os.Remove(thumbnailSrc)
+		}
 		return nil, err
 	}
+	if thumbnailSrc != "" {
+		h.thumbnailLater(id, thumbnailSrc)
+	}
+	mediaURL := keys.media
 	// Best effort: write a "meta" file for each upload, with the request parameters
+	requestParams["id"] = id
 	requestParams["media_url"] = mediaURL
-	metaFile := h.metaFile(idFolder, escapeId)
-	if meta, err := os.Create(metaFile); err == nil {
-		enc := json.NewEncoder(meta)
-		enc.SetEscapeHTML(false)
-		enc.SetIndent("", "  ")
-		enc.Encode(requestParams)
-		meta.Close()
-	}
-	// Return the id and media_url to whomever is interested
+	var meta bytes.Buffer
+	enc := json.NewEncoder(&meta)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(requestParams); err == nil {
+		h.blobs.Put(ctx, h.metaKey(idFolder, escapeId), &meta, int64(meta.Len()))
+	}
+	// The file is served as uploaded until the transcoded one is ready
+	if h.transcoder != nil {
+		if err := h.transcoder.Transcode(ctx, id, mediaURL, fileType); err != nil {
+			log.Printf("failed to schedule transcoding of media %s: %v", id, err)
+		}
+	}
+	// Return the id and urls to whomever is interested
 	response := mediaResponse{
-		ID:       id,
-		MediaURL: mediaURL,
+		ID:           id,
+		MediaURL:     mediaURL,
+		ThumbnailURL: keys.thumbnail,
+		PreviewURL:   keys.preview,
 	}
 	result, err := json.Marshal(response)
 	if err != nil {
@@ -192,38 +326,103 @@ func (h MediaFrontend) Post(r *http.Request) (io.ReadCloser, error) {
 	return io.NopCloser(bytes.NewReader(result)), nil
 }
 
+// bulk handler. Also removes the files of the deleted media.
+func (h MediaFrontend) bulk(r *http.Request) (io.ReadCloser, error) {
+	result, err := h.nested.Post(r)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	var response BulkResponse
+	if err := json.NewDecoder(result).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Committed {
+		for _, item := range response.Results {
+			if item.Op == BULK_DELETE && item.Status == http.StatusNoContent {
+				if err := h.discardFiles(r.Context(), item.ID); err != nil {
+					log.Printf("failed to remove files of media %s: %v", item.ID, err)
+				}
+			}
+		}
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
 // Put handler
 func (h MediaFrontend) Put(r *http.Request) error {
 	return h.nested.Put(r)
 }
 
+// Patch handler
+func (h MediaFrontend) Patch(r *http.Request) error {
+	if id, ok := uploadId(r.URL.Path); ok {
+		return h.appendUpload(r, id)
+	}
+	return h.nested.Patch(r)
+}
+
 // Delete handler
 func (h MediaFrontend) Delete(r *http.Request) error {
 	id := strings.Trim(r.URL.Path, "/")
 	if id == "" {
 		return ErrMissingResourceId
 	}
-	escapeId := escapeId(id)
-	idFolder := idFolder(id)
+	if id, ok := uploadId(id); ok {
+		return h.cancelUpload(r, id)
+	}
 	if r.URL.Query().Get("mediaOnly") == "true" {
-		// delete only media files
-		err := h.removePrevFiles(idFolder, escapeId)
-		if err != nil {
-			os.Remove(h.metaFile(idFolder, escapeId))
-		}
-		return err
+		// delete only media files, including the meta file
+		return h.removePrevFiles(r.Context(), idFolder(id), escapeId(id))
 	}
 	err := h.unpoliced.Delete(r.Context(), id)
 	if err == nil {
 		// Remove prev files only if we deleted the resource
-		err = h.removePrevFiles(idFolder, escapeId)
-		if err != nil {
-			os.Remove(h.metaFile(idFolder, escapeId))
-		}
+		err = h.discardFiles(r.Context(), id)
 	}
 	return err
 }
 
+// discardFiles moves the files of a deleted media to the trash,
+// or removes them if there is no trash.
+func (h MediaFrontend) discardFiles(ctx context.Context, id string) error {
+	if h.trash != nil {
+		return moveBlobs(ctx, h.blobs, h.trash, filesPrefix(idFolder(id), escapeId(id)))
+	}
+	return h.removePrevFiles(ctx, idFolder(id), escapeId(id))
+}
+
+// restore handler. Moves the files back from the trash.
+func (h MediaFrontend) restore(r *http.Request, id string) error {
+	if err := h.nested.restore(r, id); err != nil {
+		return err
+	}
+	if h.trash == nil {
+		return nil
+	}
+	return moveBlobs(r.Context(), h.trash, h.blobs, filesPrefix(idFolder(id), escapeId(id)))
+}
+
+// Purge removes for good the media deleted before the given time,
+// and their files in the trash.
+func (h MediaFrontend) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	trash, ok := h.unpoliced.(Trash)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	purged, err := trash.Purge(ctx, before)
+	if h.trash != nil {
+		for _, id := range purged {
+			err = errors.Join(err, removeBlobs(ctx, h.trash, filesPrefix(idFolder(id), escapeId(id))))
+		}
+	}
+	return purged, err
+}
+
 func (h MediaFrontend) checkMimeType(contentType string) (string, error) {
 	for mediaType, ext := range h.mimeTypes {
 		if strings.HasPrefix(contentType, mediaType) {
@@ -233,67 +432,73 @@ func (h MediaFrontend) checkMimeType(contentType string) (string, error) {
 	return "", ErrMimeNotSupported
 }
 
-// saveFile saves the input stream as a file
-func (h MediaFrontend) commitTmpFile(ctx context.Context, id, idFolder, escapeId, ext, tmpPath string) (mediaURL string, err error) {
-	// make storage folder
-	if err = os.MkdirAll(idFolder, 0755); err != nil {
-		return "", err
-	}
+// commitTmpFiles moves the uploaded file and its thumbnails to the
+// blob store, and returns their keys. Thumbnails are best effort,
+// their keys are empty if they could not be saved.
+func (h MediaFrontend) commitTmpFiles(ctx context.Context, id, idFolder, escapeId, ext string, files mediaFiles) (keys mediaFiles, err error) {
 	// Find existing files
-	var matches []string
-	matches, err = h.prevFiles(idFolder, escapeId)
+	var prevKeys []string
+	prevKeys, err = h.prevFiles(ctx, idFolder, escapeId)
 	if err != nil {
-		return "", err
+		return keys, err
 	}
-	// rename previous files
-	renamed := make(map[string]string)
+	// move to final location. Notice: `ext` already includes the dot.
+	finalName := fmt.Sprintf("%s%s", escapeId, ext)
+	keys.media = strings.Join([]string{idFolder, finalName}, "/")
+	if err = PutFile(ctx, h.blobs, keys.media, files.media); err != nil {
+		return keys, err
+	}
+	keys.thumbnail = h.putThumbnail(ctx, id, idFolder, escapeId, "thumb", files.thumbnail)
+	keys.preview = h.putThumbnail(ctx, id, idFolder, escapeId, "preview", files.preview)
+	newKeys := []string{keys.media, keys.thumbnail, keys.preview}
 	defer func() {
 		if err == nil {
-			// remove old files
-			for _, newName := range renamed {
-				os.Remove(newName)
+			// remove old files, but the ones just replaced
+			for _, key := range prevKeys {
+				if !contains(newKeys, key) {
+					h.blobs.Delete(ctx, key)
+				}
 			}
 		} else {
-			// try to restore prev files
-			for oldName, newName := range renamed {
-				os.Rename(newName, oldName)
+			// remove new files, but the ones still referenced
+			for _, key := range newKeys {
+				if key != "" && !contains(prevKeys, key) {
+					h.blobs.Delete(ctx, key)
+				}
 			}
 		}
 	}()
-	for _, match := range matches {
-		newName := match + ".old"
-		if err = os.Rename(match, match+".old"); err != nil {
-			return "", err
-		}
-		renamed[match] = newName
-	}
-	// make sure the final folder exists
-	if err = os.MkdirAll(filepath.Join(h.finalFolder, idFolder), 0755); err != nil {
-		return "", err
-	}
-	// move to final location. Notice: `ext` already includes the dot.
-	finalName := fmt.Sprintf("%s%s", escapeId, ext)
-	finalPath := filepath.Join(h.finalFolder, idFolder, finalName)
-	if err = os.Rename(tmpPath, finalPath); err != nil {
-		return "", err
-	}
-	defer func() {
-		if err != nil {
-			os.Remove(finalPath)
-		}
-	}()
-	// Update resource's `mediaURL` attrib with the new file
-	mediaURL = strings.Join([]string{idFolder, finalName}, "/")
-	params := map[string]string{
-		"media_url": mediaURL,
+	// Update resource's urls with the new files
+	params := map[string]interface{}{
+		"media_url":     keys.media,
+		"thumbnail_url": nullable(keys.thumbnail),
+		"preview_url":   nullable(keys.preview),
 	}
 	var data []byte
 	data, err = json.Marshal(params)
 	if err != nil {
-		return "", err
+		return keys, err
 	}
 	err = h.unpoliced.Put(ctx, id, bytes.NewReader(data))
-	return mediaURL, err
+	return keys, err
+}
+
+// nullable turns empty strings into json nulls
+func nullable(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// contains is true if the list has the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
 }
 
 // idFolder builds path from ID and extension
@@ -308,10 +513,20 @@ func escapeId(id string) string {
 	return base64.URLEncoding.EncodeToString([]byte(id))
 }
 
-// prevFiles finds any prevoius files associated to this id
-func (h MediaFrontend) prevFiles(idFolder, escapeId string) ([]string, error) {
-	idGlob := fmt.Sprintf("%s.*", escapeId)
-	return filepath.Glob(filepath.Join(h.finalFolder, idFolder, idGlob))
+// filesPrefix is the prefix of the keys of all the files associated to an id.
+// Escaped ids never contain dots, so the prefix is unique.
+func filesPrefix(idFolder, escapeId string) string {
+	return fmt.Sprintf("%s/%s.", idFolder, escapeId)
+}
+
+// prevFiles finds the keys of any previous files associated to this id
+func (h MediaFrontend) prevFiles(ctx context.Context, idFolder, escapeId string) ([]string, error) {
+	var keys []string
+	err := h.blobs.List(ctx, filesPrefix(idFolder, escapeId), func(info BlobInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	return keys, err
 }
 
 // saveFile saves the input stream as a file
@@ -336,18 +551,11 @@ func saveTmpFile(tmpFolder, escapeId string, p io.ReadCloser) (tmpPath string, e
 	return tmpPath, nil
 }
 
-func (h MediaFrontend) metaFile(idFolder, escapeId string) string {
-	return filepath.Join(h.finalFolder, idFolder, fmt.Sprintf("%s.meta", escapeId))
+func (h MediaFrontend) metaKey(idFolder, escapeId string) string {
+	return fmt.Sprintf("%s/%s.meta", idFolder, escapeId)
 }
 
 // remove files associated to this id
-func (h MediaFrontend) removePrevFiles(idFolder, escapeId string) error {
-	matches, err := h.prevFiles(idFolder, escapeId)
-	if err != nil {
-		return err
-	}
-	for _, match := range matches {
-		err = errors.Join(os.Remove(match))
-	}
-	return err
+func (h MediaFrontend) removePrevFiles(ctx context.Context, idFolder, escapeId string) error {
+	return removeBlobs(ctx, h.blobs, filesPrefix(idFolder, escapeId))
 }
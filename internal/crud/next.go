@@ -4,44 +4,76 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
-// Next build Next URL for filtering
-func Next(filters []Filter, outerOp OuterOperation, innerOp InnerOperation, sort []string, ascending bool, offset, limit int) string {
-	return navigate(filters, outerOp, innerOp, sort, ascending, offset+limit, limit)
+// Next build Next URL for filtering.
+// If cursor is not nil, the URL seeks past it instead of using offset.
+func Next(query Query, cursor *Cursor) (string, error) {
+	query.Cursor = cursor
+	if cursor == nil {
+		query.Offset += query.Limit
+	}
+	return navigate(query)
 }
 
-// Next build Next URL for filtering
-func Prev(filters []Filter, outerOp OuterOperation, innerOp InnerOperation, sort []string, ascending bool, offset, limit int) string {
-	offset -= limit
-	if offset < 0 {
-		offset = 0
+// Prev build Prev URL for filtering.
+// If cursor is not nil, the URL seeks before it instead of using offset.
+func Prev(query Query, cursor *Cursor) (string, error) {
+	query.Cursor = cursor
+	if cursor == nil {
+		query.Offset -= query.Limit
+		if query.Offset < 0 {
+			query.Offset = 0
+		}
 	}
-	return navigate(filters, outerOp, innerOp, sort, ascending, offset, limit)
+	return navigate(query)
 }
 
 // Next build Next URL for filtering
-func navigate(filters []Filter, outerOp OuterOperation, innerOp InnerOperation, sort []string, ascending bool, offset, limit int) string {
+func navigate(q Query) (string, error) {
 	query := make(url.Values)
-	query.Set("offset", strconv.Itoa(offset))
-	query.Set("limit", strconv.Itoa(limit))
-	if outerOp != OUTER_DEFAULT {
-		query.Set("outer-op", string(outerOp))
+	if q.Cursor != nil {
+		token, err := q.Cursor.Encode()
+		if err != nil {
+			return "", err
+		}
+		query.Set("cursor", token)
+	} else {
+		query.Set("offset", strconv.Itoa(q.Offset))
 	}
-	if innerOp != INNER_DEFAULT {
-		query.Set("inner-op", string(innerOp))
+	query.Set("limit", strconv.Itoa(q.Limit))
+	if q.OuterOp != OUTER_DEFAULT {
+		query.Set("outer-op", string(q.OuterOp))
 	}
-	if ascending {
-		query.Set("asc", "true")
+	if q.InnerOp != INNER_DEFAULT {
+		query.Set("inner-op", string(q.InnerOp))
 	}
-	for _, col := range sort {
+	if q.Ascending {
+		query.Set("ascending", "true")
+	}
+	for _, col := range q.Sort {
 		query.Add("sort", col)
 	}
-	for _, filter := range filters {
+	if len(q.Fields) > 0 {
+		query.Set("fields", strings.Join(q.Fields, ","))
+	}
+	if q.Expr != nil {
+		query.Set("filter", q.Expr.String())
+	}
+	q.Geo.set(query)
+	// The trash is selected by path, not by query parameter
+	if q.Deleted == DELETED_INCLUDE {
+		query.Set("include_deleted", "true")
+	}
+	if q.Format != "" {
+		query.Set("format", string(q.Format))
+	}
+	for _, filter := range q.Filter {
 		key := fmt.Sprintf("q-%s-%s", filter.Field, filter.Operator)
 		for _, val := range filter.Values {
 			query.Add(key, val)
 		}
 	}
-	return query.Encode()
+	return query.Encode(), nil
 }
@@ -3,13 +3,24 @@ package crud
 type Operator string
 
 const (
-	OP_EQ   Operator = "eq"
-	OP_NE   Operator = "ne"
-	OP_GT   Operator = "gt"
-	OP_GE   Operator = "ge"
-	OP_LT   Operator = "lt"
-	OP_LE   Operator = "le"
-	OP_LIKE Operator = "like"
+	OP_EQ         Operator = "eq"
+	OP_NE         Operator = "ne"
+	OP_GT         Operator = "gt"
+	OP_GE         Operator = "ge"
+	OP_LT         Operator = "lt"
+	OP_LE         Operator = "le"
+	OP_LIKE       Operator = "like"
+	OP_ILIKE      Operator = "ilike"
+	OP_STARTSWITH Operator = "startswith"
+	// List operators, values are comma separated in q- parameters
+	OP_IN      Operator = "in"
+	OP_NIN     Operator = "nin"
+	OP_BETWEEN Operator = "between"
+	// Only for lists: contains all of the values
+	OP_ALL Operator = "all"
+	// Unary operators, values are ignored
+	OP_ISNULL  Operator = "isnull"
+	OP_NOTNULL Operator = "notnull"
 )
 
 func (op Operator) Valid() bool {
@@ -28,6 +39,32 @@ func (op Operator) Valid() bool {
 		return true
 	case OP_LIKE:
 		return true
+	case OP_ILIKE:
+		return true
+	case OP_STARTSWITH:
+		return true
+	case OP_IN:
+		return true
+	case OP_NIN:
+		return true
+	case OP_BETWEEN:
+		return true
+	case OP_ALL:
+		return true
+	case OP_ISNULL:
+		return true
+	case OP_NOTNULL:
+		return true
 	}
 	return false
 }
+
+// List operators take several values
+func (op Operator) List() bool {
+	return op == OP_IN || op == OP_NIN || op == OP_BETWEEN || op == OP_ALL
+}
+
+// Unary operators do not need any value
+func (op Operator) Unary() bool {
+	return op == OP_ISNULL || op == OP_NOTNULL
+}
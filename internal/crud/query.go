@@ -0,0 +1,170 @@
+package crud
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of the list response
+type Format string
+
+const (
+	FORMAT_JSON Format = "json"
+	// GeoJSON FeatureCollection, for resources with a position
+	FORMAT_GEOJSON Format = "geojson"
+	// Streaming formats, with all the matching resources and no pagination
+	FORMAT_CSV    Format = "csv"
+	FORMAT_NDJSON Format = "ndjson"
+)
+
+// Streamed is true for formats exported without pagination
+func (f Format) Streamed() bool {
+	return f == FORMAT_CSV || f == FORMAT_NDJSON
+}
+
+// Query collects the parameters of a list request
+type Query struct {
+	Filter  []Filter
+	OuterOp OuterOperation
+	InnerOp InnerOperation
+	// Optional filter expression, combined with Filter using AND
+	Expr      *Expr
+	Sort      []string
+	Ascending bool
+	Offset    int
+	Limit     int
+	// If not nil, seek past the cursor instead of skipping Offset rows
+	Cursor *Cursor
+	// Attributes to return, all of them if empty
+	Fields []string
+	// Filter by position, and distances to compute
+	Geo Geo
+	// Format of the response, FORMAT_JSON if empty
+	Format Format
+	// Soft deleted resources to return, none by default
+	Deleted Deleted
+}
+
+// HasFilter is true if the query has any filter, expression or geo filter
+func (q Query) HasFilter() bool {
+	return len(q.Filter) > 0 || q.Expr != nil || q.Geo.HasFilter()
+}
+
+// SortKey returns the columns to sort by. The id is always
+// appended as a tie breaker, so that the order is total.
+func (q Query) SortKey() []string {
+	key := make([]string, 0, len(q.Sort)+1)
+	for _, col := range q.Sort {
+		key = append(key, col)
+		if strings.EqualFold(col, "id") {
+			return key
+		}
+	}
+	return append(key, "id")
+}
+
+// Cursor is a position in a sorted list, for keyset pagination
+type Cursor struct {
+	// Values of the sort key columns at the position
+	Values []driver.Value
+	// Seek rows before the position, instead of after
+	Backward bool
+}
+
+// Wire format of the cursor values. Values are kept as strings
+// with explicit type, so they can be bound without loss.
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v,omitempty"`
+}
+
+type cursorToken struct {
+	Values   []cursorValue `json:"k"`
+	Backward bool          `json:"b,omitempty"`
+}
+
+// Encode the cursor as an opaque, url-safe token
+func (c Cursor) Encode() (string, error) {
+	token := cursorToken{
+		Values:   make([]cursorValue, 0, len(c.Values)),
+		Backward: c.Backward,
+	}
+	for _, v := range c.Values {
+		var cv cursorValue
+		switch v := v.(type) {
+		case nil:
+			cv = cursorValue{Type: "n"}
+		case string:
+			cv = cursorValue{Type: "s", Value: v}
+		case int64:
+			cv = cursorValue{Type: "i", Value: strconv.FormatInt(v, 10)}
+		case float64:
+			cv = cursorValue{Type: "f", Value: strconv.FormatFloat(v, 'g', -1, 64)}
+		case bool:
+			cv = cursorValue{Type: "b", Value: strconv.FormatBool(v)}
+		case time.Time:
+			cv = cursorValue{Type: "t", Value: v.Format(time.RFC3339Nano)}
+		case []byte:
+			cv = cursorValue{Type: "s", Value: string(v)}
+		default:
+			return "", fmt.Errorf("unsupported cursor value type %T", v)
+		}
+		token.Values = append(token.Values, cv)
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor parses a token generated by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if len(token.Values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &Cursor{
+		Values:   make([]driver.Value, 0, len(token.Values)),
+		Backward: token.Backward,
+	}
+	for _, cv := range token.Values {
+		var (
+			v   driver.Value
+			err error
+		)
+		switch cv.Type {
+		case "n":
+			v = nil
+		case "s":
+			v = cv.Value
+		case "i":
+			v, err = strconv.ParseInt(cv.Value, 10, 64)
+		case "f":
+			v, err = strconv.ParseFloat(cv.Value, 64)
+		case "b":
+			v, err = strconv.ParseBool(cv.Value)
+		case "t":
+			v, err = time.Parse(time.RFC3339Nano, cv.Value)
+		default:
+			err = ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		cursor.Values = append(cursor.Values, v)
+	}
+	return cursor, nil
+}
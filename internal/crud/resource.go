@@ -4,7 +4,9 @@ import (
 	"context"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -28,14 +30,19 @@ const (
 
 // Resource implements the CRUD operations
 type Resource interface {
-	// Get resource by id
-	GetById(context.Context, string) (io.ReadCloser, error)
+	// Get resource by id, only the given fields if any
+	GetById(ctx context.Context, id string, fields []string) (io.ReadCloser, error)
 	// Get resource by filter
-	Get(ctx context.Context, filter []Filter, outerOp OuterOperation, innerOp InnerOperation, sort []string, ascending bool, offset, limit int, count bool) (io.ReadCloser, error)
+	Get(ctx context.Context, query Query, count bool) (io.ReadCloser, error)
 	// Post (create) new resource
 	Post(context.Context, io.Reader) (io.ReadCloser, error)
 	// Put (update) resource
 	Put(context.Context, string, io.Reader) error
+	// Patch (merge) resource
+	Patch(context.Context, string, io.Reader) error
+	// Bulk runs several operations in a single transaction.
+	// If atomic, any failure rolls back all the operations.
+	Bulk(ctx context.Context, ops []BulkOperation, atomic bool) (io.ReadCloser, error)
 	// Delete resource by id
 	Delete(context.Context, string) error
 }
@@ -60,24 +67,82 @@ func exhaust(r io.ReadCloser) {
 }
 
 func (h ResourceFrontend) Get(r *http.Request) (io.ReadCloser, error) {
+	params := r.URL.Query()
+	fields, err := fieldsFrom(params["fields"])
+	if err != nil {
+		return nil, err
+	}
 	id := strings.Trim(r.URL.Path, "/")
-	if id != "" {
+	if id == STATS_PATH {
+		return h.stats(r)
+	}
+	if id, ok := historyId(id); ok {
+		return h.history(r, id)
+	}
+	if id != "" && id != TRASH_PATH {
 		// Get single entry
-		return h.resource.GetById(r.Context(), id)
+		return h.resource.GetById(r.Context(), id, fields)
 	}
 	// Get paginated entry
+	query, err := queryFrom(params)
+	if err != nil {
+		return nil, err
+	}
+	if id == TRASH_PATH {
+		query.Deleted = DELETED_ONLY
+	}
+	query.Fields = fields
+	if query.Format == "" {
+		query.Format = acceptFormat(r.Header.Get("Accept"))
+	}
+	if query.Format.Streamed() {
+		return h.export(r, query)
+	}
+	count := params.Get("count") == "true"
+	return h.resource.Get(r.Context(), query, count)
+}
+
+// export handler, for list requests in a streaming format
+func (h ResourceFrontend) export(r *http.Request, query Query) (io.ReadCloser, error) {
+	exporter, ok := h.resource.(Exporter)
+	if !ok {
+		return nil, ErrInvalidFormat
+	}
+	return exporter.Export(r.Context(), query)
+}
+
+// stats handler, for GET requests to STATS_PATH.
+// Supports the same filters as the list request.
+func (h ResourceFrontend) stats(r *http.Request) (io.ReadCloser, error) {
+	aggregator, ok := h.resource.(Aggregator)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	params := r.URL.Query()
+	query, err := queryFrom(params)
+	if err != nil {
+		return nil, err
+	}
+	agg, err := aggregationFrom(params)
+	if err != nil {
+		return nil, err
+	}
+	return aggregator.Stats(r.Context(), query, agg)
+}
+
+// queryFrom builds the query for a list request from url query values
+func queryFrom(params url.Values) (Query, error) {
 	var (
 		filter    []Filter
 		sort      []string
 		ascending bool
 		offset    int
 		limit     int
-		count     bool
+		cursor    *Cursor
 		innerOp   InnerOperation
 		outerOp   OuterOperation
 		err       error
 	)
-	params := r.URL.Query()
 	if asc := params.Get("ascending"); asc != "" {
 		switch strings.ToLower(asc) {
 		case "t":
@@ -92,21 +157,25 @@ func (h ResourceFrontend) Get(r *http.Request) (io.ReadCloser, error) {
 	}
 	if off := params.Get("offset"); off != "" {
 		intOff, err := strconv.Atoi(off)
-		if err != nil {
-			return nil, err
+		if err != nil || intOff < 0 {
+			return Query{}, ErrInvalidOffset
 		}
 		offset = intOff
 	}
+	if cur := params.Get("cursor"); cur != "" {
+		cursor, err = DecodeCursor(cur)
+		if err != nil {
+			return Query{}, err
+		}
+		offset = 0
+	}
 	if lim := params.Get("limit"); lim != "" {
 		intLim, err := strconv.Atoi(lim)
 		if err != nil {
-			return nil, err
+			return Query{}, err
 		}
 		limit = intLim
 	}
-	if cnt := params.Get("count"); cnt == "true" {
-		count = true
-	}
 	io := strings.ToUpper(params.Get("inner-op"))
 	switch InnerOperation(io) {
 	case INNER_AND:
@@ -134,7 +203,7 @@ func (h ResourceFrontend) Get(r *http.Request) (io.ReadCloser, error) {
 			sort = merge(v)
 			for _, s := range sort {
 				if !isColumnName(s) {
-					return nil, ErrInvalidColumn
+					return Query{}, ErrInvalidColumn
 				}
 			}
 		}
@@ -148,9 +217,53 @@ func (h ResourceFrontend) Get(r *http.Request) (io.ReadCloser, error) {
 	}
 	filter, err = filtersFrom(other)
 	if err != nil {
-		return nil, err
+		return Query{}, err
+	}
+	var expr *Expr
+	if text := params.Get("filter"); text != "" {
+		if expr, err = ParseExpr(text); err != nil {
+			return Query{}, err
+		}
+	}
+	geo, err := geoFrom(params)
+	if err != nil {
+		return Query{}, err
+	}
+	if geo.Near == nil {
+		for _, s := range sort {
+			if strings.EqualFold(s, DISTANCE) {
+				return Query{}, ErrInvalidGeo
+			}
+		}
+	}
+	format := Format(strings.ToLower(params.Get("format")))
+	switch format {
+	case "", FORMAT_JSON, FORMAT_GEOJSON, FORMAT_CSV, FORMAT_NDJSON:
+	default:
+		return Query{}, ErrInvalidFormat
 	}
-	return h.resource.Get(r.Context(), filter, outerOp, innerOp, sort, ascending, offset, limit, count)
+	var deleted Deleted
+	if strings.ToLower(params.Get("include_deleted")) == "true" {
+		deleted = DELETED_INCLUDE
+	}
+	query := Query{
+		Filter:    filter,
+		OuterOp:   outerOp,
+		InnerOp:   innerOp,
+		Expr:      expr,
+		Sort:      sort,
+		Ascending: ascending,
+		Offset:    offset,
+		Limit:     limit,
+		Cursor:    cursor,
+		Geo:       geo,
+		Format:    format,
+		Deleted:   deleted,
+	}
+	if cursor != nil && len(cursor.Values) != len(query.SortKey()) {
+		return Query{}, ErrInvalidCursor
+	}
+	return query, nil
 }
 
 // Post handler
@@ -158,9 +271,80 @@ func (h ResourceFrontend) Post(r *http.Request) (io.ReadCloser, error) {
 	if r.Body == nil {
 		return nil, ErrEmptyBody
 	}
+	switch strings.Trim(r.URL.Path, "/") {
+	case BULK_PATH:
+		return h.bulk(r)
+	case IMPORT_PATH:
+		return h.importRows(r)
+	}
+	if id, ok := restoreId(r.URL.Path); ok {
+		return nil, h.restore(r, id)
+	}
+	if id, version, ok := revertId(r.URL.Path); ok {
+		return nil, h.revert(r, id, version)
+	}
 	return h.resource.Post(r.Context(), r.Body)
 }
 
+// history handler, for GET requests to <id>/HISTORY_PATH
+func (h ResourceFrontend) history(r *http.Request, id string) (io.ReadCloser, error) {
+	historian, ok := h.resource.(Historian)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return historian.History(r.Context(), id)
+}
+
+// revert handler, for POST requests to <id>/HISTORY_PATH/<version>/REVERT_PATH
+func (h ResourceFrontend) revert(r *http.Request, id, version string) error {
+	historian, ok := h.resource.(Historian)
+	if !ok {
+		return ErrNotFound
+	}
+	return historian.Revert(r.Context(), id, version)
+}
+
+// restore handler, for POST requests to <id>/RESTORE_PATH
+func (h ResourceFrontend) restore(r *http.Request, id string) error {
+	trash, ok := h.resource.(Trash)
+	if !ok {
+		return ErrNotFound
+	}
+	return trash.Restore(r.Context(), id)
+}
+
+// importRows handler, for POST requests to IMPORT_PATH
+func (h ResourceFrontend) importRows(r *http.Request) (io.ReadCloser, error) {
+	importer, ok := h.resource.(Importer)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	mediaType, err := importMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ImportRows(r.Body, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	params := r.URL.Query()
+	opts := ImportOptions{
+		DryRun: strings.ToLower(params.Get("dry_run")) == "true",
+		Upsert: strings.ToLower(params.Get("upsert")) == "true",
+	}
+	return importer.Import(r.Context(), rows, opts)
+}
+
+// bulk handler, for POST requests to BULK_PATH
+func (h ResourceFrontend) bulk(r *http.Request) (io.ReadCloser, error) {
+	ops, err := bulkOperations(r)
+	if err != nil {
+		return nil, err
+	}
+	atomic := strings.ToLower(r.URL.Query().Get("atomic")) == "true"
+	return h.resource.Bulk(r.Context(), ops, atomic)
+}
+
 // Put handler
 func (h ResourceFrontend) Put(r *http.Request) error {
 	id := strings.Trim(r.URL.Path, "/")
@@ -173,6 +357,24 @@ func (h ResourceFrontend) Put(r *http.Request) error {
 	return h.resource.Put(r.Context(), id, r.Body)
 }
 
+// Patch handler, expects a json merge patch
+func (h ResourceFrontend) Patch(r *http.Request) error {
+	id := strings.Trim(r.URL.Path, "/")
+	if id == "" {
+		return ErrMissingResourceId
+	}
+	if r.Body == nil {
+		return ErrEmptyBody
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			return ErrUnsupportedMediaType
+		}
+	}
+	return h.resource.Patch(r.Context(), id, r.Body)
+}
+
 // Delete handler
 func (h ResourceFrontend) Delete(r *http.Request) error {
 	id := strings.Trim(r.URL.Path, "/")
@@ -0,0 +1,77 @@
+package crud
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Path of the stats endpoint, relative to the resource
+const STATS_PATH = "_stats"
+
+// Bucket is the size of the time intervals to count resources in
+type Bucket string
+
+const (
+	BUCKET_NONE Bucket = ""
+	BUCKET_HOUR Bucket = "hour"
+	BUCKET_DAY  Bucket = "day"
+	BUCKET_WEEK Bucket = "week"
+)
+
+// Valid checks the bucket is supported
+func (b Bucket) Valid() bool {
+	switch b {
+	case BUCKET_NONE, BUCKET_HOUR, BUCKET_DAY, BUCKET_WEEK:
+		return true
+	}
+	return false
+}
+
+// Attributes that counts can be grouped by
+const (
+	GROUP_CAMERA   = "camera"
+	GROUP_SEVERITY = "severity"
+	// Groups by each of the tags of the resource
+	GROUP_TAG = "tag"
+)
+
+// Aggregation describes how to group the resources to count them
+type Aggregation struct {
+	GroupBy []string
+	Bucket  Bucket
+}
+
+// Aggregator is implemented by resources that can be counted in groups
+type Aggregator interface {
+	// Stats counts the resources matching the query, per group and bucket
+	Stats(ctx context.Context, query Query, agg Aggregation) (io.ReadCloser, error)
+}
+
+// aggregationFrom builds the aggregation from url query values
+func aggregationFrom(params url.Values) (Aggregation, error) {
+	var agg Aggregation
+	seen := make(map[string]struct{})
+	for _, v := range params["group_by"] {
+		for _, group := range strings.Split(v, ",") {
+			group = strings.ToLower(strings.TrimSpace(group))
+			switch group {
+			case "":
+				continue
+			case GROUP_CAMERA, GROUP_SEVERITY, GROUP_TAG:
+			default:
+				return Aggregation{}, ErrInvalidAggregation
+			}
+			if _, ok := seen[group]; !ok {
+				seen[group] = struct{}{}
+				agg.GroupBy = append(agg.GroupBy, group)
+			}
+		}
+	}
+	agg.Bucket = Bucket(strings.ToLower(params.Get("bucket")))
+	if !agg.Bucket.Valid() {
+		return Aggregation{}, ErrInvalidAggregation
+	}
+	return agg, nil
+}
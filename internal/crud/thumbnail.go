@@ -0,0 +1,174 @@
+package crud
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Thumbnails made at once in the background
+const thumbnailWorkers = 2
+
+// thumbnailQueue makes the thumbnails of the uploads after replying,
+// for thumbnailers too slow to run inside the request, e.g. ffmpeg.
+// Jobs are kept in memory, the ones pending are lost on restart.
+type thumbnailQueue struct {
+	thumbnailer Thumbnailer
+	slots       chan struct{}
+	// Source of the latest job of each media, older ones are discarded
+	mutex  sync.Mutex
+	latest map[string]string
+}
+
+func newThumbnailQueue(t Thumbnailer) *thumbnailQueue {
+	return &thumbnailQueue{
+		thumbnailer: t,
+		slots:       make(chan struct{}, thumbnailWorkers),
+		latest:      make(map[string]string),
+	}
+}
+
+// thumbnailSource links the uploaded file to another name, so that the
+// background job can read it after it is moved to the blob store.
+// Copies the file if it can not be linked.
+func thumbnailSource(tmpPath string) (srcPath string, err error) {
+	file, err := os.CreateTemp(filepath.Dir(tmpPath), filepath.Base(tmpPath)+".*.src")
+	if err != nil {
+		return "", err
+	}
+	srcPath = file.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(srcPath)
+		}
+	}()
+	file.Close()
+	if err := os.Remove(srcPath); err != nil {
+		return "", err
+	}
+	if err := os.Link(tmpPath, srcPath); err == nil {
+		return srcPath, nil
+	}
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.Create(srcPath)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return srcPath, err
+}
+
+// claim makes the job of srcPath the latest of the media,
+// so that any previous one is discarded
+func (q *thumbnailQueue) claim(id, srcPath string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.latest[id] = srcPath
+}
+
+// release forgets the job, if it is the latest of the media
+func (q *thumbnailQueue) release(id, srcPath string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.latest[id] == srcPath {
+		delete(q.latest, id)
+	}
+}
+
+// thumbnailLater makes the thumbnails of the media from srcPath, in the
+// background. The job must have been claimed before the files of the media
+// were replaced. srcPath is removed when done.
+func (h MediaFrontend) thumbnailLater(id, srcPath string) {
+	queue := h.background
+	go func() {
+		defer os.Remove(srcPath)
+		defer queue.release(id, srcPath)
+		queue.slots <- struct{}{}
+		defer func() { <-queue.slots }()
+		// Not bound to the request, the client is already gone
+		if err := h.thumbnailJob(context.Background(), id, srcPath); err != nil {
+			log.Printf("failed to make thumbnails of media %s: %v", id, err)
+		}
+	}()
+}
+
+// thumbnailJob makes the thumbnails, saves them in the blob
+// store and updates the urls of the media
+func (h MediaFrontend) thumbnailJob(ctx context.Context, id, srcPath string) error {
+	queue := h.background
+	files := mediaFiles{}
+	var err error
+	files.thumbnail, files.preview, err = queue.thumbnailer.Thumbnails(ctx, srcPath)
+	defer func() {
+		for _, path := range []string{files.thumbnail, files.preview} {
+			if path != "" {
+				os.Remove(path)
+			}
+		}
+	}()
+	if files.thumbnail == "" && files.preview == "" {
+		return err
+	}
+	if err != nil {
+		log.Printf("failed to make some thumbnails of media %s: %v", id, err)
+	}
+	// Uploads of the media claim their job before replacing
+	// its files, so they wait until these are saved.
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	if queue.latest[id] != srcPath {
+		return nil
+	}
+	idFolder, escapeId := idFolder(id), escapeId(id)
+	keys := mediaFiles{
+		thumbnail: h.putThumbnail(ctx, id, idFolder, escapeId, "thumb", files.thumbnail),
+		preview:   h.putThumbnail(ctx, id, idFolder, escapeId, "preview", files.preview),
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"thumbnail_url": nullable(keys.thumbnail),
+		"preview_url":   nullable(keys.preview),
+	})
+	if err != nil {
+		return err
+	}
+	err = h.unpoliced.Put(ctx, id, bytes.NewReader(data))
+	if errors.Is(err, ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		// Deleted meanwhile, its other files are already in the trash
+		for _, key := range []string{keys.thumbnail, keys.preview} {
+			if key != "" {
+				h.blobs.Delete(ctx, key)
+			}
+		}
+		return nil
+	}
+	return err
+}
+
+// putThumbnail moves the thumbnail to the blob store, and returns its
+// key. Returns "" if there is no thumbnail or it could not be saved.
+func (h MediaFrontend) putThumbnail(ctx context.Context, id, idFolder, escapeId, kind, tmpPath string) string {
+	if tmpPath == "" {
+		return ""
+	}
+	key := fmt.Sprintf("%s%s%s", filesPrefix(idFolder, escapeId), kind, filepath.Ext(tmpPath))
+	if err := PutFile(ctx, h.blobs, key, tmpPath); err != nil {
+		log.Printf("failed to save %s of media %s: %v", kind, id, err)
+		return ""
+	}
+	return key
+}
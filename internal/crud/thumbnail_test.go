@@ -0,0 +1,158 @@
+package crud
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeThumbnailer writes both thumbnails next to the source
+type fakeThumbnailer struct{}
+
+func (fakeThumbnailer) Thumbnails(ctx context.Context, srcPath string) (string, string, error) {
+	thumb, preview := srcPath+".thumb.jpg", srcPath+".preview.gif"
+	for _, path := range []string{thumb, preview} {
+		if err := os.WriteFile(path, []byte(path), 0o644); err != nil {
+			return "", "", err
+		}
+	}
+	return thumb, preview, nil
+}
+
+// fakeBlobs keeps the keys of the blobs put
+type fakeBlobs struct {
+	BlobStore
+	keys map[string]bool
+}
+
+func (b *fakeBlobs) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	b.keys[key] = true
+	return nil
+}
+
+func (b *fakeBlobs) Delete(ctx context.Context, key string) error {
+	delete(b.keys, key)
+	return nil
+}
+
+func (b *fakeBlobs) sorted() string {
+	keys := make([]string, 0, len(b.keys))
+	for key := range b.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// fakeMedia records the attributes put, fails if missing
+type fakeMedia struct {
+	Resource
+	missing bool
+	puts    []map[string]interface{}
+}
+
+func (m *fakeMedia) Put(ctx context.Context, id string, r io.Reader) error {
+	if m.missing {
+		return ErrNotFound
+	}
+	attrs := make(map[string]interface{})
+	if err := json.NewDecoder(r).Decode(&attrs); err != nil {
+		return err
+	}
+	m.puts = append(m.puts, attrs)
+	return nil
+}
+
+func newThumbnailFrontend(t *testing.T, missing bool) (MediaFrontend, *fakeBlobs, *fakeMedia, string) {
+	t.Helper()
+	srcPath := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(srcPath, []byte("video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blobs := &fakeBlobs{keys: make(map[string]bool)}
+	media := &fakeMedia{missing: missing}
+	h := MediaFrontend{unpoliced: media, blobs: blobs}.WithBackgroundThumbnailer(fakeThumbnailer{})
+	return h, blobs, media, srcPath
+}
+
+func TestThumbnailJob(t *testing.T) {
+	h, blobs, media, srcPath := newThumbnailFrontend(t, false)
+	h.background.claim("cam1", srcPath)
+	if err := h.thumbnailJob(context.Background(), "cam1", srcPath); err != nil {
+		t.Fatal(err)
+	}
+	prefix := filesPrefix(idFolder("cam1"), escapeId("cam1"))
+	want := prefix + "preview.gif," + prefix + "thumb.jpg"
+	if got := blobs.sorted(); got != want {
+		t.Errorf("got blobs %s, want %s", got, want)
+	}
+	if len(media.puts) != 1 {
+		t.Fatalf("got %d puts, want 1", len(media.puts))
+	}
+	if got := media.puts[0]["thumbnail_url"]; got != prefix+"thumb.jpg" {
+		t.Errorf("got thumbnail_url %v", got)
+	}
+	if got := media.puts[0]["preview_url"]; got != prefix+"preview.gif" {
+		t.Errorf("got preview_url %v", got)
+	}
+	for _, path := range []string{srcPath + ".thumb.jpg", srcPath + ".preview.gif"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", path)
+		}
+	}
+}
+
+func TestThumbnailJobStale(t *testing.T) {
+	h, blobs, media, srcPath := newThumbnailFrontend(t, false)
+	// Uploaded again before the job ran
+	h.background.claim("cam1", srcPath)
+	h.background.claim("cam1", srcPath+".newer")
+	if err := h.thumbnailJob(context.Background(), "cam1", srcPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs.keys) != 0 || len(media.puts) != 0 {
+		t.Errorf("stale job saved blobs %s and %d puts", blobs.sorted(), len(media.puts))
+	}
+	h.background.release("cam1", srcPath)
+	if h.background.latest["cam1"] != srcPath+".newer" {
+		t.Errorf("stale job released the newer one")
+	}
+}
+
+func TestThumbnailJobDeleted(t *testing.T) {
+	h, blobs, _, srcPath := newThumbnailFrontend(t, true)
+	h.background.claim("cam1", srcPath)
+	if err := h.thumbnailJob(context.Background(), "cam1", srcPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs.keys) != 0 {
+		t.Errorf("thumbnails of deleted media kept: %s", blobs.sorted())
+	}
+}
+
+func TestThumbnailSource(t *testing.T) {
+	tmpPath := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(tmpPath, []byte("video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srcPath, err := thumbnailSource(tmpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The source must survive the upload being moved away
+	if err := os.Remove(tmpPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "video" {
+		t.Errorf("got %q, want %q", data, "video")
+	}
+}
@@ -0,0 +1,43 @@
+package crud
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Path of the trash listing, relative to the resource
+const TRASH_PATH = "_trash"
+
+// Path of the restore endpoint, relative to the resource id
+const RESTORE_PATH = "_restore"
+
+// Deleted selects resources by their soft delete status
+type Deleted string
+
+const (
+	// Only resources that are not deleted, the default
+	DELETED_EXCLUDE Deleted = ""
+	// Both deleted and not deleted resources
+	DELETED_INCLUDE Deleted = "include"
+	// Only deleted resources, the trash
+	DELETED_ONLY Deleted = "only"
+)
+
+// Trash is implemented by resources that are soft deleted
+type Trash interface {
+	// Restore a deleted resource
+	Restore(ctx context.Context, id string) error
+	// Purge removes for good the resources deleted before the given time.
+	// Returns the ids of the purged resources.
+	Purge(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// restoreId returns the id in a path like `<id>/_restore`, if it is one
+func restoreId(path string) (string, bool) {
+	id, ok := strings.CutSuffix(strings.Trim(path, "/"), "/"+RESTORE_PATH)
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
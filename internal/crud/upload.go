@@ -0,0 +1,333 @@
+package crud
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Path of the resumable upload endpoint, relative to the media
+const UPLOAD_PATH = "upload"
+
+// Path to commit a complete upload, relative to the upload
+const COMMIT_PATH = "_commit"
+
+// Content type of the chunks sent with PATCH
+const CHUNK_CONTENT_TYPE = "application/offset+octet-stream"
+
+// Folder for the uploads in progress, inside tmpFolder
+const uploadsFolder = "uploads"
+
+// uploadRequest creates a resumable upload
+type uploadRequest struct {
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	// Saved in the meta file, like multipart form fields
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// uploadState is saved next to the partial file,
+// so that uploads can resume after a restart.
+type uploadState struct {
+	uploadRequest
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// uploadStatus is the reply to upload requests.
+// Offset is the number of bytes received so far.
+type uploadStatus struct {
+	ID          string    `json:"id"`
+	Size        int64     `json:"size"`
+	Offset      int64     `json:"offset"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// uploadLocks keeps requests from using the same upload at once
+type uploadLocks struct {
+	locks sync.Map
+}
+
+// lock the upload, or fail with ErrUploadBusy
+func (l *uploadLocks) lock(name string) (func(), error) {
+	value, _ := l.locks.LoadOrStore(name, &sync.Mutex{})
+	mutex := value.(*sync.Mutex)
+	if !mutex.TryLock() {
+		return nil, ErrUploadBusy
+	}
+	return mutex.Unlock, nil
+}
+
+// uploadId returns the id in a path like `<id>/upload`, if it is one
+func uploadId(path string) (string, bool) {
+	id, ok := strings.CutSuffix(strings.Trim(path, "/"), "/"+UPLOAD_PATH)
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// commitId returns the id in a path like `<id>/upload/_commit`, if it is one
+func commitId(path string) (string, bool) {
+	prefix, ok := strings.CutSuffix(strings.Trim(path, "/"), "/"+COMMIT_PATH)
+	if !ok {
+		return "", false
+	}
+	return uploadId(prefix)
+}
+
+// uploadPaths returns the paths of the state and the partial file
+func (h MediaFrontend) uploadPaths(id string) (statePath, partPath string) {
+	base := filepath.Join(h.tmpFolder, uploadsFolder, escapeId(id))
+	return base + ".json", base + ".part"
+}
+
+// loadUpload reads the state of the upload, and the size of the partial file
+func (h MediaFrontend) loadUpload(id string) (uploadState, int64, error) {
+	statePath, partPath := h.uploadPaths(id)
+	var state uploadState
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return state, 0, ErrNotFound
+		}
+		return state, 0, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, 0, err
+	}
+	stat, err := os.Stat(partPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return state, 0, ErrNotFound
+		}
+		return state, 0, err
+	}
+	return state, stat.Size(), nil
+}
+
+// uploadReply builds the status of the upload
+func uploadReply(state uploadState, offset int64) (io.ReadCloser, error) {
+	data, err := json.Marshal(uploadStatus{
+		ID:          state.ID,
+		Size:        state.Size,
+		Offset:      offset,
+		ContentType: state.ContentType,
+		CreatedAt:   state.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// checkMedia verifies the media exists and the user can see it
+func (h MediaFrontend) checkMedia(ctx context.Context, id string) error {
+	found, err := h.nested.resource.GetById(ctx, id, nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	found.Close()
+	return nil
+}
+
+// createUpload handler, for POST requests to UPLOAD_PATH. If there is an
+// upload in progress with the same size and type, it is kept so that
+// the client can resume it. Otherwise, the upload starts over.
+func (h MediaFrontend) createUpload(r *http.Request, id string) (io.ReadCloser, error) {
+	var request uploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, ErrInvalidUpload
+	}
+	if request.Size <= 0 {
+		return nil, ErrInvalidUpload
+	}
+	if _, err := h.checkMimeType(request.ContentType); err != nil {
+		return nil, ErrInvalidUpload
+	}
+	if err := h.checkMedia(r.Context(), id); err != nil {
+		return nil, err
+	}
+	unlock, err := h.uploads.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if state, offset, err := h.loadUpload(id); err == nil {
+		if state.Size == request.Size && state.ContentType == request.ContentType {
+			return uploadReply(state, offset)
+		}
+	}
+	state := uploadState{
+		uploadRequest: request,
+		ID:            id,
+		CreatedAt:     time.Now(),
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	statePath, partPath := h.uploadPaths(id)
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(partPath, nil, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(statePath, data, 0644); err != nil {
+		return nil, err
+	}
+	return uploadReply(state, 0)
+}
+
+// getUpload handler, for GET requests to UPLOAD_PATH
+func (h MediaFrontend) getUpload(r *http.Request, id string) (io.ReadCloser, error) {
+	state, offset, err := h.loadUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	return uploadReply(state, offset)
+}
+
+// appendUpload handler, for PATCH requests to UPLOAD_PATH. The chunk is
+// appended at the Upload-Offset, which must be the size received so far.
+// If the connection drops, the bytes received are kept.
+func (h MediaFrontend) appendUpload(r *http.Request, id string) error {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), CHUNK_CONTENT_TYPE) {
+		return ErrUnsupportedMediaType
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return ErrUploadOffset
+	}
+	unlock, err := h.uploads.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	state, size, err := h.loadUpload(id)
+	if err != nil {
+		return err
+	}
+	if offset != size {
+		return ErrUploadOffset
+	}
+	_, partPath := h.uploadPaths(id)
+	part, err := os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	written, err := io.Copy(part, io.LimitReader(r.Body, state.Size-offset))
+	if err != nil {
+		return err
+	}
+	// Anything beyond the size of the upload is rejected
+	if n, _ := r.Body.Read(make([]byte, 1)); n > 0 {
+		part.Truncate(offset)
+		return ErrUploadTooLarge
+	}
+	if written == 0 && offset < state.Size {
+		return ErrEmptyBody
+	}
+	return nil
+}
+
+// commitUpload handler, for POST requests to COMMIT_PATH. The complete
+// file is processed like a multipart upload, and the upload removed.
+func (h MediaFrontend) commitUpload(r *http.Request, id string) (io.ReadCloser, error) {
+	if err := h.checkMedia(r.Context(), id); err != nil {
+		return nil, err
+	}
+	unlock, err := h.uploads.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	state, offset, err := h.loadUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != state.Size {
+		return nil, ErrUploadIncomplete
+	}
+	fileExt, err := h.checkMimeType(state.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	// The upload is consumed by the commit, even if it fails
+	statePath, partPath := h.uploadPaths(id)
+	tmpPath := strings.TrimSuffix(partPath, ".part") + fileExt
+	if err := os.Rename(partPath, tmpPath); err != nil {
+		return nil, err
+	}
+	os.Remove(statePath)
+	params := make(map[string]string)
+	for k, v := range state.Params {
+		params[k] = v
+	}
+	return h.finish(r.Context(), id, fileExt, state.ContentType, tmpPath, params)
+}
+
+// cancelUpload handler, for DELETE requests to UPLOAD_PATH
+func (h MediaFrontend) cancelUpload(r *http.Request, id string) error {
+	unlock, err := h.uploads.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, _, err := h.loadUpload(id); err != nil {
+		return err
+	}
+	statePath, partPath := h.uploadPaths(id)
+	return errors.Join(os.Remove(partPath), os.Remove(statePath))
+}
+
+// PurgeUploads removes the uploads created before the given
+// time and not completed. Returns the ids of the removed uploads.
+func (h MediaFrontend) PurgeUploads(before time.Time) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(h.tmpFolder, uploadsFolder, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var purged []string
+	for _, statePath := range matches {
+		data, readErr := os.ReadFile(statePath)
+		if readErr != nil {
+			err = errors.Join(err, readErr)
+			continue
+		}
+		var state uploadState
+		if json.Unmarshal(data, &state) != nil || state.CreatedAt.After(before) {
+			continue
+		}
+		unlock, lockErr := h.uploads.lock(state.ID)
+		if lockErr != nil {
+			continue
+		}
+		_, partPath := h.uploadPaths(state.ID)
+		os.Remove(partPath)
+		if removeErr := os.Remove(statePath); removeErr != nil {
+			err = errors.Join(err, removeErr)
+		} else {
+			purged = append(purged, state.ID)
+		}
+		unlock()
+	}
+	return purged, err
+}
@@ -0,0 +1,268 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// Name of the table that keeps track of applied steps
+const versionTable = "SCHEMA_VERSION"
+
+// ErrSchemaBehind is returned by Check when there are pending steps
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// Step is a single, versioned change to the schema
+type Step struct {
+	Version     int
+	Description string
+	// Up and Down statements, for each dialect.
+	// Statements are run one by one, in order.
+	Up   map[string][]string
+	Down map[string][]string
+}
+
+// Migrator applies steps to a database
+type Migrator struct {
+	db      *sqlx.DB
+	dialect store.Dialect
+	steps   []Step
+}
+
+// New creates a Migrator for the given steps. Steps must be
+// sorted by version, starting at 1 and without gaps.
+func New(db *sqlx.DB, dialect store.Dialect, steps []Step) (Migrator, error) {
+	for idx, step := range steps {
+		if step.Version != idx+1 {
+			return Migrator{}, fmt.Errorf("migration step %d has version %d", idx+1, step.Version)
+		}
+		if _, ok := step.Up[dialect.Name]; !ok {
+			return Migrator{}, fmt.Errorf("migration step %d has no up statements for dialect %s", step.Version, dialect.Name)
+		}
+		if _, ok := step.Down[dialect.Name]; !ok {
+			return Migrator{}, fmt.Errorf("migration step %d has no down statements for dialect %s", step.Version, dialect.Name)
+		}
+	}
+	return Migrator{
+		db:      db,
+		dialect: dialect,
+		steps:   steps,
+	}, nil
+}
+
+// Latest version known to this migrator
+func (m Migrator) Latest() int {
+	return len(m.steps)
+}
+
+// Current version of the database schema, 0 if no step has been applied
+func (m Migrator) Current(ctx context.Context) (int, error) {
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return 0, err
+	}
+	return m.current(ctx)
+}
+
+func (m Migrator) current(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	query := fmt.Sprintf("SELECT MAX(VERSION) FROM %s", versionTable)
+	if err := m.db.GetContext(ctx, &version, query); err != nil {
+		return 0, store.QueryError{
+			Message: "failed to read schema version",
+			Query:   query,
+			Cause:   err,
+		}
+	}
+	return int(version.Int64), nil
+}
+
+// Check returns ErrSchemaBehind if there are steps pending
+func (m Migrator) Check(ctx context.Context) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current < m.Latest() {
+		return fmt.Errorf("%w: version %d, expected %d", ErrSchemaBehind, current, m.Latest())
+	}
+	if current > m.Latest() {
+		log.Printf("database schema version %d is newer than expected %d", current, m.Latest())
+	}
+	return nil
+}
+
+// Up applies all pending steps up to the target version (inclusive).
+// A target of 0 means the latest version.
+func (m Migrator) Up(ctx context.Context, target int) error {
+	if target <= 0 {
+		target = m.Latest()
+	}
+	if target > m.Latest() {
+		return fmt.Errorf("unknown schema version %d", target)
+	}
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	// Nothing pending. Databases migrated by newer releases
+	// are left as they are, Check reports them.
+	if current >= target {
+		return nil
+	}
+	for _, step := range m.steps[current:target] {
+		if err := m.apply(ctx, step.Up[m.dialect.Name], func(tx *sqlx.Tx) error {
+			return m.insertVersion(ctx, tx, step)
+		}); err != nil {
+			return fmt.Errorf("failed to apply step %d (%s): %w", step.Version, step.Description, err)
+		}
+		log.Printf("applied schema step %d: %s", step.Version, step.Description)
+	}
+	return nil
+}
+
+// Down reverts all steps above the target version
+func (m Migrator) Down(ctx context.Context, target int) error {
+	if target < 0 {
+		return fmt.Errorf("unknown schema version %d", target)
+	}
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("cannot revert unknown schema version %d", current)
+	}
+	for version := current; version > target; version-- {
+		step := m.steps[version-1]
+		if err := m.apply(ctx, step.Down[m.dialect.Name], func(tx *sqlx.Tx) error {
+			return m.deleteVersion(ctx, tx, step)
+		}); err != nil {
+			return fmt.Errorf("failed to revert step %d (%s): %w", step.Version, step.Description, err)
+		}
+		log.Printf("reverted schema step %d: %s", step.Version, step.Description)
+	}
+	return nil
+}
+
+// Baseline marks all steps up to version as applied, without running them.
+// Used to adopt databases created before versioned migrations existed.
+func (m Migrator) Baseline(ctx context.Context, version int) error {
+	if version <= 0 || version > m.Latest() {
+		return fmt.Errorf("unknown schema version %d", version)
+	}
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if current >= version {
+		return fmt.Errorf("schema version %d is already at or above %d", current, version)
+	}
+	for _, step := range m.steps[current:version] {
+		if err := m.apply(ctx, nil, func(tx *sqlx.Tx) error {
+			return m.insertVersion(ctx, tx, step)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply runs the statements and the version update in a transaction.
+// Beware oracle commits implicitly after each DDL statement.
+func (m Migrator) apply(ctx context.Context, statements []string, version func(*sqlx.Tx) error) error {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return store.QueryError{
+				Message: "failed to run migration",
+				Query:   statement,
+				Cause:   err,
+			}
+		}
+	}
+	if err := version(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m Migrator) insertVersion(ctx context.Context, tx *sqlx.Tx, step Step) error {
+	query := fmt.Sprintf("INSERT INTO %s (VERSION, DESCRIPTION, APPLIED_AT) VALUES (?, ?, ?)", versionTable)
+	params := []any{step.Version, step.Description, time.Now()}
+	if _, err := tx.ExecContext(ctx, m.dialect.Rebind(query), m.dialect.BindArgs(params)...); err != nil {
+		return store.QueryError{
+			Message: "failed to update schema version",
+			Query:   query,
+			Params:  params,
+			Cause:   err,
+		}
+	}
+	return nil
+}
+
+func (m Migrator) deleteVersion(ctx context.Context, tx *sqlx.Tx, step Step) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE VERSION=?", versionTable)
+	if _, err := tx.ExecContext(ctx, m.dialect.Rebind(query), step.Version); err != nil {
+		return store.QueryError{
+			Message: "failed to update schema version",
+			Query:   query,
+			Params:  step.Version,
+			Cause:   err,
+		}
+	}
+	return nil
+}
+
+// Version table DDL for each dialect
+var versionTableCreate = map[string]string{
+	store.ORACLE: `
+	(
+		VERSION NUMBER(10) NOT NULL PRIMARY KEY,
+		DESCRIPTION VARCHAR2(256) NOT NULL,
+		APPLIED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL
+	)`,
+	store.POSTGRES: `
+	(
+		VERSION INTEGER NOT NULL PRIMARY KEY,
+		DESCRIPTION VARCHAR(256) NOT NULL,
+		APPLIED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL
+	)`,
+	store.SQLITE: `
+	(
+		VERSION INTEGER NOT NULL PRIMARY KEY,
+		DESCRIPTION VARCHAR(256) NOT NULL,
+		APPLIED_AT TIMESTAMP NOT NULL
+	)`,
+}
+
+// ensureVersionTable creates the version table, if it does not exist yet.
+// Not every database supports "IF NOT EXISTS", so we probe it first.
+func (m Migrator) ensureVersionTable(ctx context.Context) error {
+	if _, err := m.current(ctx); err == nil {
+		return nil
+	}
+	create, ok := versionTableCreate[m.dialect.Name]
+	if !ok {
+		return fmt.Errorf("no DDL for table %s in dialect %s", versionTable, m.dialect.Name)
+	}
+	query := fmt.Sprintf("CREATE TABLE %s %s", versionTable, create)
+	if _, err := m.db.ExecContext(ctx, query); err != nil {
+		return store.QueryError{
+			Message: "failed to create schema version table",
+			Query:   query,
+			Cause:   err,
+		}
+	}
+	return nil
+}
@@ -66,33 +66,42 @@ func (v *Alert) PrepareUpdate(id string) ([]string, error) {
 	return cols, nil
 }
 
+// PreparePatch prepares an Alert object for a merge patch
+// Returns list of fileds to update
+func (v *Alert) PreparePatch(id string, patched []string) ([]string, error) {
+	cols, err := v.Model.PreparePatch(id, patched)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range patched {
+		switch col {
+		case "ACKNOWLEDGED_AT", "RESOLVED_AT":
+		default:
+			if readOnly(col) {
+				continue
+			}
+			return nil, errNotPatchable(col)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
 // VideoDescriptor describes the Video table (returns name and filterset)
 func AlertDescriptor() Descriptor {
 	return Descriptor{
-		TableName: "ALERTS",
+		TableName:    "ALERTS",
+		HistoryTable: "ALERTS_HISTORY",
 		FilterSet: store.FilterSet{
 			"id":              store.StringDbType{},
 			"name":            store.StringDbType{},
 			"created_at":      store.TimeDbType{},
 			"modified_at":     store.TimeDbType{},
 			"timestamp":       store.TimeDbType{},
+			"camera":          store.StringDbType{},
 			"severity":        store.StringDbType{},
 			"acknowledged_at": store.TimeDbType{},
 			"resolved_at":     store.TimeDbType{},
 		},
-		Create: `
-		(
-			ID VARCHAR2(256) NOT NULL PRIMARY KEY,
-			CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
-			NAME VARCHAR(128) NOT NULL,
-			TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			CAMERA VARCHAR2(128) NOT NULL,
-			SEVERITY VARCHAR2(32) NOT NULL,
-			MESSAGE VARCHAR2(512) NOT NULL,
-			ACKNOWLEDGED_AT TIMESTAMP(6) WITH TIME ZONE NULL,
-			RESOLVED_AT TIMESTAMP(6) WITH TIME ZONE NULL,
-			CONSTRAINT FK_ALERT_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
-		)`,
 	}
 }
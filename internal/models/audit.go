@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// AuditEntry records a change made to a resource.
+// CreatedAt is the time of the change. Actor and Role
+// are null for changes not made by an user, e.g. purges.
+type AuditEntry struct {
+	Model
+	Actor        NullString `json:"actor" db:"ACTOR"`
+	Role         NullString `json:"role" db:"ROLE"`
+	Action       string     `json:"action" db:"ACTION"`
+	ResourceType string     `json:"resource_type" db:"RESOURCE_TYPE"`
+	ResourceID   string     `json:"resource_id" db:"RESOURCE_ID"`
+	RequestID    NullString `json:"request_id" db:"REQUEST_ID"`
+	Changes      JsonObject `json:"changes" db:"CHANGES"`
+}
+
+// errAuditReadOnly is returned when trying to modify an audit entry
+var errAuditReadOnly = errors.New("audit log entries can not be modified")
+
+// PrepareCreate prepares an AuditEntry object for persistence
+// Returns list of fields to save
+func (v *AuditEntry) PrepareCreate() ([]string, error) {
+	if v.Action == "" {
+		return nil, errors.New("missing mandatory attribute action")
+	}
+	if v.ResourceType == "" {
+		return nil, errors.New("missing mandatory attribute resource_type")
+	}
+	if v.ResourceID == "" {
+		return nil, errors.New("missing mandatory attribute resource_id")
+	}
+	cols, err := v.Model.PrepareCreate()
+	if err != nil {
+		return nil, err
+	}
+	cols = append(cols, "ACTOR", "ROLE", "ACTION", "RESOURCE_TYPE", "RESOURCE_ID", "REQUEST_ID", "CHANGES")
+	return cols, nil
+}
+
+// PrepareUpdate fails, audit entries are never updated
+func (v *AuditEntry) PrepareUpdate(id string) ([]string, error) {
+	return nil, errAuditReadOnly
+}
+
+// PreparePatch fails, audit entries are never updated
+func (v *AuditEntry) PreparePatch(id string, patched []string) ([]string, error) {
+	return nil, errAuditReadOnly
+}
+
+// AuditDescriptor describes the audit log table (returns name and filterset)
+func AuditDescriptor() Descriptor {
+	return Descriptor{
+		TableName: "AUDIT_LOG",
+		FilterSet: store.FilterSet{
+			"id":            store.StringDbType{},
+			"created_at":    store.TimeDbType{},
+			"modified_at":   store.TimeDbType{},
+			"actor":         store.StringDbType{},
+			"role":          store.StringDbType{},
+			"action":        store.StringDbType{},
+			"resource_type": store.StringDbType{},
+			"resource_id":   store.StringDbType{},
+			"request_id":    store.StringDbType{},
+		},
+	}
+}
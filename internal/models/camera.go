@@ -12,6 +12,11 @@ type Camera struct {
 	Latitude  float64    `json:"latitude" db:"LATITUDE"`
 	Longitude float64    `json:"longitude" db:"LONGITUDE"`
 	LocalPath NullString `json:"local_path,omitempty" db:"LOCAL_PATH"`
+	// Distance in meters to the `near` point of geo queries.
+	// Not stored, computed by the query.
+	Distance *float64 `json:"distance,omitempty" db:"DISTANCE"`
+	// Set when the camera is in the trash
+	DeletedAt NullTime `json:"deleted_at,omitempty" db:"DELETED_AT"`
 }
 
 // PrepareCreate prepares a Video object for persistence
@@ -26,6 +31,7 @@ func (v *Camera) PrepareCreate() ([]string, error) {
 	if v.Longitude == 0 {
 		return nil, errors.New("missing mandatory attribute longitude")
 	}
+	v.Distance = nil
 	cols, err := v.Model.PrepareCreate()
 	if err != nil {
 		return nil, err
@@ -44,6 +50,7 @@ func (v *Camera) PrepareUpdate(id string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	v.Distance = nil
 	if v.Name != "" {
 		cols = append(cols, "NAME")
 	}
@@ -59,25 +66,45 @@ func (v *Camera) PrepareUpdate(id string) ([]string, error) {
 	return cols, nil
 }
 
+// PreparePatch prepares a Camera object for a merge patch
+// Returns list of fields to update
+func (v *Camera) PreparePatch(id string, patched []string) ([]string, error) {
+	cols, err := v.Model.PreparePatch(id, patched)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range patched {
+		switch col {
+		case "NAME":
+			if v.Name == "" {
+				return nil, errors.New("attribute name can not be empty")
+			}
+		case "LATITUDE", "LONGITUDE", "LOCAL_PATH":
+			// Zero and null are valid values here
+		default:
+			if readOnly(col) {
+				continue
+			}
+			return nil, errNotPatchable(col)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
 // CameraDescriptor describes the Video table (returns name and filterset)
 func CameraDescriptor() Descriptor {
 	return Descriptor{
-		TableName: "CAMERAS",
+		TableName:    "CAMERAS",
+		HistoryTable: "CAMERAS_HISTORY",
 		FilterSet: store.FilterSet{
 			"id":          store.StringDbType{},
 			"created_at":  store.TimeDbType{},
 			"modified_at": store.TimeDbType{},
 			"name":        store.StringDbType{},
+			"latitude":    store.FloatDbType{},
+			"longitude":   store.FloatDbType{},
+			"deleted_at":  store.TimeDbType{},
 		},
-		Create: `
-		(
-			ID VARCHAR2(128) NOT NULL PRIMARY KEY,
-			CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
-			NAME VARCHAR2(128) NOT NULL,
-			LATITUDE NUMBER(16, 10) NOT NULL,
-			LONGITUDE NUMBER(16, 10) NOT NULL,
-			LOCAL_PATH VARCHAR2(512) NULL
-		)`,
 	}
 }
@@ -13,6 +13,14 @@ type Media struct {
 	Camera    string     `json:"camera" db:"CAMERA"`
 	Tags      JsonList   `json:"tags,omitempty" db:"TAGS"`
 	MediaURL  NullString `json:"media_url,omitempty" db:"MEDIA_URL"`
+	// Set when the media is in the trash
+	DeletedAt NullTime `json:"deleted_at,omitempty" db:"DELETED_AT"`
+	// Set while the media file is transcoded, see TRANSCODE_* constants
+	TranscodeStatus   NullString `json:"transcode_status,omitempty" db:"TRANSCODE_STATUS"`
+	TranscodeProgress NullInt    `json:"transcode_progress,omitempty" db:"TRANSCODE_PROGRESS"`
+	// Reduced versions of the media file, set when uploaded
+	ThumbnailURL NullString `json:"thumbnail_url,omitempty" db:"THUMBNAIL_URL"`
+	PreviewURL   NullString `json:"preview_url,omitempty" db:"PREVIEW_URL"`
 }
 
 // PrepareCreate prepares a Media object for persistence
@@ -54,6 +62,38 @@ func (v *Media) PrepareUpdate(id string) ([]string, error) {
 	if v.MediaURL.Valid && v.MediaURL.String != "" {
 		cols = append(cols, "MEDIA_URL")
 	}
+	// Null removes the thumbnails of a previous upload
+	if v.ThumbnailURL.Populated {
+		cols = append(cols, "THUMBNAIL_URL")
+	}
+	if v.PreviewURL.Populated {
+		cols = append(cols, "PREVIEW_URL")
+	}
+	return cols, nil
+}
+
+// PreparePatch prepares a Media object for a merge patch
+// Returns list of fields to update
+func (v *Media) PreparePatch(id string, patched []string) ([]string, error) {
+	cols, err := v.Model.PreparePatch(id, patched)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range patched {
+		switch col {
+		case "TIMESTAMP":
+			if v.Timestamp.IsZero() {
+				return nil, errors.New("attribute timestamp can not be empty")
+			}
+		case "TAGS", "MEDIA_URL", "TRANSCODE_STATUS", "TRANSCODE_PROGRESS", "THUMBNAIL_URL", "PREVIEW_URL":
+		default:
+			if readOnly(col) {
+				continue
+			}
+			return nil, errNotPatchable(col)
+		}
+		cols = append(cols, col)
+	}
 	return cols, nil
 }
 
@@ -62,26 +102,19 @@ func VideoDescriptor() Descriptor {
 	return Descriptor{
 		TableName: "VIDEOS",
 		FilterSet: store.FilterSet{
-			"id":          store.StringDbType{},
-			"created_at":  store.TimeDbType{},
-			"modified_at": store.TimeDbType{},
-			"timestamp":   store.TimeDbType{},
-			"camera":      store.StringDbType{},
-			"tags":        store.JsonDbType{},
-			"media_url":   store.StringDbType{},
+			"id":                 store.StringDbType{},
+			"created_at":         store.TimeDbType{},
+			"modified_at":        store.TimeDbType{},
+			"timestamp":          store.TimeDbType{},
+			"camera":             store.StringDbType{},
+			"tags":               store.JsonDbType{},
+			"media_url":          store.StringDbType{},
+			"deleted_at":         store.TimeDbType{},
+			"transcode_status":   store.StringDbType{},
+			"transcode_progress": store.IntDbType{},
+			"thumbnail_url":      store.StringDbType{},
+			"preview_url":        store.StringDbType{},
 		},
-		Create: `
-		(
-			ID VARCHAR2(128) NOT NULL PRIMARY KEY,
-			CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
-			TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			CAMERA VARCHAR2(128) NOT NULL,
-			TAGS VARCHAR2(256) NULL,
-			MEDIA_URL VARCHAR2(256) NULL,
-			CONSTRAINT VIDEOS_ENSURE_JSON CHECK (TAGS IS JSON),
-			CONSTRAINT FK_VIDEO_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
-		)`,
 	}
 }
 
@@ -90,25 +123,18 @@ func PictureDescriptor() Descriptor {
 	return Descriptor{
 		TableName: "PICTURES",
 		FilterSet: store.FilterSet{
-			"id":          store.StringDbType{},
-			"created_at":  store.TimeDbType{},
-			"modified_at": store.TimeDbType{},
-			"timestamp":   store.TimeDbType{},
-			"camera":      store.StringDbType{},
-			"tags":        store.JsonDbType{},
-			"media_url":   store.StringDbType{},
+			"id":                 store.StringDbType{},
+			"created_at":         store.TimeDbType{},
+			"modified_at":        store.TimeDbType{},
+			"timestamp":          store.TimeDbType{},
+			"camera":             store.StringDbType{},
+			"tags":               store.JsonDbType{},
+			"media_url":          store.StringDbType{},
+			"deleted_at":         store.TimeDbType{},
+			"transcode_status":   store.StringDbType{},
+			"transcode_progress": store.IntDbType{},
+			"thumbnail_url":      store.StringDbType{},
+			"preview_url":        store.StringDbType{},
 		},
-		Create: `
-		(
-			ID VARCHAR2(256) NOT NULL PRIMARY KEY,
-			CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
-			TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			CAMERA VARCHAR2(128) NOT NULL,
-			TAGS VARCHAR2(256) NULL,
-			MEDIA_URL VARCHAR2(256) NULL,
-			CONSTRAINT PICTURES_ENSURE_JSON CHECK (TAGS IS JSON),
-			CONSTRAINT FK_PICTURE_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
-		)`,
 	}
 }
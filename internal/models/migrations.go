@@ -0,0 +1,597 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/warpcomdev/videoapi/internal/migrate"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// Migrations returns the ordered list of schema changes.
+// Never modify a step once released, append a new one instead.
+func Migrations() []migrate.Step {
+	return []migrate.Step{
+		{
+			Version:     1,
+			Description: "create initial tables",
+			Up:          createTables(initialTables),
+			Down:        dropTables(initialTables),
+		},
+		{
+			Version:     2,
+			Description: "add soft delete to cameras and media",
+			Up:          addColumns(softDeleteTables, softDeleteColumn),
+			Down:        dropColumns(softDeleteTables, softDeleteColumn),
+		},
+		{
+			Version:     3,
+			Description: "create audit log",
+			Up:          createTables(auditTables),
+			Down:        dropTables(auditTables),
+		},
+		{
+			Version:     4,
+			Description: "create history of cameras and alerts",
+			Up:          createTables(historyTables),
+			Down:        dropTables(historyTables),
+		},
+		{
+			Version:     5,
+			Description: "create transcode job queue",
+			Up: concat(
+				addColumns(transcodeTables, transcodeStatusColumn),
+				addColumns(transcodeTables, transcodeProgressColumn),
+				createTables(transcodeJobTables),
+			),
+			Down: concat(
+				dropTables(transcodeJobTables),
+				dropColumns(transcodeTables, transcodeProgressColumn),
+				dropColumns(transcodeTables, transcodeStatusColumn),
+			),
+		},
+		{
+			Version:     6,
+			Description: "save content type of transcode jobs",
+			Up:          addColumns(transcodeJobTableNames, transcodeContentTypeColumn),
+			Down:        dropColumns(transcodeJobTableNames, transcodeContentTypeColumn),
+		},
+		{
+			Version:     7,
+			Description: "add thumbnails to media",
+			Up: concat(
+				addColumns(thumbnailTables, thumbnailURLColumn),
+				addColumns(thumbnailTables, previewURLColumn),
+			),
+			Down: concat(
+				dropColumns(thumbnailTables, previewURLColumn),
+				dropColumns(thumbnailTables, thumbnailURLColumn),
+			),
+		},
+	}
+}
+
+// concat joins the statements of several changes, in order
+func concat(changes ...map[string][]string) map[string][]string {
+	result := make(map[string][]string)
+	for _, change := range changes {
+		for dialect, stmts := range change {
+			result[dialect] = append(result[dialect], stmts...)
+		}
+	}
+	return result
+}
+
+// columnDDL describes how to add a column in every dialect
+type columnDDL struct {
+	name       string
+	definition map[string]string
+}
+
+// addColumns builds the ALTER TABLE statements to add the column to the tables
+func addColumns(tables []string, column columnDDL) map[string][]string {
+	result := make(map[string][]string)
+	for _, table := range tables {
+		for dialect, definition := range column.definition {
+			stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column.name, definition)
+			if dialect == store.ORACLE {
+				stmt = fmt.Sprintf("ALTER TABLE %s ADD (%s %s)", table, column.name, definition)
+			}
+			result[dialect] = append(result[dialect], stmt)
+		}
+	}
+	return result
+}
+
+// dropColumns builds the ALTER TABLE statements to drop the column from the tables
+func dropColumns(tables []string, column columnDDL) map[string][]string {
+	result := make(map[string][]string)
+	for idx := len(tables) - 1; idx >= 0; idx-- {
+		for dialect := range column.definition {
+			result[dialect] = append(result[dialect], fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tables[idx], column.name))
+		}
+	}
+	return result
+}
+
+// Tables with soft delete
+var softDeleteTables = []string{"CAMERAS", "VIDEOS", "PICTURES"}
+
+// Time of deletion, NULL unless the row is in the trash
+var softDeleteColumn = columnDDL{
+	name: store.DeletedColumn,
+	definition: map[string]string{
+		store.ORACLE:   "TIMESTAMP(6) WITH TIME ZONE NULL",
+		store.POSTGRES: "TIMESTAMP(6) WITH TIME ZONE NULL",
+		store.SQLITE:   "TIMESTAMP NULL",
+	},
+}
+
+// Audit log, without foreign keys so that
+// it outlives the resources it refers to
+var auditTables = []tableDDL{
+	{
+		name: "AUDIT_LOG",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				ID VARCHAR2(64) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				ACTOR VARCHAR2(128) NULL,
+				ROLE VARCHAR2(16) NULL,
+				ACTION VARCHAR2(16) NOT NULL,
+				RESOURCE_TYPE VARCHAR2(32) NOT NULL,
+				RESOURCE_ID VARCHAR2(256) NOT NULL,
+				REQUEST_ID VARCHAR2(128) NULL,
+				CHANGES CLOB NULL,
+				CONSTRAINT AUDIT_LOG_ENSURE_JSON CHECK (CHANGES IS JSON)
+			)`,
+			store.POSTGRES: `
+			(
+				ID VARCHAR(64) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				ACTOR VARCHAR(128) NULL,
+				ROLE VARCHAR(16) NULL,
+				ACTION VARCHAR(16) NOT NULL,
+				RESOURCE_TYPE VARCHAR(32) NOT NULL,
+				RESOURCE_ID VARCHAR(256) NOT NULL,
+				REQUEST_ID VARCHAR(128) NULL,
+				CHANGES TEXT NULL
+			)`,
+			store.SQLITE: `
+			(
+				ID VARCHAR(64) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP NOT NULL,
+				MODIFIED_AT TIMESTAMP,
+				ACTOR VARCHAR(128) NULL,
+				ROLE VARCHAR(16) NULL,
+				ACTION VARCHAR(16) NOT NULL,
+				RESOURCE_TYPE VARCHAR(32) NOT NULL,
+				RESOURCE_ID VARCHAR(256) NOT NULL,
+				REQUEST_ID VARCHAR(128) NULL,
+				CHANGES TEXT NULL
+			)`,
+		},
+	},
+}
+
+// Previous versions of cameras and alerts, as json documents.
+// Without foreign keys, history is kept after deleting the row.
+var historyTables = []tableDDL{
+	{
+		name: "CAMERAS_HISTORY",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				RESOURCE_ID VARCHAR2(256) NOT NULL,
+				VERSION NUMBER(10) NOT NULL,
+				REPLACED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				ACTOR VARCHAR2(128) NULL,
+				ROLE VARCHAR2(16) NULL,
+				ACTION VARCHAR2(16) NOT NULL,
+				DATA CLOB NOT NULL,
+				CONSTRAINT CAMERAS_HISTORY_PK PRIMARY KEY (RESOURCE_ID, VERSION),
+				CONSTRAINT CAMERAS_HISTORY_ENSURE_JSON CHECK (DATA IS JSON)
+			)`,
+			store.POSTGRES: `
+			(
+				RESOURCE_ID VARCHAR(256) NOT NULL,
+				VERSION INTEGER NOT NULL,
+				REPLACED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				ACTOR VARCHAR(128) NULL,
+				ROLE VARCHAR(16) NULL,
+				ACTION VARCHAR(16) NOT NULL,
+				DATA TEXT NOT NULL,
+				PRIMARY KEY (RESOURCE_ID, VERSION)
+			)`,
+			store.SQLITE: `
+			(
+				RESOURCE_ID VARCHAR(256) NOT NULL,
+				VERSION INTEGER NOT NULL,
+				REPLACED_AT TIMESTAMP NOT NULL,
+				ACTOR VARCHAR(128) NULL,
+				ROLE VARCHAR(16) NULL,
+				ACTION VARCHAR(16) NOT NULL,
+				DATA TEXT NOT NULL,
+				PRIMARY KEY (RESOURCE_ID, VERSION)
+			)`,
+		},
+	},
+	{
+		name: "ALERTS_HISTORY",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				RESOURCE_ID VARCHAR2(256) NOT NULL,
+				VERSION NUMBER(10) NOT NULL,
+				REPLACED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				ACTOR VARCHAR2(128) NULL,
+				ROLE VARCHAR2(16) NULL,
+				ACTION VARCHAR2(16) NOT NULL,
+				DATA CLOB NOT NULL,
+				CONSTRAINT ALERTS_HISTORY_PK PRIMARY KEY (RESOURCE_ID, VERSION),
+				CONSTRAINT ALERTS_HISTORY_ENSURE_JSON CHECK (DATA IS JSON)
+			)`,
+			store.POSTGRES: `
+			(
+				RESOURCE_ID VARCHAR(256) NOT NULL,
+				VERSION INTEGER NOT NULL,
+				REPLACED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				ACTOR VARCHAR(128) NULL,
+				ROLE VARCHAR(16) NULL,
+				ACTION VARCHAR(16) NOT NULL,
+				DATA TEXT NOT NULL,
+				PRIMARY KEY (RESOURCE_ID, VERSION)
+			)`,
+			store.SQLITE: `
+			(
+				RESOURCE_ID VARCHAR(256) NOT NULL,
+				VERSION INTEGER NOT NULL,
+				REPLACED_AT TIMESTAMP NOT NULL,
+				ACTOR VARCHAR(128) NULL,
+				ROLE VARCHAR(16) NULL,
+				ACTION VARCHAR(16) NOT NULL,
+				DATA TEXT NOT NULL,
+				PRIMARY KEY (RESOURCE_ID, VERSION)
+			)`,
+		},
+	},
+}
+
+// Media tables with transcode status. Only videos are
+// transcoded, but both kinds of media share the model.
+var transcodeTables = []string{"VIDEOS", "PICTURES"}
+
+// Status of the transcode job of the media file, if any
+var transcodeStatusColumn = columnDDL{
+	name: "TRANSCODE_STATUS",
+	definition: map[string]string{
+		store.ORACLE:   "VARCHAR2(16) NULL",
+		store.POSTGRES: "VARCHAR(16) NULL",
+		store.SQLITE:   "VARCHAR(16) NULL",
+	},
+}
+
+// Percentage of the transcode job completed
+var transcodeProgressColumn = columnDDL{
+	name: "TRANSCODE_PROGRESS",
+	definition: map[string]string{
+		store.ORACLE:   "NUMBER(3) NULL",
+		store.POSTGRES: "INTEGER NULL",
+		store.SQLITE:   "INTEGER NULL",
+	},
+}
+
+// Queue of transcode jobs. Without foreign keys, so
+// that jobs of deleted media can be found and discarded.
+var transcodeJobTables = []tableDDL{
+	{
+		name: "TRANSCODE_JOBS",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				ID VARCHAR2(64) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				MEDIA VARCHAR2(128) NOT NULL,
+				SOURCE VARCHAR2(256) NOT NULL,
+				STATUS VARCHAR2(16) NOT NULL,
+				ATTEMPTS NUMBER(10) NOT NULL,
+				NOT_BEFORE TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				ERROR VARCHAR2(1024) NULL
+			)`,
+			store.POSTGRES: `
+			(
+				ID VARCHAR(64) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				MEDIA VARCHAR(128) NOT NULL,
+				SOURCE VARCHAR(256) NOT NULL,
+				STATUS VARCHAR(16) NOT NULL,
+				ATTEMPTS INTEGER NOT NULL,
+				NOT_BEFORE TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				ERROR VARCHAR(1024) NULL
+			)`,
+			store.SQLITE: `
+			(
+				ID VARCHAR(64) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP NOT NULL,
+				MODIFIED_AT TIMESTAMP,
+				MEDIA VARCHAR(128) NOT NULL,
+				SOURCE VARCHAR(256) NOT NULL,
+				STATUS VARCHAR(16) NOT NULL,
+				ATTEMPTS INTEGER NOT NULL,
+				NOT_BEFORE TIMESTAMP NOT NULL,
+				ERROR VARCHAR(1024) NULL
+			)`,
+		},
+	},
+}
+
+// Tables with the content type of transcode jobs
+var transcodeJobTableNames = []string{"TRANSCODE_JOBS"}
+
+// Content type of the source, to choose the transcoding profile
+var transcodeContentTypeColumn = columnDDL{
+	name: "CONTENT_TYPE",
+	definition: map[string]string{
+		store.ORACLE:   "VARCHAR2(128) NULL",
+		store.POSTGRES: "VARCHAR(128) NULL",
+		store.SQLITE:   "VARCHAR(128) NULL",
+	},
+}
+
+// Tables with thumbnails of the media files
+var thumbnailTables = []string{"VIDEOS", "PICTURES"}
+
+// Key of the still thumbnail of the media file
+var thumbnailURLColumn = columnDDL{
+	name: "THUMBNAIL_URL",
+	definition: map[string]string{
+		store.ORACLE:   "VARCHAR2(256) NULL",
+		store.POSTGRES: "VARCHAR(256) NULL",
+		store.SQLITE:   "VARCHAR(256) NULL",
+	},
+}
+
+// Key of the animated preview of the media file
+var previewURLColumn = columnDDL{
+	name: "PREVIEW_URL",
+	definition: map[string]string{
+		store.ORACLE:   "VARCHAR2(256) NULL",
+		store.POSTGRES: "VARCHAR(256) NULL",
+		store.SQLITE:   "VARCHAR(256) NULL",
+	},
+}
+
+// tableDDL describes how to create a table in every dialect
+type tableDDL struct {
+	name   string
+	create map[string]string
+}
+
+// createTables builds the CREATE TABLE statements for every dialect
+func createTables(tables []tableDDL) map[string][]string {
+	result := make(map[string][]string)
+	for _, table := range tables {
+		for dialect, create := range table.create {
+			result[dialect] = append(result[dialect], "CREATE TABLE "+table.name+" "+create)
+		}
+	}
+	return result
+}
+
+// dropTables builds the DROP TABLE statements for every dialect, in reverse order
+func dropTables(tables []tableDDL) map[string][]string {
+	result := make(map[string][]string)
+	for idx := len(tables) - 1; idx >= 0; idx-- {
+		for dialect := range tables[idx].create {
+			result[dialect] = append(result[dialect], "DROP TABLE "+tables[idx].name)
+		}
+	}
+	return result
+}
+
+// Tables created by the first version of the schema.
+// Order matters, because of foreign keys.
+var initialTables = []tableDDL{
+	{
+		name: "USERS",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				ID VARCHAR2(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				NAME VARCHAR2(256) NOT NULL,
+				ROLE VARCHAR2(16) NOT NULL,
+				HASH VARCHAR2(256) NOT NULL
+			)`,
+			store.POSTGRES: `
+			(
+				ID VARCHAR(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				NAME VARCHAR(256) NOT NULL,
+				ROLE VARCHAR(16) NOT NULL,
+				HASH VARCHAR(256) NOT NULL
+			)`,
+			store.SQLITE: `
+			(
+				ID VARCHAR(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP NOT NULL,
+				MODIFIED_AT TIMESTAMP,
+				NAME VARCHAR(256) NOT NULL,
+				ROLE VARCHAR(16) NOT NULL,
+				HASH VARCHAR(256) NOT NULL
+			)`,
+		},
+	},
+	{
+		name: "CAMERAS",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				ID VARCHAR2(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				NAME VARCHAR2(128) NOT NULL,
+				LATITUDE NUMBER(16, 10) NOT NULL,
+				LONGITUDE NUMBER(16, 10) NOT NULL,
+				LOCAL_PATH VARCHAR2(512) NULL
+			)`,
+			store.POSTGRES: `
+			(
+				ID VARCHAR(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				NAME VARCHAR(128) NOT NULL,
+				LATITUDE NUMERIC(16, 10) NOT NULL,
+				LONGITUDE NUMERIC(16, 10) NOT NULL,
+				LOCAL_PATH VARCHAR(512) NULL
+			)`,
+			store.SQLITE: `
+			(
+				ID VARCHAR(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP NOT NULL,
+				MODIFIED_AT TIMESTAMP,
+				NAME VARCHAR(128) NOT NULL,
+				LATITUDE REAL NOT NULL,
+				LONGITUDE REAL NOT NULL,
+				LOCAL_PATH VARCHAR(512) NULL
+			)`,
+		},
+	},
+	{
+		name: "VIDEOS",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				ID VARCHAR2(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				CAMERA VARCHAR2(128) NOT NULL,
+				TAGS VARCHAR2(256) NULL,
+				MEDIA_URL VARCHAR2(256) NULL,
+				CONSTRAINT VIDEOS_ENSURE_JSON CHECK (TAGS IS JSON),
+				CONSTRAINT FK_VIDEO_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+			// TAGS is kept as text so that it can be filtered with like.
+			// Casting to jsonb fails for malformed json, rejecting the row.
+			store.POSTGRES: `
+			(
+				ID VARCHAR(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				CAMERA VARCHAR(128) NOT NULL,
+				TAGS VARCHAR(256) NULL,
+				MEDIA_URL VARCHAR(256) NULL,
+				CONSTRAINT VIDEOS_ENSURE_JSON CHECK (TAGS IS NULL OR TAGS::jsonb IS NOT NULL),
+				CONSTRAINT FK_VIDEO_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+			store.SQLITE: `
+			(
+				ID VARCHAR(128) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP NOT NULL,
+				MODIFIED_AT TIMESTAMP,
+				TIMESTAMP TIMESTAMP NOT NULL,
+				CAMERA VARCHAR(128) NOT NULL,
+				TAGS VARCHAR(256) NULL,
+				MEDIA_URL VARCHAR(256) NULL,
+				CONSTRAINT VIDEOS_ENSURE_JSON CHECK (TAGS IS NULL OR json_valid(TAGS)),
+				CONSTRAINT FK_VIDEO_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+		},
+	},
+	{
+		name: "PICTURES",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				ID VARCHAR2(256) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				CAMERA VARCHAR2(128) NOT NULL,
+				TAGS VARCHAR2(256) NULL,
+				MEDIA_URL VARCHAR2(256) NULL,
+				CONSTRAINT PICTURES_ENSURE_JSON CHECK (TAGS IS JSON),
+				CONSTRAINT FK_PICTURE_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+			store.POSTGRES: `
+			(
+				ID VARCHAR(256) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				CAMERA VARCHAR(128) NOT NULL,
+				TAGS VARCHAR(256) NULL,
+				MEDIA_URL VARCHAR(256) NULL,
+				CONSTRAINT PICTURES_ENSURE_JSON CHECK (TAGS IS NULL OR TAGS::jsonb IS NOT NULL),
+				CONSTRAINT FK_PICTURE_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+			store.SQLITE: `
+			(
+				ID VARCHAR(256) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP NOT NULL,
+				MODIFIED_AT TIMESTAMP,
+				TIMESTAMP TIMESTAMP NOT NULL,
+				CAMERA VARCHAR(128) NOT NULL,
+				TAGS VARCHAR(256) NULL,
+				MEDIA_URL VARCHAR(256) NULL,
+				CONSTRAINT PICTURES_ENSURE_JSON CHECK (TAGS IS NULL OR json_valid(TAGS)),
+				CONSTRAINT FK_PICTURE_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+		},
+	},
+	{
+		name: "ALERTS",
+		create: map[string]string{
+			store.ORACLE: `
+			(
+				ID VARCHAR2(256) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				NAME VARCHAR(128) NOT NULL,
+				TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				CAMERA VARCHAR2(128) NOT NULL,
+				SEVERITY VARCHAR2(32) NOT NULL,
+				MESSAGE VARCHAR2(512) NOT NULL,
+				ACKNOWLEDGED_AT TIMESTAMP(6) WITH TIME ZONE NULL,
+				RESOLVED_AT TIMESTAMP(6) WITH TIME ZONE NULL,
+				CONSTRAINT FK_ALERT_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+			store.POSTGRES: `
+			(
+				ID VARCHAR(256) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
+				NAME VARCHAR(128) NOT NULL,
+				TIMESTAMP TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+				CAMERA VARCHAR(128) NOT NULL,
+				SEVERITY VARCHAR(32) NOT NULL,
+				MESSAGE VARCHAR(512) NOT NULL,
+				ACKNOWLEDGED_AT TIMESTAMP(6) WITH TIME ZONE NULL,
+				RESOLVED_AT TIMESTAMP(6) WITH TIME ZONE NULL,
+				CONSTRAINT FK_ALERT_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+			store.SQLITE: `
+			(
+				ID VARCHAR(256) NOT NULL PRIMARY KEY,
+				CREATED_AT TIMESTAMP NOT NULL,
+				MODIFIED_AT TIMESTAMP,
+				NAME VARCHAR(128) NOT NULL,
+				TIMESTAMP TIMESTAMP NOT NULL,
+				CAMERA VARCHAR(128) NOT NULL,
+				SEVERITY VARCHAR(32) NOT NULL,
+				MESSAGE VARCHAR(512) NOT NULL,
+				ACKNOWLEDGED_AT TIMESTAMP NULL,
+				RESOLVED_AT TIMESTAMP NULL,
+				CONSTRAINT FK_ALERT_CAMERA FOREIGN KEY (CAMERA) REFERENCES CAMERAS(ID)
+			)`,
+		},
+	},
+}
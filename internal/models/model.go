@@ -1,12 +1,11 @@
 package models
 
 import (
-	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/warpcomdev/videoapi/internal/store"
 )
 
@@ -22,7 +21,8 @@ type Model struct {
 type Descriptor struct {
 	TableName string
 	FilterSet store.FilterSet
-	Create    string
+	// Table with the previous versions of the rows, if any
+	HistoryTable string
 }
 
 // GetID returns video ID
@@ -30,6 +30,11 @@ func (m Model) GetID() string {
 	return m.ID
 }
 
+// GetVersion returns the time of the last change
+func (m Model) GetVersion() time.Time {
+	return m.ModifiedAt
+}
+
 // Prepare a model to be created into the database
 // Return list of columns to be written
 func (m *Model) PrepareCreate() ([]string, error) {
@@ -52,19 +57,26 @@ func (m *Model) PrepareUpdate(id string) ([]string, error) {
 	return []string{"MODIFIED_AT"}, nil
 }
 
-func (d Descriptor) CreateDb(ctx context.Context, db *sqlx.DB) error {
-	var sb strings.Builder
-	sb.WriteString("CREATE TABLE ")
-	sb.WriteString(d.TableName)
-	sb.WriteString(" ")
-	sb.WriteString(d.Create)
-	tx, err := db.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	if _, err := tx.Exec(sb.String()); err != nil {
-		tx.Rollback()
-		return err
+// Prepare a model to be patched in the database.
+// Return list of columns to be updated. Read-only columns in
+// the patch are ignored, so that whole objects can be sent back.
+func (m *Model) PreparePatch(id string, patched []string) ([]string, error) {
+	if id == "" {
+		return nil, errors.New("missing mandatory attribute id")
 	}
-	return tx.Commit()
+	m.ID = id
+	m.ModifiedAt = time.Now()
+	return []string{"MODIFIED_AT"}, nil
+}
+
+// readOnly columns of every model. DELETED_AT only
+// changes when the resource is deleted or restored.
+func readOnly(col string) bool {
+	return col == "ID" || col == "CREATED_AT" || col == "MODIFIED_AT" || col == "DELETED_AT"
+}
+
+// errNotPatchable is returned when a patch includes a column
+// that can not be updated
+func errNotPatchable(col string) error {
+	return fmt.Errorf("attribute %s can not be patched", strings.ToLower(col))
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// Status of a transcode job, also shown in the
+// transcode_status attribute of the media
+const (
+	TRANSCODE_PENDING = "pending"
+	TRANSCODE_RUNNING = "running"
+	TRANSCODE_DONE    = "done"
+	TRANSCODE_FAILED  = "failed"
+)
+
+// TranscodeJob converts the file of a video to a format
+// the browsers can play. Source is the media_url of the
+// file when the job was created.
+type TranscodeJob struct {
+	Model
+	Media  string `json:"media" db:"MEDIA"`
+	Source string `json:"source" db:"SOURCE"`
+	// Content type of the source, as uploaded
+	ContentType NullString `json:"content_type" db:"CONTENT_TYPE"`
+	Status      string     `json:"status" db:"STATUS"`
+	Attempts    int        `json:"attempts" db:"ATTEMPTS"`
+	NotBefore   time.Time  `json:"not_before" db:"NOT_BEFORE"`
+	Error       NullString `json:"error" db:"ERROR"`
+}
+
+// PrepareCreate prepares a TranscodeJob object for persistence
+// Returns list of fields to save
+func (v *TranscodeJob) PrepareCreate() ([]string, error) {
+	if v.Media == "" {
+		return nil, errors.New("missing mandatory attribute media")
+	}
+	if v.Source == "" {
+		return nil, errors.New("missing mandatory attribute source")
+	}
+	cols, err := v.Model.PrepareCreate()
+	if err != nil {
+		return nil, err
+	}
+	if v.Status == "" {
+		v.Status = TRANSCODE_PENDING
+	}
+	if v.NotBefore.IsZero() {
+		v.NotBefore = v.CreatedAt
+	}
+	cols = append(cols, "MEDIA", "SOURCE", "CONTENT_TYPE", "STATUS", "ATTEMPTS", "NOT_BEFORE", "ERROR")
+	return cols, nil
+}
+
+// PrepareUpdate prepares a TranscodeJob object for update
+// Returns list of fields to update
+func (v *TranscodeJob) PrepareUpdate(id string) ([]string, error) {
+	cols, err := v.Model.PrepareUpdate(id)
+	if err != nil {
+		return nil, err
+	}
+	cols = append(cols, "STATUS", "ATTEMPTS", "NOT_BEFORE", "ERROR")
+	return cols, nil
+}
+
+// PreparePatch prepares a TranscodeJob object for a merge patch
+// Returns list of fields to update
+func (v *TranscodeJob) PreparePatch(id string, patched []string) ([]string, error) {
+	cols, err := v.Model.PreparePatch(id, patched)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range patched {
+		switch col {
+		case "STATUS", "ATTEMPTS", "NOT_BEFORE", "ERROR":
+		default:
+			if readOnly(col) {
+				continue
+			}
+			return nil, errNotPatchable(col)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// TranscodeJobDescriptor describes the transcode jobs table (returns name and filterset)
+func TranscodeJobDescriptor() Descriptor {
+	return Descriptor{
+		TableName: "TRANSCODE_JOBS",
+		FilterSet: store.FilterSet{
+			"id":           store.StringDbType{},
+			"created_at":   store.TimeDbType{},
+			"modified_at":  store.TimeDbType{},
+			"media":        store.StringDbType{},
+			"source":       store.StringDbType{},
+			"content_type": store.StringDbType{},
+			"status":       store.StringDbType{},
+			"attempts":     store.IntDbType{},
+			"not_before":   store.TimeDbType{},
+		},
+	}
+}
@@ -23,6 +23,11 @@ type NullTime struct {
 	Populated bool
 }
 
+type NullInt struct {
+	sql.NullInt64
+	Populated bool
+}
+
 // Scan the field as a json array
 func (n JsonList) MarshalJSON() ([]byte, error) {
 	if !n.Valid {
@@ -36,6 +41,12 @@ func (n *JsonList) UnmarshalJSON(data []byte) error {
 	if data == nil {
 		return errors.New("field should be optional")
 	}
+	// Explicit null clears the value
+	if string(data) == "null" {
+		n.Populated = true
+		n.Valid = false
+		return nil
+	}
 	var valid []string
 	if err := json.Unmarshal(data, &valid); err != nil {
 		return err
@@ -63,6 +74,12 @@ func (n *NullString) UnmarshalJSON(data []byte) error {
 	if data == nil {
 		return errors.New("field should be optional")
 	}
+	// Explicit null clears the value
+	if string(data) == "null" {
+		n.Populated = true
+		n.Valid = false
+		return nil
+	}
 	var valid string
 	if err := json.Unmarshal(data, &valid); err != nil {
 		return err
@@ -86,6 +103,12 @@ func (n *NullTime) UnmarshalJSON(data []byte) error {
 	if data == nil {
 		return errors.New("field should be optional")
 	}
+	// Explicit null clears the value
+	if string(data) == "null" {
+		n.Populated = true
+		n.Valid = false
+		return nil
+	}
 	var valid time.Time
 	if err := json.Unmarshal(data, &valid); err != nil {
 		return err
@@ -95,3 +118,60 @@ func (n *NullTime) UnmarshalJSON(data []byte) error {
 	n.Time = valid
 	return nil
 }
+
+// Scan the field as a json number
+func (n NullInt) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Int64)
+}
+
+// Value turns the number into a database integer
+func (n *NullInt) UnmarshalJSON(data []byte) error {
+	if data == nil {
+		return errors.New("field should be optional")
+	}
+	// Explicit null clears the value
+	if string(data) == "null" {
+		n.Populated = true
+		n.Valid = false
+		return nil
+	}
+	var valid int64
+	if err := json.Unmarshal(data, &valid); err != nil {
+		return err
+	}
+	n.Populated = true
+	n.Valid = true
+	n.Int64 = valid
+	return nil
+}
+
+// Particular type of string that contains a json object
+type JsonObject struct {
+	sql.NullString
+}
+
+// Marshal the field as raw json
+func (n JsonObject) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return []byte(n.String), nil
+}
+
+// Keep the object as a database string
+func (n *JsonObject) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		n.Valid = false
+		return nil
+	}
+	var valid map[string]json.RawMessage
+	if err := json.Unmarshal(data, &valid); err != nil {
+		return err
+	}
+	n.Valid = true
+	n.String = string(data)
+	return nil
+}
@@ -52,14 +52,26 @@ func (r Role) Value() (driver.Value, error) {
 	return string(r), nil
 }
 
-// PrepareCreate prepares a Video object for persistence
-// Returns list of fields to save
-func (v *User) PrepareCreate() ([]string, error) {
+// ValidateCreate implements store.CreateValidator. Checks the
+// mandatory attributes, without the cost of hashing the password.
+func (v *User) ValidateCreate() error {
 	if v.Name == "" {
-		return nil, errors.New("missing mandatory attribute name")
+		return errors.New("missing mandatory attribute name")
 	}
 	if v.Password == "" {
-		return nil, errors.New("missing mandatory attribute password")
+		return errors.New("missing mandatory attribute password")
+	}
+	if v.ID == "" {
+		return errors.New("missing mandatory attribute id")
+	}
+	return nil
+}
+
+// PrepareCreate prepares a Video object for persistence
+// Returns list of fields to save
+func (v *User) PrepareCreate() ([]string, error) {
+	if err := v.ValidateCreate(); err != nil {
+		return nil, err
 	}
 	cols, err := v.Model.PrepareCreate()
 	if err != nil {
@@ -106,6 +118,45 @@ func (v *User) PrepareUpdate(id string) ([]string, error) {
 	return cols, nil
 }
 
+// PreparePatch prepares an User object for a merge patch
+// Returns list of fields to update
+func (v *User) PreparePatch(id string, patched []string) ([]string, error) {
+	cols, err := v.Model.PreparePatch(id, patched)
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range patched {
+		switch col {
+		case "HASH":
+			if v.Password == "" {
+				return nil, errors.New("attribute password can not be empty")
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(v.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, err
+			}
+			v.Password = base64.StdEncoding.EncodeToString(hash)
+		case "NAME":
+			if v.Name == "" {
+				return nil, errors.New("attribute name can not be empty")
+			}
+		case "ROLE":
+			switch v.Role {
+			case ROLE_READ_ONLY, ROLE_READ_WRITE, ROLE_ADMIN, ROLE_SERVICE:
+			default:
+				return nil, errors.New("invalid value for attribute role")
+			}
+		default:
+			if readOnly(col) {
+				continue
+			}
+			return nil, errNotPatchable(col)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
 // UserDescriptor describes the User table (returns name and filterset)
 func UserDescriptor() Descriptor {
 	return Descriptor{
@@ -114,14 +165,5 @@ func UserDescriptor() Descriptor {
 			"id":   store.StringDbType{},
 			"name": store.StringDbType{},
 		},
-		Create: `
-		(
-			ID VARCHAR2(128) NOT NULL PRIMARY KEY,
-			CREATED_AT TIMESTAMP(6) WITH TIME ZONE NOT NULL,
-			MODIFIED_AT TIMESTAMP(6) WITH TIME ZONE,
-			NAME VARCHAR2(256) NOT NULL,
-			ROLE VARCHAR2(16) NOT NULL,
-			HASH VARCHAR2(256) NOT NULL
-		)`,
 	}
 }
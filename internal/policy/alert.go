@@ -20,13 +20,34 @@ func (up AlertPolicy) GetById(ctx context.Context, id string) (models.Alert, err
 }
 
 // Get allowed to anyone
-func (up AlertPolicy) Get(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation, sort []string, ascending bool, offset, limit int) ([]models.Alert, error) {
-	return up.AlertStore.Get(ctx, filter, outerOp, innerOp, sort, ascending, offset, limit)
+func (up AlertPolicy) Get(ctx context.Context, query crud.Query) ([]models.Alert, error) {
+	return up.AlertStore.Get(ctx, query)
 }
 
 // Get allowed to anyone
-func (up AlertPolicy) Count(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) (uint64, error) {
-	return up.AlertStore.Count(ctx, filter, outerOp, innerOp)
+func (up AlertPolicy) Count(ctx context.Context, query crud.Query) (uint64, error) {
+	return up.AlertStore.Count(ctx, query)
+}
+
+// Stats allowed to anyone
+func (up AlertPolicy) Stats(ctx context.Context, query crud.Query, agg crud.Aggregation) ([]store.StatCount, error) {
+	aggregator, ok := up.AlertStore.(store.Aggregator)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return aggregator.Stats(ctx, query, agg)
+}
+
+// Stream allowed to anyone with write permissions
+func (up AlertPolicy) Stream(ctx context.Context, query crud.Query, f func(models.Alert) error) error {
+	if err := canExport(ctx); err != nil {
+		return err
+	}
+	streamer, ok := up.AlertStore.(store.Streamer[models.Alert])
+	if !ok {
+		return crud.ErrInvalidFormat
+	}
+	return streamer.Stream(ctx, query, f)
 }
 
 // Post allowed to anyone with write permissions
@@ -61,6 +82,22 @@ func (up AlertPolicy) Put(ctx context.Context, id string, data models.Alert) err
 	return up.AlertStore.Put(ctx, id, data)
 }
 
+// Patch only allowed for acknowledge or resolve
+func (up AlertPolicy) Patch(ctx context.Context, id string, data models.Alert, columns []string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN && claims.Role != models.ROLE_READ_WRITE && claims.Role != models.ROLE_SERVICE {
+		return crud.ErrUnauthorized
+	}
+	if claims.Role != models.ROLE_ADMIN && claims.Role != models.ROLE_SERVICE {
+		// Read-write users can only change the ack status
+		columns = allowColumns(columns, "ACKNOWLEDGED_AT", "RESOLVED_AT")
+	}
+	return up.AlertStore.Patch(ctx, id, data, columns)
+}
+
 // Delete allowed only to ROLE_ADMIN
 func (up AlertPolicy) Delete(ctx context.Context, id string) error {
 	claims, err := auth.ClaimsFrom(ctx)
@@ -72,3 +109,33 @@ func (up AlertPolicy) Delete(ctx context.Context, id string) error {
 	}
 	return up.AlertStore.Delete(ctx, id)
 }
+
+// History allowed to anyone
+func (up AlertPolicy) History(ctx context.Context, id string) ([]store.Revision, error) {
+	historian, ok := up.AlertStore.(store.Historian)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return historian.History(ctx, id)
+}
+
+// Revert allowed only to ROLE_ADMIN
+func (up AlertPolicy) Revert(ctx context.Context, id string, version string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return crud.ErrUnauthorized
+	}
+	historian, ok := up.AlertStore.(store.Historian)
+	if !ok {
+		return crud.ErrNotFound
+	}
+	return historian.Revert(ctx, id, version)
+}
+
+// Batch allowed to anyone, each operation in the batch enforces its own policy
+func (up AlertPolicy) Batch(ctx context.Context, f func(context.Context) error) error {
+	return up.AlertStore.Batch(ctx, f)
+}
@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/warpcomdev/videoapi/internal/auth"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	"github.com/warpcomdev/videoapi/internal/models"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// AuditPolicy implements store.Resource, the audit log
+// is read only and only visible to ROLE_ADMIN
+type AuditPolicy struct {
+	AuditStore store.Resource[models.AuditEntry]
+}
+
+// isAdmin checks the role is ROLE_ADMIN
+func isAdmin(ctx context.Context) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return crud.ErrUnauthorized
+	}
+	return nil
+}
+
+// GetById allowed only to ROLE_ADMIN
+func (up AuditPolicy) GetById(ctx context.Context, id string) (models.AuditEntry, error) {
+	if err := isAdmin(ctx); err != nil {
+		return models.AuditEntry{}, err
+	}
+	return up.AuditStore.GetById(ctx, id)
+}
+
+// Get allowed only to ROLE_ADMIN
+func (up AuditPolicy) Get(ctx context.Context, query crud.Query) ([]models.AuditEntry, error) {
+	if err := isAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return up.AuditStore.Get(ctx, query)
+}
+
+// Count allowed only to ROLE_ADMIN
+func (up AuditPolicy) Count(ctx context.Context, query crud.Query) (uint64, error) {
+	if err := isAdmin(ctx); err != nil {
+		return 0, err
+	}
+	return up.AuditStore.Count(ctx, query)
+}
+
+// Stream allowed only to ROLE_ADMIN
+func (up AuditPolicy) Stream(ctx context.Context, query crud.Query, f func(models.AuditEntry) error) error {
+	if err := isAdmin(ctx); err != nil {
+		return err
+	}
+	streamer, ok := up.AuditStore.(store.Streamer[models.AuditEntry])
+	if !ok {
+		return crud.ErrInvalidFormat
+	}
+	return streamer.Stream(ctx, query, f)
+}
+
+// Post not allowed, entries are only created by the auditor
+func (up AuditPolicy) Post(ctx context.Context, data models.AuditEntry) (string, error) {
+	return "", crud.ErrUnauthorized
+}
+
+// Put not allowed
+func (up AuditPolicy) Put(ctx context.Context, id string, data models.AuditEntry) error {
+	return crud.ErrUnauthorized
+}
+
+// Patch not allowed
+func (up AuditPolicy) Patch(ctx context.Context, id string, data models.AuditEntry, columns []string) error {
+	return crud.ErrUnauthorized
+}
+
+// Delete not allowed
+func (up AuditPolicy) Delete(ctx context.Context, id string) error {
+	return crud.ErrUnauthorized
+}
+
+// Batch allowed to anyone, each operation in the batch enforces its own policy
+func (up AuditPolicy) Batch(ctx context.Context, f func(context.Context) error) error {
+	return up.AuditStore.Batch(ctx, f)
+}
@@ -2,6 +2,7 @@ package policy
 
 import (
 	"context"
+	"time"
 
 	"github.com/warpcomdev/videoapi/internal/auth"
 	"github.com/warpcomdev/videoapi/internal/crud"
@@ -19,14 +20,35 @@ func (up CameraPolicy) GetById(ctx context.Context, id string) (models.Camera, e
 	return up.CameraStore.GetById(ctx, id)
 }
 
-// Get allowed to anyone
-func (up CameraPolicy) Get(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation, sort []string, ascending bool, offset, limit int) ([]models.Camera, error) {
-	return up.CameraStore.Get(ctx, filter, outerOp, innerOp, sort, ascending, offset, limit)
+// Get allowed to anyone, the trash only to ROLE_ADMIN
+func (up CameraPolicy) Get(ctx context.Context, query crud.Query) ([]models.Camera, error) {
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return nil, err
+	}
+	return up.CameraStore.Get(ctx, query)
+}
+
+// Count allowed to anyone, the trash only to ROLE_ADMIN
+func (up CameraPolicy) Count(ctx context.Context, query crud.Query) (uint64, error) {
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return 0, err
+	}
+	return up.CameraStore.Count(ctx, query)
 }
 
-// Count allowed to anyone
-func (up CameraPolicy) Count(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) (uint64, error) {
-	return up.CameraStore.Count(ctx, filter, outerOp, innerOp)
+// Stream allowed to anyone with write permissions
+func (up CameraPolicy) Stream(ctx context.Context, query crud.Query, f func(models.Camera) error) error {
+	if err := canExport(ctx); err != nil {
+		return err
+	}
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return err
+	}
+	streamer, ok := up.CameraStore.(store.Streamer[models.Camera])
+	if !ok {
+		return crud.ErrInvalidFormat
+	}
+	return streamer.Stream(ctx, query, f)
 }
 
 // Post allowed only to ROLE_ADMIN
@@ -63,6 +85,25 @@ func (up CameraPolicy) Put(ctx context.Context, id string, data models.Camera) e
 	return up.CameraStore.Put(ctx, id, data)
 }
 
+// Patch restricted depending on role
+func (up CameraPolicy) Patch(ctx context.Context, id string, data models.Camera, columns []string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN && claims.Role != models.ROLE_READ_WRITE {
+		return crud.ErrUnauthorized
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		// Read-write users can only change the store path
+		columns = allowColumns(columns, "LOCAL_PATH")
+		if len(columns) == 0 {
+			return crud.ErrUnauthorized
+		}
+	}
+	return up.CameraStore.Patch(ctx, id, data, columns)
+}
+
 // Delete allowed only to ROLE_ADMIN
 func (up CameraPolicy) Delete(ctx context.Context, id string) error {
 	claims, err := auth.ClaimsFrom(ctx)
@@ -74,3 +115,65 @@ func (up CameraPolicy) Delete(ctx context.Context, id string) error {
 	}
 	return up.CameraStore.Delete(ctx, id)
 }
+
+// Restore allowed only to ROLE_ADMIN
+func (up CameraPolicy) Restore(ctx context.Context, id string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return crud.ErrUnauthorized
+	}
+	deleter, ok := up.CameraStore.(store.SoftDeleter)
+	if !ok {
+		return crud.ErrNotFound
+	}
+	return deleter.Restore(ctx, id)
+}
+
+// Purge allowed only to ROLE_ADMIN
+func (up CameraPolicy) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return nil, crud.ErrUnauthorized
+	}
+	deleter, ok := up.CameraStore.(store.SoftDeleter)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return deleter.Purge(ctx, before)
+}
+
+// History allowed to anyone
+func (up CameraPolicy) History(ctx context.Context, id string) ([]store.Revision, error) {
+	historian, ok := up.CameraStore.(store.Historian)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return historian.History(ctx, id)
+}
+
+// Revert allowed only to ROLE_ADMIN
+func (up CameraPolicy) Revert(ctx context.Context, id string, version string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return crud.ErrUnauthorized
+	}
+	historian, ok := up.CameraStore.(store.Historian)
+	if !ok {
+		return crud.ErrNotFound
+	}
+	return historian.Revert(ctx, id, version)
+}
+
+// Batch allowed to anyone, each operation in the batch enforces its own policy
+func (up CameraPolicy) Batch(ctx context.Context, f func(context.Context) error) error {
+	return up.CameraStore.Batch(ctx, f)
+}
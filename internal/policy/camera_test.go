@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/warpcomdev/videoapi/internal/auth"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	"github.com/warpcomdev/videoapi/internal/models"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// newCameraPolicy returns a policy over an in-memory store with one camera
+func newCameraPolicy(t *testing.T) CameraPolicy {
+	t.Helper()
+	cameras := store.NewMemory[models.Camera](models.CameraDescriptor().FilterSet)
+	camera := models.Camera{
+		Model:     models.Model{ID: "cam1"},
+		Name:      "camera 1",
+		Latitude:  40.4,
+		Longitude: -3.7,
+	}
+	if _, err := cameras.Post(context.Background(), camera); err != nil {
+		t.Fatal(err)
+	}
+	return CameraPolicy{CameraStore: cameras}
+}
+
+// withRole returns a context with the claims of a user with that role
+func withRole(role models.Role) context.Context {
+	return auth.NewContext(context.Background(), auth.Claims{Role: role, Name: "test"})
+}
+
+func TestCameraPostRoles(t *testing.T) {
+	tests := []struct {
+		ctx  context.Context
+		want error
+	}{
+		{ctx: context.Background(), want: crud.ErrorMissingRole},
+		{ctx: withRole(models.ROLE_READ_ONLY), want: crud.ErrUnauthorized},
+		{ctx: withRole(models.ROLE_READ_WRITE), want: crud.ErrUnauthorized},
+		{ctx: withRole(models.ROLE_SERVICE), want: crud.ErrUnauthorized},
+		{ctx: withRole(models.ROLE_ADMIN), want: nil},
+	}
+	for _, test := range tests {
+		cameras := newCameraPolicy(t)
+		camera := models.Camera{
+			Model:     models.Model{ID: "cam2"},
+			Name:      "camera 2",
+			Latitude:  41.4,
+			Longitude: 2.1,
+		}
+		if _, err := cameras.Post(test.ctx, camera); !errors.Is(err, test.want) {
+			t.Errorf("Post() = %v, want %v", err, test.want)
+		}
+	}
+}
+
+func TestCameraPatchReadWrite(t *testing.T) {
+	cameras := newCameraPolicy(t)
+	ctx := withRole(models.ROLE_READ_WRITE)
+	// Read-write users can only change the store path
+	if err := cameras.Patch(ctx, "cam1", models.Camera{Name: "renamed"}, []string{"NAME"}); !errors.Is(err, crud.ErrUnauthorized) {
+		t.Errorf("Patch(NAME) = %v, want %v", err, crud.ErrUnauthorized)
+	}
+	patch := models.Camera{
+		Name:      "renamed",
+		LocalPath: models.NullString{NullString: sql.NullString{String: "/media/cam1", Valid: true}},
+	}
+	if err := cameras.Patch(ctx, "cam1", patch, []string{"NAME", "LOCAL_PATH"}); err != nil {
+		t.Fatalf("Patch(NAME, LOCAL_PATH) = %v", err)
+	}
+	camera, err := cameras.GetById(ctx, "cam1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if camera.Name != "camera 1" {
+		t.Errorf("got name %q, want %q", camera.Name, "camera 1")
+	}
+	if camera.LocalPath.String != "/media/cam1" {
+		t.Errorf("got local path %q, want %q", camera.LocalPath.String, "/media/cam1")
+	}
+	if err := cameras.Patch(withRole(models.ROLE_READ_ONLY), "cam1", patch, []string{"LOCAL_PATH"}); !errors.Is(err, crud.ErrUnauthorized) {
+		t.Errorf("Patch() by read-only user = %v, want %v", err, crud.ErrUnauthorized)
+	}
+}
+
+func TestCameraTrash(t *testing.T) {
+	cameras := newCameraPolicy(t)
+	admin := withRole(models.ROLE_ADMIN)
+	if err := cameras.Delete(withRole(models.ROLE_READ_WRITE), "cam1"); !errors.Is(err, crud.ErrUnauthorized) {
+		t.Errorf("Delete() by read-write user = %v, want %v", err, crud.ErrUnauthorized)
+	}
+	if err := cameras.Delete(admin, "cam1"); err != nil {
+		t.Fatal(err)
+	}
+	trash := crud.Query{Limit: 10, Deleted: crud.DELETED_ONLY}
+	if _, err := cameras.Get(withRole(models.ROLE_READ_WRITE), trash); !errors.Is(err, crud.ErrUnauthorized) {
+		t.Errorf("Get(trash) by read-write user = %v, want %v", err, crud.ErrUnauthorized)
+	}
+	deleted, err := cameras.Get(admin, trash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != "cam1" {
+		t.Errorf("got trash %v, want cam1", deleted)
+	}
+	if err := cameras.Restore(admin, "cam1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cameras.GetById(admin, "cam1"); err != nil {
+		t.Errorf("GetById() after restore = %v", err)
+	}
+}
+
+func TestCameraStreamRoles(t *testing.T) {
+	tests := []struct {
+		role models.Role
+		want error
+	}{
+		{role: models.ROLE_READ_ONLY, want: crud.ErrUnauthorized},
+		{role: models.ROLE_READ_WRITE, want: nil},
+		{role: models.ROLE_SERVICE, want: nil},
+		{role: models.ROLE_ADMIN, want: nil},
+	}
+	cameras := newCameraPolicy(t)
+	for _, test := range tests {
+		count := 0
+		err := cameras.Stream(withRole(test.role), crud.Query{}, func(models.Camera) error {
+			count++
+			return nil
+		})
+		if !errors.Is(err, test.want) {
+			t.Errorf("Stream() by %s = %v, want %v", test.role, err, test.want)
+		}
+		if err == nil && count != 1 {
+			t.Errorf("Stream() by %s got %d cameras, want 1", test.role, count)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package policy
+
+import "github.com/warpcomdev/videoapi/internal/crud"
+
+// Columns the models ignore in patches, so they are always allowed
+var readOnlyColumns = []string{"ID", "CREATED_AT", "MODIFIED_AT", "DELETED_AT"}
+
+// allowColumns removes from the list any column not allowed
+func allowColumns(columns []string, allowed ...string) []string {
+	result := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if hasColumn(allowed, col) {
+			result = append(result, col)
+		}
+	}
+	return result
+}
+
+// hasColumn checks if the column is in the list
+func hasColumn(columns []string, col string) bool {
+	for _, c := range columns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// checkColumns fails if the list has any column not allowed,
+// instead of silently dropping it
+func checkColumns(columns []string, allowed ...string) error {
+	for _, col := range columns {
+		if !hasColumn(allowed, col) && !hasColumn(readOnlyColumns, col) {
+			return crud.ErrUnauthorized
+		}
+	}
+	return nil
+}
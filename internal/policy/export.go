@@ -0,0 +1,22 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/warpcomdev/videoapi/internal/auth"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	"github.com/warpcomdev/videoapi/internal/models"
+)
+
+// canExport checks the role is allowed to export whole collections.
+// Exports are not paginated, so read-only users are left out.
+func canExport(ctx context.Context) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN && claims.Role != models.ROLE_READ_WRITE && claims.Role != models.ROLE_SERVICE {
+		return crud.ErrUnauthorized
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package policy
 
 import (
 	"context"
+	"time"
 
 	"github.com/warpcomdev/videoapi/internal/auth"
 	"github.com/warpcomdev/videoapi/internal/crud"
@@ -19,14 +20,59 @@ func (up MediaPolicy) GetById(ctx context.Context, id string) (models.Media, err
 	return up.MediaStore.GetById(ctx, id)
 }
 
-// Get allowed to anyone
-func (up MediaPolicy) Get(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation, sort []string, ascending bool, offset, limit int) ([]models.Media, error) {
-	return up.MediaStore.Get(ctx, filter, outerOp, innerOp, sort, ascending, offset, limit)
+// Get allowed to anyone, the trash only to ROLE_ADMIN
+func (up MediaPolicy) Get(ctx context.Context, query crud.Query) ([]models.Media, error) {
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return nil, err
+	}
+	return up.MediaStore.Get(ctx, query)
+}
+
+// Count allowed to anyone, the trash only to ROLE_ADMIN
+func (up MediaPolicy) Count(ctx context.Context, query crud.Query) (uint64, error) {
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return 0, err
+	}
+	return up.MediaStore.Count(ctx, query)
+}
+
+// Tags allowed to anyone, the trash only to ROLE_ADMIN
+func (up MediaPolicy) Tags(ctx context.Context, query crud.Query) ([]store.TagCount, error) {
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return nil, err
+	}
+	counter, ok := up.MediaStore.(store.TagCounter)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return counter.Tags(ctx, query)
+}
+
+// Stats allowed to anyone, the trash only to ROLE_ADMIN
+func (up MediaPolicy) Stats(ctx context.Context, query crud.Query, agg crud.Aggregation) ([]store.StatCount, error) {
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return nil, err
+	}
+	aggregator, ok := up.MediaStore.(store.Aggregator)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return aggregator.Stats(ctx, query, agg)
 }
 
-// Get allowed to anyone
-func (up MediaPolicy) Count(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) (uint64, error) {
-	return up.MediaStore.Count(ctx, filter, outerOp, innerOp)
+// Stream allowed to anyone with write permissions
+func (up MediaPolicy) Stream(ctx context.Context, query crud.Query, f func(models.Media) error) error {
+	if err := canExport(ctx); err != nil {
+		return err
+	}
+	if err := canSeeDeleted(ctx, query); err != nil {
+		return err
+	}
+	streamer, ok := up.MediaStore.(store.Streamer[models.Media])
+	if !ok {
+		return crud.ErrInvalidFormat
+	}
+	return streamer.Stream(ctx, query, f)
 }
 
 // Post denied to READ_OMLY role
@@ -54,9 +100,28 @@ func (up MediaPolicy) Put(ctx context.Context, id string, data models.Media) err
 	}
 	// People cannot change the media URL, it will be automatically set by the system
 	data.MediaURL.Valid = false
+	// Neither the thumbnails, that are set along with the media URL
+	data.ThumbnailURL = models.NullString{}
+	data.PreviewURL = models.NullString{}
 	return up.MediaStore.Put(ctx, id, data)
 }
 
+// Patch denied to READ_ONLY role
+func (up MediaPolicy) Patch(ctx context.Context, id string, data models.Media, columns []string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN && claims.Role != models.ROLE_READ_WRITE && claims.Role != models.ROLE_SERVICE {
+		return crud.ErrUnauthorized
+	}
+	// People cannot change the media URL, it will be automatically set by the system
+	if err := checkColumns(columns, "TIMESTAMP", "TAGS"); err != nil {
+		return err
+	}
+	return up.MediaStore.Patch(ctx, id, data, columns)
+}
+
 // Delete denied to READ_ONLY role
 func (up MediaPolicy) Delete(ctx context.Context, id string) error {
 	claims, err := auth.ClaimsFrom(ctx)
@@ -68,3 +133,40 @@ func (up MediaPolicy) Delete(ctx context.Context, id string) error {
 	}
 	return up.MediaStore.Delete(ctx, id)
 }
+
+// Restore allowed to the same roles as Delete
+func (up MediaPolicy) Restore(ctx context.Context, id string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN && claims.Role != models.ROLE_READ_WRITE {
+		return crud.ErrUnauthorized
+	}
+	deleter, ok := up.MediaStore.(store.SoftDeleter)
+	if !ok {
+		return crud.ErrNotFound
+	}
+	return deleter.Restore(ctx, id)
+}
+
+// Purge allowed only to ROLE_ADMIN
+func (up MediaPolicy) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return nil, crud.ErrUnauthorized
+	}
+	deleter, ok := up.MediaStore.(store.SoftDeleter)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return deleter.Purge(ctx, before)
+}
+
+// Batch allowed to anyone, each operation in the batch enforces its own policy
+func (up MediaPolicy) Batch(ctx context.Context, f func(context.Context) error) error {
+	return up.MediaStore.Batch(ctx, f)
+}
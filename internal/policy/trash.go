@@ -0,0 +1,25 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/warpcomdev/videoapi/internal/auth"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	"github.com/warpcomdev/videoapi/internal/models"
+)
+
+// canSeeDeleted checks the role is allowed to list the trash,
+// if the query includes deleted resources.
+func canSeeDeleted(ctx context.Context, query crud.Query) error {
+	if query.Deleted == crud.DELETED_EXCLUDE {
+		return nil
+	}
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return crud.ErrUnauthorized
+	}
+	return nil
+}
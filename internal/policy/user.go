@@ -35,7 +35,7 @@ func (up UserPolicy) GetById(ctx context.Context, id string) (zero models.User,
 }
 
 // Get denied except to ROLE_ADMIN
-func (up UserPolicy) Get(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation, sort []string, ascending bool, offset, limit int) ([]models.User, error) {
+func (up UserPolicy) Get(ctx context.Context, query crud.Query) ([]models.User, error) {
 	claims, err := auth.ClaimsFrom(ctx)
 	if err != nil {
 		return nil, err
@@ -44,7 +44,7 @@ func (up UserPolicy) Get(ctx context.Context, filter []crud.Filter, outerOp crud
 		return nil, crud.ErrUnauthorized
 	}
 	// Hide hash from returned values
-	users, err := up.UserStore.Get(ctx, filter, outerOp, innerOp, sort, ascending, offset, limit)
+	users, err := up.UserStore.Get(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +56,7 @@ func (up UserPolicy) Get(ctx context.Context, filter []crud.Filter, outerOp crud
 }
 
 // Count denied except to ROLE_ADMIN
-func (up UserPolicy) Count(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) (uint64, error) {
+func (up UserPolicy) Count(ctx context.Context, query crud.Query) (uint64, error) {
 	claims, err := auth.ClaimsFrom(ctx)
 	if err != nil {
 		return 0, err
@@ -65,13 +65,33 @@ func (up UserPolicy) Count(ctx context.Context, filter []crud.Filter, outerOp cr
 		return 0, crud.ErrUnauthorized
 	}
 	// Hide hash from returned values
-	users, err := up.UserStore.Count(ctx, filter, outerOp, innerOp)
+	users, err := up.UserStore.Count(ctx, query)
 	if err != nil {
 		return 0, err
 	}
 	return users, nil
 }
 
+// Stream denied except to ROLE_ADMIN
+func (up UserPolicy) Stream(ctx context.Context, query crud.Query, f func(models.User) error) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		return crud.ErrUnauthorized
+	}
+	streamer, ok := up.UserStore.(store.Streamer[models.User])
+	if !ok {
+		return crud.ErrInvalidFormat
+	}
+	// Hide hash from returned values
+	return streamer.Stream(ctx, query, func(user models.User) error {
+		user.Password = ""
+		return f(user)
+	})
+}
+
 // Post only allowed to admin role
 func (up UserPolicy) Post(ctx context.Context, data models.User) (string, error) {
 	claims, err := auth.ClaimsFrom(ctx)
@@ -109,6 +129,32 @@ func (up UserPolicy) Put(ctx context.Context, id string, data models.User) error
 	return up.UserStore.Put(ctx, id, data)
 }
 
+// Patch restricted depending on role
+func (up UserPolicy) Patch(ctx context.Context, id string, data models.User, columns []string) error {
+	claims, err := auth.ClaimsFrom(ctx)
+	if err != nil {
+		return err
+	}
+	changesRole := hasColumn(columns, "ROLE")
+	if claims.ID == id {
+		// No user can change its own role
+		if changesRole {
+			return crud.ErrUnauthorized
+		}
+	}
+	if claims.Role != models.ROLE_ADMIN {
+		// Only admin can change other users
+		if claims.Subject != id {
+			return crud.ErrUnauthorized
+		}
+		// Only admin can change user roles
+		if changesRole {
+			return crud.ErrUnauthorized
+		}
+	}
+	return up.UserStore.Patch(ctx, id, data, columns)
+}
+
 // Delete only allowed to admin role
 func (up UserPolicy) Delete(ctx context.Context, id string) error {
 	claims, err := auth.ClaimsFrom(ctx)
@@ -125,3 +171,8 @@ func (up UserPolicy) Delete(ctx context.Context, id string) error {
 	}
 	return up.UserStore.Delete(ctx, id)
 }
+
+// Batch allowed to anyone, each operation in the batch enforces its own policy
+func (up UserPolicy) Batch(ctx context.Context, f func(context.Context) error) error {
+	return up.UserStore.Batch(ctx, f)
+}
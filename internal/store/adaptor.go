@@ -3,8 +3,13 @@ package store
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
+	"net/http"
+	"reflect"
+	"sort"
 
 	"github.com/warpcomdev/videoapi/internal/crud"
 )
@@ -14,13 +19,18 @@ type Resource[T any] interface {
 	// Get resource by id
 	GetById(context.Context, string) (T, error)
 	// Get resource by filter
-	Get(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation, sort []string, ascending bool, offset, limit int) ([]T, error)
-	// Count resource by filter
-	Count(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) (uint64, error)
+	Get(ctx context.Context, query crud.Query) ([]T, error)
+	// Count resource by filter, ignores sort and pagination
+	Count(ctx context.Context, query crud.Query) (uint64, error)
 	// Post (create) new resource, return id
 	Post(ctx context.Context, data T) (string, error)
 	// Put (update) resource
 	Put(ctx context.Context, id string, data T) error
+	// Patch (update) only the given columns of the resource
+	Patch(ctx context.Context, id string, data T, columns []string) error
+	// Batch runs all operations made with the provided context in a single
+	// transaction, committed only if f returns nil. Can be nested.
+	Batch(ctx context.Context, f func(ctx context.Context) error) error
 	// Delete resource by id
 	Delete(context.Context, string) error
 }
@@ -31,55 +41,125 @@ type Adaptor[T any] struct {
 }
 
 // Get resource by id
-func (vr Adaptor[T]) GetById(ctx context.Context, id string) (io.ReadCloser, error) {
+func (vr Adaptor[T]) GetById(ctx context.Context, id string, fields []string) (io.ReadCloser, error) {
+	if err := checkFields(reflect.TypeOf(*new(T)), fields); err != nil {
+		return nil, err
+	}
 	v, err := vr.Resource.GetById(ctx, id)
 	if err != nil {
+		// Including resources in the trash
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, crud.ErrNotFound
+		}
 		return nil, err
 	}
-	data, err := json.Marshal(v)
+	var data []byte
+	if len(fields) > 0 {
+		data, err = project(reflect.ValueOf(v), fields)
+	} else {
+		data, err = json.Marshal(v)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return io.NopCloser(bytes.NewReader(data)), nil
+	reader := io.NopCloser(bytes.NewReader(data))
+	if versioned, ok := any(v).(Versioned); ok {
+		return taggedReader{ReadCloser: reader, etag: crud.ETag(versioned.GetVersion())}, nil
+	}
+	return reader, nil
+}
+
+// taggedReader implements crud.Tagged
+type taggedReader struct {
+	io.ReadCloser
+	etag string
+}
+
+// ETag implements crud.Tagged
+func (t taggedReader) ETag() string {
+	return t.etag
+}
+
+// typedReader implements crud.Typed
+type typedReader struct {
+	io.ReadCloser
+	contentType string
+}
+
+// ContentType implements crud.Typed
+func (t typedReader) ContentType() string {
+	return t.contentType
 }
 
-type getResult[T any] struct {
-	Data  []T    `json:"data"`
-	Next  string `json:"next"`
-	Prev  string `json:"prev"`
-	Count uint64 `json:"count,omitempty"`
+type getResult struct {
+	// Either []T, or the projected rows
+	Data  interface{} `json:"data"`
+	Next  string      `json:"next"`
+	Prev  string      `json:"prev"`
+	Count uint64      `json:"count,omitempty"`
 }
 
 // Get resource list
-func (vr Adaptor[T]) Get(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation, sort []string, ascending bool, offset, limit int, count bool) (io.ReadCloser, error) {
+func (vr Adaptor[T]) Get(ctx context.Context, query crud.Query, count bool) (io.ReadCloser, error) {
 	var (
 		resultCount uint64
 		err         error
 	)
+	t := reflect.TypeOf(*new(T))
+	if err := checkFields(t, query.Fields); err != nil {
+		return nil, err
+	}
+	geoJson := query.Format == crud.FORMAT_GEOJSON
+	if geoJson && !hasPosition(t) {
+		return nil, crud.ErrInvalidFormat
+	}
 	if count {
-		resultCount, err = vr.Resource.Count(ctx, filter, outerOp, innerOp)
+		resultCount, err = vr.Resource.Count(ctx, query)
 		if err != nil {
 			return nil, err
 		}
 	}
-	vs, err := vr.Resource.Get(ctx, filter, outerOp, innerOp, sort, ascending, offset, limit)
+	storeQuery := query
+	if geoJson {
+		storeQuery.Fields = withPosition(t, query.Fields)
+	}
+	vs, err := vr.Resource.Get(ctx, storeQuery)
 	if err != nil {
 		return nil, err
 	}
 	if vs == nil {
 		vs = make([]T, 0)
 	}
-	result := getResult[T]{
+	result := getResult{
 		Data:  vs,
 		Next:  "",
 		Prev:  "",
 		Count: resultCount,
 	}
-	if len(vs) >= limit {
-		result.Next = crud.Next(filter, outerOp, innerOp, sort, ascending, offset, limit)
+	if err := vr.navigate(&result, vs, query); err != nil {
+		return nil, err
+	}
+	if geoJson {
+		collection, err := featureCollection(result, vs, query.Fields)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(collection)
+		if err != nil {
+			return nil, err
+		}
+		return typedReader{ReadCloser: io.NopCloser(bytes.NewReader(data)), contentType: geoJsonContentType}, nil
 	}
-	if offset > 0 {
-		result.Prev = crud.Prev(filter, outerOp, innerOp, sort, ascending, offset, limit)
+	if len(query.Fields) > 0 {
+		rows := make([]json.RawMessage, 0, len(vs))
+		for idx := range vs {
+			row, err := project(reflect.ValueOf(vs[idx]), query.Fields)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+		result.Data = rows
 	}
 	data, err := json.Marshal(result)
 	if err != nil {
@@ -88,6 +168,62 @@ func (vr Adaptor[T]) Get(ctx context.Context, filter []crud.Filter, outerOp crud
 	return io.NopCloser(bytes.NewReader(data)), nil
 }
 
+// navigate fills the Next and Prev links. Once there are rows, links
+// are cursors to the first and last of them, so that pages do not skip
+// or repeat rows when others are inserted or removed meanwhile.
+func (vr Adaptor[T]) navigate(result *getResult, vs []T, query crud.Query) error {
+	var (
+		hasNext = len(vs) >= query.Limit
+		hasPrev bool
+		err     error
+	)
+	switch {
+	case query.Cursor == nil:
+		hasPrev = query.Offset > 0
+	case query.Cursor.Backward:
+		// Seeking backwards, there are rows after the cursor
+		hasNext, hasPrev = true, len(vs) >= query.Limit
+	default:
+		hasPrev = true
+	}
+	if len(vs) == 0 {
+		// Without rows, there is no position to build cursors from
+		if query.Cursor != nil {
+			return nil
+		}
+		if hasNext {
+			result.Next, err = crud.Next(query, nil)
+			if err != nil {
+				return err
+			}
+		}
+		if hasPrev {
+			result.Prev, err = crud.Prev(query, nil)
+		}
+		return err
+	}
+	key := query.SortKey()
+	if hasNext {
+		cursor, err := cursorAt(&vs[len(vs)-1], key, false)
+		if err != nil {
+			return err
+		}
+		if result.Next, err = crud.Next(query, cursor); err != nil {
+			return err
+		}
+	}
+	if hasPrev {
+		cursor, err := cursorAt(&vs[0], key, true)
+		if err != nil {
+			return err
+		}
+		if result.Prev, err = crud.Prev(query, cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type postResult struct {
 	ID string `json:"id"`
 }
@@ -124,11 +260,140 @@ func (vr Adaptor[T]) Put(ctx context.Context, id string, r io.Reader) error {
 	return nil
 }
 
+// Patch resource with a json merge patch (RFC 7396).
+// Attributes missing from the patch are not changed,
+// and explicit nulls clear the attribute.
+func (vr Adaptor[T]) Patch(ctx context.Context, id string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return vr.patch(ctx, id, data)
+}
+
+// patch decodes and applies the merge patch
+func (vr Adaptor[T]) patch(ctx context.Context, id string, data []byte) error {
+	var attribs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attribs); err != nil || attribs == nil {
+		return crud.ErrInvalidPatch
+	}
+	var orig T
+	if err := json.Unmarshal(data, &orig); err != nil {
+		return err
+	}
+	known := attribsOf(reflect.TypeOf(orig))
+	columns := make([]string, 0, len(attribs))
+	for name, raw := range attribs {
+		attrib, ok := known[name]
+		if !ok {
+			return crud.ErrInvalidAttribute
+		}
+		if !attrib.Nullable && bytes.Equal(raw, []byte("null")) {
+			return crud.ErrInvalidAttribute
+		}
+		columns = append(columns, attrib.Column)
+	}
+	// Keep the order stable, so the query text is the same for equal patches
+	sort.Strings(columns)
+	return vr.Resource.Patch(ctx, id, orig, columns)
+}
+
 // Delete resource by id
 func (vr Adaptor[T]) Delete(ctx context.Context, id string) error {
 	return vr.Resource.Delete(ctx, id)
 }
 
+// Bulk runs the operations in a single transaction. Unless atomic, each
+// operation runs in a savepoint, and only the failed ones are rolled back.
+func (vr Adaptor[T]) Bulk(ctx context.Context, ops []crud.BulkOperation, atomic bool) (io.ReadCloser, error) {
+	result := crud.BulkResponse{
+		Committed: true,
+		Results:   make([]crud.BulkResult, len(ops)),
+	}
+	err := vr.Resource.Batch(ctx, func(ctx context.Context) error {
+		for idx, op := range ops {
+			item := &result.Results[idx]
+			item.Op, item.ID = op.Op, op.ID
+			var err error
+			if atomic {
+				err = vr.bulkApply(ctx, op, item)
+			} else {
+				err = vr.Resource.Batch(ctx, func(ctx context.Context) error {
+					return vr.bulkApply(ctx, op, item)
+				})
+			}
+			if err == nil {
+				continue
+			}
+			item.Status, item.Error = crud.ErrorStatus(err)
+			if atomic {
+				for next := idx + 1; next < len(ops); next++ {
+					skipped := &result.Results[next]
+					skipped.Op, skipped.ID = ops[next].Op, ops[next].ID
+					skipped.Status, skipped.Error = crud.ErrorStatus(crud.ErrBulkAborted)
+				}
+				return crud.ErrBulkAborted
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, crud.ErrBulkAborted) {
+			return nil, err
+		}
+		result.Committed = false
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// bulkApply runs a single bulk operation
+func (vr Adaptor[T]) bulkApply(ctx context.Context, op crud.BulkOperation, item *crud.BulkResult) error {
+	if !op.Valid() {
+		return crud.ErrInvalidBulkOperation
+	}
+	var tags []string
+	if op.IfMatch != "" {
+		tags = []string{op.IfMatch}
+	}
+	// Replaces the If-Match header of the bulk request, if any
+	ctx = crud.WithIfMatch(ctx, tags)
+	var orig T
+	switch op.Op {
+	case crud.BULK_CREATE:
+		if err := json.Unmarshal(op.Data, &orig); err != nil {
+			return crud.ErrInvalidJson
+		}
+		id, err := vr.Resource.Post(ctx, orig)
+		if err != nil {
+			return err
+		}
+		item.ID, item.Status = id, http.StatusCreated
+	case crud.BULK_UPDATE:
+		if err := json.Unmarshal(op.Data, &orig); err != nil {
+			return crud.ErrInvalidJson
+		}
+		if err := vr.Resource.Put(ctx, op.ID, orig); err != nil {
+			return err
+		}
+		item.Status = http.StatusNoContent
+	case crud.BULK_PATCH:
+		if err := vr.patch(ctx, op.ID, op.Data); err != nil {
+			return err
+		}
+		item.Status = http.StatusNoContent
+	case crud.BULK_DELETE:
+		if err := vr.Resource.Delete(ctx, op.ID); err != nil {
+			return err
+		}
+		item.Status = http.StatusNoContent
+	}
+	return nil
+}
+
 // Adapt builds a resource for the given model
 func Adapt[T any](resource Resource[T]) Adaptor[T] {
 	return Adaptor[T]{
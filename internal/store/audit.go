@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+)
+
+// Action is the kind of change made to a resource
+type Action string
+
+const (
+	ACTION_CREATE  Action = "create"
+	ACTION_UPDATE  Action = "update"
+	ACTION_PATCH   Action = "patch"
+	ACTION_DELETE  Action = "delete"
+	ACTION_RESTORE Action = "restore"
+	ACTION_PURGE   Action = "purge"
+	ACTION_REVERT  Action = "revert"
+)
+
+// Change made to a resource. Before is nil for created resources,
+// and After is nil for resources removed from the table.
+type Change struct {
+	Action Action
+	ID     string
+	Before any
+	After  any
+}
+
+// Auditor records the changes made to a resource. It runs in the same
+// transaction as the change, so a failure rolls back the change.
+type Auditor interface {
+	Audit(ctx context.Context, change Change) error
+}
+
+// WithAuditor returns a copy of the resource that records
+// every change with the given auditor
+func (r SQLResource[T, P]) WithAuditor(auditor Auditor) SQLResource[T, P] {
+	r.auditor = auditor
+	return r
+}
+
+// audited runs the change in a batch, and records it with the state of
+// the resource before and after. If the resource has history, the state
+// before is saved as a revision. The change returns the id of the resource.
+func (r SQLResource[T, P]) audited(ctx context.Context, action Action, id string, change func(context.Context) (string, error)) (string, error) {
+	if r.auditor == nil && r.history == "" {
+		return change(ctx)
+	}
+	var changed string
+	err := r.Batch(ctx, func(ctx context.Context) error {
+		// Concurrent changes wait here, so they do not see the same state before
+		if err := r.lock(ctx, id); err != nil {
+			return err
+		}
+		before, err := r.snapshot(ctx, id)
+		if err != nil {
+			return err
+		}
+		if changed, err = change(ctx); err != nil {
+			return err
+		}
+		after, err := r.snapshot(ctx, changed)
+		if err != nil {
+			return err
+		}
+		// Nothing changed, e.g. deleting a missing resource
+		if reflect.DeepEqual(before, after) {
+			return nil
+		}
+		if before != nil && r.history != "" {
+			if err := r.saveRevision(ctx, action, changed, before); err != nil {
+				return err
+			}
+		}
+		if r.auditor == nil {
+			return nil
+		}
+		return r.auditor.Audit(ctx, Change{
+			Action: action,
+			ID:     changed,
+			Before: before,
+			After:  after,
+		})
+	})
+	return changed, err
+}
+
+// lock the row of the resource until the end of the batch. There
+// is no FOR UPDATE in sqlite, so it updates the version to itself.
+func (r SQLResource[T, P]) lock(ctx context.Context, id string) error {
+	if id == "" {
+		return nil
+	}
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := "UPDATE " + r.tableName + " SET " + VersionColumn + "=" + VersionColumn + " WHERE id=:ID"
+	// Map keys are not folded by the mapper, unlike struct tags
+	stmt, args, err := tx.PrepareNamed(ctx, query, map[string]interface{}{"ID": id})
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if _, err := stmt.Execute(ctx, args...); err != nil {
+		return QueryError{
+			Message: "failed to lock resource",
+			Query:   query,
+			Params:  id,
+			Cause:   err,
+		}
+	}
+	return tx.Commit()
+}
+
+// snapshot returns the resource with the given id, or nil if there is none
+func (r SQLResource[T, P]) snapshot(ctx context.Context, id string) (any, error) {
+	if id == "" {
+		return nil, nil
+	}
+	// Deleting and restoring change resources in the trash
+	t, err := r.getById(ctx, id, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Field indexes of each model type, by upper-cased column name
+var typeFields sync.Map
+
+// Json attributes of each model type, by json name
+var typeAttribs sync.Map
+
+// jsonAttrib describes the column behind a json attribute
+type jsonAttrib struct {
+	Column string
+	// Structs (NullString, time.Time...) decide themselves what null means,
+	// other types can not be null.
+	Nullable bool
+}
+
+// fieldsOf returns the index of every column in the model type
+func fieldsOf(t reflect.Type) map[string][]int {
+	if cached, ok := typeFields.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	if t.Kind() == reflect.Struct {
+		dbFields(t, nil, fields)
+	}
+	typeFields.Store(t, fields)
+	return fields
+}
+
+// dbFields finds the index of every field with a `db` tag,
+// including those in embedded structs.
+func dbFields(t reflect.Type, index []int, fields map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		tag, ok := field.Tag.Lookup("db")
+		if !ok {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				dbFields(field.Type, fieldIndex, fields)
+			}
+			continue
+		}
+		if tag != "" && tag != "-" {
+			fields[strings.ToUpper(tag)] = fieldIndex
+		}
+	}
+}
+
+// attribsOf returns the column behind every json attribute of the model type
+func attribsOf(t reflect.Type) map[string]jsonAttrib {
+	if cached, ok := typeAttribs.Load(t); ok {
+		return cached.(map[string]jsonAttrib)
+	}
+	attribs := make(map[string]jsonAttrib)
+	if t.Kind() == reflect.Struct {
+		jsonAttribs(t, attribs)
+	}
+	typeAttribs.Store(t, attribs)
+	return attribs
+}
+
+// jsonAttribs finds the json name of every field with a `db` tag,
+// including those in embedded structs.
+func jsonAttribs(t reflect.Type, attribs map[string]jsonAttrib) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("db")
+		if !ok {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				jsonAttribs(field.Type, attribs)
+			}
+			continue
+		}
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := field.Name
+		if jsonTag, ok := field.Tag.Lookup("json"); ok {
+			if jsonName, _, _ := strings.Cut(jsonTag, ","); jsonName != "" {
+				name = jsonName
+			}
+		}
+		if name == "-" {
+			continue
+		}
+		attribs[name] = jsonAttrib{
+			Column:   strings.ToUpper(tag),
+			Nullable: field.Type.Kind() == reflect.Struct,
+		}
+	}
+}
+
+// attribNames returns the json attributes of the model type, in field order
+func attribNames(t reflect.Type) []string {
+	attribs := attribsOf(t)
+	index := fieldsOf(t)
+	names := make([]string, 0, len(attribs))
+	for name := range attribs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := index[attribs[names[i]].Column], index[attribs[names[j]].Column]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return names
+}
+
+// checkFields fails if any of the fields is not a json attribute of the model type
+func checkFields(t reflect.Type, fields []string) error {
+	attribs := attribsOf(t)
+	for _, field := range fields {
+		if _, ok := attribs[field]; !ok {
+			return crud.ErrInvalidField
+		}
+	}
+	return nil
+}
+
+// checkSort fails if any column of the sort key cannot be filtered.
+// The distance is checked along with the geo filter.
+func checkSort(columns map[string]DbType, key []string) error {
+	for _, col := range key {
+		if strings.EqualFold(col, DistanceColumn) {
+			continue
+		}
+		if _, ok := columns[strings.ToLower(col)]; !ok {
+			return crud.ErrInvalidColumn
+		}
+	}
+	return nil
+}
+
+// selectColumns returns the columns behind the given fields, plus the
+// sort key needed to build cursors. Returns nil (all columns) if no fields.
+func selectColumns(t reflect.Type, fields []string, key []string) ([]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	attribs := attribsOf(t)
+	columns := make([]string, 0, len(fields)+len(key))
+	seen := make(map[string]struct{}, len(fields)+len(key))
+	for _, field := range fields {
+		attrib, ok := attribs[field]
+		if !ok {
+			return nil, crud.ErrInvalidField
+		}
+		if _, ok := seen[attrib.Column]; !ok {
+			seen[attrib.Column] = struct{}{}
+			columns = append(columns, attrib.Column)
+		}
+	}
+	for _, col := range key {
+		upper := strings.ToUpper(col)
+		if _, ok := seen[upper]; !ok {
+			seen[upper] = struct{}{}
+			columns = append(columns, upper)
+		}
+	}
+	return columns, nil
+}
+
+// project marshals only the given json attributes of the row,
+// in the same order. Fields must have been checked before.
+func project(row reflect.Value, fields []string) (json.RawMessage, error) {
+	attribs := attribsOf(row.Type())
+	index := fieldsOf(row.Type())
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for idx, field := range fields {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row.FieldByIndex(index[attribs[field].Column]).Interface())
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// columnValue returns the column value of the given row, as the driver would see it
+func columnValue(fields map[string][]int, row reflect.Value, column string) (driver.Value, error) {
+	index, ok := fields[strings.ToUpper(column)]
+	if !ok {
+		return nil, fmt.Errorf("column %s does not exist", column)
+	}
+	field := row.FieldByIndex(index)
+	// Optional attributes
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
+	}
+	if valuer, ok := field.Interface().(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(field.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), nil
+	case reflect.Bool:
+		return field.Bool(), nil
+	}
+	return field.Interface(), nil
+}
+
+// cursorAt builds a cursor positioned at the given row
+func cursorAt[T any](t *T, key []string, backward bool) (*crud.Cursor, error) {
+	row := reflect.ValueOf(t).Elem()
+	fields := fieldsOf(row.Type())
+	cursor := &crud.Cursor{
+		Values:   make([]driver.Value, 0, len(key)),
+		Backward: backward,
+	}
+	for _, col := range key {
+		v, err := columnValue(fields, row, col)
+		if err != nil {
+			return nil, err
+		}
+		cursor.Values = append(cursor.Values, v)
+	}
+	return cursor, nil
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Names of the supported SQL dialects
+const (
+	ORACLE   = "oracle"
+	POSTGRES = "postgres"
+	SQLITE   = "sqlite"
+)
+
+// Dialect collects the peculiarities of a SQL backend
+type Dialect struct {
+	// Name of the dialect, used to select the proper DDL
+	Name string
+	// Limiter builds the pagination clause
+	Limiter Limiter
+	// Rebind replaces '?' placeholders with the ones expected by the driver
+	Rebind func(query string) string
+	// Fold changes the case of unquoted identifiers the way the database does
+	Fold func(identifier string) string
+	// Bind adapts a parameter value before sending it to the database.
+	// Can be nil if the driver handles all values properly.
+	Bind func(value any) any
+	// ReleaseSavepoint is true if the database supports "RELEASE SAVEPOINT"
+	ReleaseSavepoint bool
+	// Like builds a case sensitive condition for the column to match
+	// the pattern, with the LIKE wildcards, and the parameter to bind.
+	Like func(column string, pattern string) (string, any)
+	// JsonContains builds the condition for a column with a json array
+	// of strings to contain the value, and the parameter to bind.
+	JsonContains func(column string, value string) (string, any)
+	// JsonElements builds a FROM clause item that expands the json array
+	// of strings in a column to one row per element, and the expression
+	// to select the element. It can follow the table in the FROM clause.
+	JsonElements func(column string) (string, string)
+	// TimeBucket truncates a timestamp column to the start of the
+	// hour, day or week (monday) it belongs to, in UTC.
+	TimeBucket func(column string, bucket crud.Bucket) string
+}
+
+// BindArgs applies the dialect's Bind function to a list of parameters
+func (d Dialect) BindArgs(args []any) []any {
+	if d.Bind == nil {
+		return args
+	}
+	result := make([]any, 0, len(args))
+	for _, arg := range args {
+		result = append(result, d.Bind(arg))
+	}
+	return result
+}
+
+// Oracle dialect, for the go-ora driver
+func Oracle() Dialect {
+	return Dialect{
+		Name:    ORACLE,
+		Limiter: oracleLimiter,
+		Rebind: func(query string) string {
+			return numberPlaceholders(query, ":")
+		},
+		Fold: strings.ToUpper,
+		Like: standardLike,
+		JsonContains: func(column string, value string) (string, any) {
+			return fmt.Sprintf(`JSON_EXISTS(%s, '$[*]?(@ == $v)' PASSING ? AS "v")`, column), value
+		},
+		JsonElements: func(column string) (string, string) {
+			return fmt.Sprintf("JSON_TABLE(%s, '$[*]' COLUMNS (ELEMENT VARCHAR2(256) PATH '$')) JE", column), "JE.ELEMENT"
+		},
+		TimeBucket: func(column string, bucket crud.Bucket) string {
+			format := map[crud.Bucket]string{
+				crud.BUCKET_HOUR: "HH24",
+				crud.BUCKET_DAY:  "DD",
+				crud.BUCKET_WEEK: "IW",
+			}[bucket]
+			return fmt.Sprintf("TRUNC(SYS_EXTRACT_UTC(%s), '%s')", column, format)
+		},
+	}
+}
+
+// Postgres dialect, for the lib/pq driver
+func Postgres() Dialect {
+	return Dialect{
+		Name:    POSTGRES,
+		Limiter: standardLimiter,
+		Rebind: func(query string) string {
+			return numberPlaceholders(query, "$")
+		},
+		Fold:             strings.ToLower,
+		ReleaseSavepoint: true,
+		Like:             standardLike,
+		// The jsonb operators ?, ?| and ?& can not be used,
+		// because of the placeholders. Containment works the same.
+		JsonContains: func(column string, value string) (string, any) {
+			array, _ := json.Marshal([]string{value})
+			return fmt.Sprintf("%s::jsonb @> ?::jsonb", column), string(array)
+		},
+		JsonElements: func(column string) (string, string) {
+			return fmt.Sprintf("jsonb_array_elements_text(%s::jsonb) AS JE(ELEMENT)", column), "JE.ELEMENT"
+		},
+		TimeBucket: func(column string, bucket crud.Bucket) string {
+			return fmt.Sprintf("date_trunc('%s', %s AT TIME ZONE 'UTC')", bucket, column)
+		},
+	}
+}
+
+// Sqlite dialect, for the modernc.org/sqlite driver
+func Sqlite() Dialect {
+	return Dialect{
+		Name:    SQLITE,
+		Limiter: standardLimiter,
+		// sqlite understands '?' placeholders
+		Rebind: func(query string) string {
+			return query
+		},
+		Fold:             strings.ToUpper,
+		Bind:             sqliteBind,
+		ReleaseSavepoint: true,
+		// LIKE is case insensitive in sqlite, GLOB is not
+		Like: func(column string, pattern string) (string, any) {
+			return fmt.Sprintf("%s GLOB ?", column), globPattern(pattern)
+		},
+		JsonContains: func(column string, value string) (string, any) {
+			return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE json_each.value = ?)", column), value
+		},
+		JsonElements: func(column string) (string, string) {
+			return fmt.Sprintf("json_each(%s) AS JE", column), "JE.value"
+		},
+		// Timestamps are fixed width UTC strings, see sqliteTimeFormat
+		TimeBucket: func(column string, bucket crud.Bucket) string {
+			switch bucket {
+			case crud.BUCKET_HOUR:
+				return fmt.Sprintf("substr(%s, 1, 13) || ':00:00Z'", column)
+			case crud.BUCKET_WEEK:
+				return fmt.Sprintf("date(substr(%s, 1, 10), '-6 days', 'weekday 1') || ' 00:00:00Z'", column)
+			}
+			return fmt.Sprintf("substr(%s, 1, 10) || ' 00:00:00Z'", column)
+		},
+	}
+}
+
+// Builds a LIKE condition, case sensitive in oracle and postgres
+func standardLike(column string, pattern string) (string, any) {
+	return fmt.Sprintf("%s like ?", column), pattern
+}
+
+// globPattern turns the LIKE wildcards into GLOB ones,
+// and escapes the GLOB wildcards within brackets.
+func globPattern(pattern string) string {
+	return strings.NewReplacer(
+		"%", "*",
+		"_", "?",
+		"*", "[*]",
+		"?", "[?]",
+		"[", "[[]",
+	).Replace(pattern)
+}
+
+// Builds a "OFFSET x LIMIT x" clause the oracle way
+func oracleLimiter(offset, limit int) string {
+	return fmt.Sprintf("OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+}
+
+// Builds a "LIMIT x OFFSET x" clause, as postgres and sqlite do
+func standardLimiter(offset, limit int) string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+// Sqlite has no time type, timestamps are stored as text. This format
+// has fixed width and is parsed back to time.Time by the driver.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000-07:00"
+
+// sqliteBind turns times into UTC strings, so that comparisons and sorting
+// done by TimeDbType filters work lexicographically.
+func sqliteBind(value any) any {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			// Let the driver report the error
+			return value
+		}
+		value = v
+	}
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(sqliteTimeFormat)
+	}
+	return value
+}
+
+// numberPlaceholders replaces every '?' by consecutive <prefix>1, <prefix>2, etc.
+// Question marks inside string literals, like oracle json paths, are kept.
+func numberPlaceholders(query string, prefix string) string {
+	// for some reason, go-ora does not seem to replace placeholders properly,
+	// and postgres does not understand '?' at all.
+	var sb strings.Builder
+	match := 1
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			// escaped quotes ('') toggle twice, and stay quoted
+			quoted = !quoted
+		case r == '?' && !quoted:
+			sb.WriteString(prefix)
+			sb.WriteString(strconv.Itoa(match))
+			match += 1
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
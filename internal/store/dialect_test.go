@@ -0,0 +1,74 @@
+package store
+
+import "testing"
+
+func TestJsonContainsRebind(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		query   string
+		param   any
+	}{
+		{
+			dialect: Oracle(),
+			query:   `CAMERA = :1 AND JSON_EXISTS(TAGS, '$[*]?(@ == $v)' PASSING :2 AS "v") AND TIMESTAMP > :3`,
+			param:   "red",
+		},
+		{
+			dialect: Postgres(),
+			query:   `CAMERA = $1 AND TAGS::jsonb @> $2::jsonb AND TIMESTAMP > $3`,
+			param:   `["red"]`,
+		},
+		{
+			dialect: Sqlite(),
+			query:   `CAMERA = ? AND EXISTS (SELECT 1 FROM json_each(TAGS) WHERE json_each.value = ?) AND TIMESTAMP > ?`,
+			param:   "red",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.dialect.Name, func(t *testing.T) {
+			condition, param := test.dialect.JsonContains("TAGS", "red")
+			query := test.dialect.Rebind("CAMERA = ? AND " + condition + " AND TIMESTAMP > ?")
+			if query != test.query {
+				t.Errorf("got query %s, want %s", query, test.query)
+			}
+			if param != test.param {
+				t.Errorf("got param %v, want %v", param, test.param)
+			}
+		})
+	}
+}
+
+func TestNumberPlaceholders(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "A = ? AND B = ?", want: "A = :1 AND B = :2"},
+		{query: "A = '?' AND B = ?", want: "A = '?' AND B = :1"},
+		{query: "A = 'it''s?' AND B = ?", want: "A = 'it''s?' AND B = :1"},
+		{query: "A = ?", want: "A = :1"},
+		{query: "", want: ""},
+	}
+	for _, test := range tests {
+		if got := numberPlaceholders(test.query, ":"); got != test.want {
+			t.Errorf("numberPlaceholders(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestGlobPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "cam%", want: "cam*"},
+		{pattern: "c_m", want: "c?m"},
+		{pattern: "a*b?c[d]", want: "a[*]b[?]c[[]d]"},
+		{pattern: "%[_]%", want: "*[[]?]*"},
+	}
+	for _, test := range tests {
+		if got := globPattern(test.pattern); got != test.want {
+			t.Errorf("globPattern(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Content types of the streaming formats
+const (
+	csvContentType    = "text/csv; charset=utf-8"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// Streamer is implemented by stores that can iterate over all the
+// resources matching a query, without loading them all in memory.
+type Streamer[T any] interface {
+	// Stream calls f for every resource matching the query filter,
+	// in order. Pagination is ignored.
+	Stream(ctx context.Context, query crud.Query, f func(T) error) error
+}
+
+// rowWriter writes resources in a streaming format
+type rowWriter interface {
+	Write(row reflect.Value) error
+	Flush() error
+}
+
+// Export implements crud.Exporter, if the store supports it.
+// Rows are written to the reply as they are read from the store.
+func (vr Adaptor[T]) Export(ctx context.Context, query crud.Query) (io.ReadCloser, error) {
+	streamer, ok := vr.Resource.(Streamer[T])
+	if !ok {
+		return nil, crud.ErrInvalidFormat
+	}
+	t := reflect.TypeOf(*new(T))
+	if err := checkFields(t, query.Fields); err != nil {
+		return nil, err
+	}
+	fields := query.Fields
+	if len(fields) == 0 {
+		fields = attribNames(t)
+	}
+	pr, pw := io.Pipe()
+	buffer := bufio.NewWriter(pw)
+	var (
+		writer      rowWriter
+		contentType string
+	)
+	switch query.Format {
+	case crud.FORMAT_CSV:
+		writer, contentType = &csvWriter{writer: csv.NewWriter(buffer), fields: fields}, csvContentType
+	case crud.FORMAT_NDJSON:
+		writer, contentType = &ndjsonWriter{writer: buffer, fields: query.Fields}, ndjsonContentType
+	default:
+		return nil, crud.ErrInvalidFormat
+	}
+	// Errors before the first row are returned, so that the reply gets
+	// the right status code. Afterwards, they can only abort the reply.
+	ready := make(chan error, 1)
+	go func() {
+		started := false
+		err := streamer.Stream(ctx, query, func(v T) error {
+			if !started {
+				started = true
+				ready <- nil
+			}
+			return writer.Write(reflect.ValueOf(v))
+		})
+		if !started {
+			ready <- err
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err == nil {
+			err = buffer.Flush()
+		}
+		pw.CloseWithError(err)
+	}()
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+	return typedReader{ReadCloser: pr, contentType: contentType}, nil
+}
+
+// csvWriter writes a header with the field names, and a line per row.
+// Strings and times are written as text, other values as json.
+type csvWriter struct {
+	writer *csv.Writer
+	fields []string
+	header bool
+}
+
+func (w *csvWriter) Write(row reflect.Value) error {
+	if !w.header {
+		w.header = true
+		if err := w.writer.Write(w.fields); err != nil {
+			return err
+		}
+	}
+	attribs := attribsOf(row.Type())
+	index := fieldsOf(row.Type())
+	record := make([]string, 0, len(w.fields))
+	for _, field := range w.fields {
+		data, err := json.Marshal(row.FieldByIndex(index[attribs[field].Column]).Interface())
+		if err != nil {
+			return err
+		}
+		var text string
+		switch {
+		case string(data) == "null":
+		case data[0] == '"':
+			if err := json.Unmarshal(data, &text); err != nil {
+				return err
+			}
+		default:
+			text = string(data)
+		}
+		record = append(record, text)
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvWriter) Flush() error {
+	// The header is written even without rows
+	if !w.header {
+		w.header = true
+		if err := w.writer.Write(w.fields); err != nil {
+			return err
+		}
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// ndjsonWriter writes a json object per line, with all
+// the attributes of the resource or only the given fields.
+type ndjsonWriter struct {
+	writer io.Writer
+	fields []string
+}
+
+func (w *ndjsonWriter) Write(row reflect.Value) error {
+	var (
+		data []byte
+		err  error
+	)
+	if len(w.fields) > 0 {
+		data, err = project(row, w.fields)
+	} else {
+		data, err = json.Marshal(row.Interface())
+	}
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.writer.Write(data)
+	return err
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return nil
+}
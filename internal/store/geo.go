@@ -0,0 +1,90 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Columns used by geo queries: the position of the resource,
+// and the computed distance to the `near` point.
+const (
+	LatitudeColumn  = "LATITUDE"
+	LongitudeColumn = "LONGITUDE"
+	DistanceColumn  = "DISTANCE"
+)
+
+// Mean earth radius, in meters
+const earthRadius = 6371008.8
+
+// checkGeo verifies the table has a position, if the query needs it
+func checkGeo(columns map[string]DbType, geo crud.Geo) error {
+	if geo.Near == nil && geo.BBox == nil {
+		return nil
+	}
+	for _, field := range []string{LatitudeColumn, LongitudeColumn} {
+		if dbtype, ok := columns[strings.ToLower(field)]; !ok || dbtype != DbType(FloatDbType{}) {
+			return crud.ErrInvalidGeo
+		}
+	}
+	return nil
+}
+
+// distance between two points, using the haversine formula
+func distance(a, b crud.GeoPoint) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// sqlFloat formats a number as a SQL literal
+func sqlFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// distanceExpr builds the SQL expression for the distance of the row
+// to the point, same as distance. Only uses functions available in all
+// the dialects. The coordinates are numbers, so they can be inlined,
+// and the expression can be used in the ORDER BY and seek clauses.
+func distanceExpr(p crud.GeoPoint) string {
+	toRad := sqlFloat(math.Pi / 180)
+	lat := fmt.Sprintf("(%s - %s) * %s / 2", LatitudeColumn, sqlFloat(p.Latitude), toRad)
+	lon := fmt.Sprintf("(%s - %s) * %s / 2", LongitudeColumn, sqlFloat(p.Longitude), toRad)
+	return fmt.Sprintf("(%s * ASIN(SQRT(SIN(%s) * SIN(%s) + %s * COS(%s * %s) * SIN(%s) * SIN(%s))))",
+		sqlFloat(2*earthRadius), lat, lat, sqlFloat(math.Cos(p.Latitude*math.Pi/180)), LatitudeColumn, toRad, lon, lon)
+}
+
+// whereGeo builds the SQL condition for the geo filter
+func whereGeo(geo crud.Geo) (string, []interface{}) {
+	var (
+		conds  []string
+		params []interface{}
+	)
+	if geo.BBox != nil {
+		conds = append(conds, fmt.Sprintf("%s BETWEEN ? AND ? AND %s BETWEEN ? AND ?", LatitudeColumn, LongitudeColumn))
+		params = append(params,
+			geo.BBox.SouthWest.Latitude, geo.BBox.NorthEast.Latitude,
+			geo.BBox.SouthWest.Longitude, geo.BBox.NorthEast.Longitude)
+	}
+	if geo.Near != nil && geo.Radius > 0 {
+		conds = append(conds, distanceExpr(*geo.Near)+" <= ?")
+		params = append(params, geo.Radius)
+	}
+	return strings.Join(conds, " AND "), params
+}
+
+// matchGeo evaluates the geo filter against the position of a row
+func matchGeo(geo crud.Geo, p crud.GeoPoint) bool {
+	if geo.BBox != nil && !geo.BBox.Contains(p) {
+		return false
+	}
+	if geo.Near != nil && geo.Radius > 0 && distance(*geo.Near, p) > geo.Radius {
+		return false
+	}
+	return true
+}
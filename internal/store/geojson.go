@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Content type of GeoJSON replies
+const geoJsonContentType = "application/geo+json"
+
+type geoGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoFeature struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id,omitempty"`
+	Geometry   geoGeometry     `json:"geometry"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+// geoCollection is a GeoJSON FeatureCollection,
+// with the pagination attributes of getResult.
+type geoCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+	Next     string       `json:"next"`
+	Prev     string       `json:"prev"`
+	Count    uint64       `json:"count,omitempty"`
+}
+
+// hasPosition is true if the model type has latitude and longitude
+func hasPosition(t reflect.Type) bool {
+	fields := fieldsOf(t)
+	_, hasLat := fields[LatitudeColumn]
+	_, hasLon := fields[LongitudeColumn]
+	return hasLat && hasLon
+}
+
+// withPosition adds the position attributes to the fields, if there are
+// fields, so that they are read from the database.
+func withPosition(t reflect.Type, fields []string) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	result := append([]string{}, fields...)
+	attribs := attribsOf(t)
+	for _, column := range []string{LatitudeColumn, LongitudeColumn} {
+		for name, attrib := range attribs {
+			if attrib.Column == column {
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// featureCollection builds the GeoJSON FeatureCollection for the rows.
+// Properties are the attributes of the resource, or only the given fields.
+func featureCollection[T any](result getResult, vs []T, fields []string) (geoCollection, error) {
+	collection := geoCollection{
+		Type:     "FeatureCollection",
+		Features: make([]geoFeature, 0, len(vs)),
+		Next:     result.Next,
+		Prev:     result.Prev,
+		Count:    result.Count,
+	}
+	for idx := range vs {
+		row := reflect.ValueOf(vs[idx])
+		feature := geoFeature{
+			Type:     "Feature",
+			Geometry: geoGeometry{Type: "Point"},
+		}
+		if model, ok := any(vs[idx]).(Model); ok {
+			feature.ID = model.GetID()
+		}
+		// GeoJSON positions are longitude first
+		for pos, column := range []string{LongitudeColumn, LatitudeColumn} {
+			v, err := columnValue(fieldsOf(row.Type()), row, column)
+			if err != nil {
+				return geoCollection{}, err
+			}
+			coord, ok := v.(float64)
+			if !ok {
+				return geoCollection{}, crud.ErrInvalidFormat
+			}
+			feature.Geometry.Coordinates[pos] = coord
+		}
+		var err error
+		if len(fields) > 0 {
+			feature.Properties, err = project(row, fields)
+		} else {
+			feature.Properties, err = json.Marshal(vs[idx])
+		}
+		if err != nil {
+			return geoCollection{}, err
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+	return collection, nil
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// ActorFunc returns who is making the change in the context,
+// and their role. Empty if the change is not made by an user.
+type ActorFunc func(ctx context.Context) (actor, role string)
+
+// jsonText is a json document, kept as text in the database
+type jsonText string
+
+// MarshalJSON implements json.Marshaler
+func (j jsonText) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// Revision is a previous version of a resource, kept in the history
+// table. Versions are numbered from 1 for every resource.
+type Revision struct {
+	ResourceID string    `json:"resource_id" db:"RESOURCE_ID"`
+	Version    int       `json:"version" db:"VERSION"`
+	ReplacedAt time.Time `json:"replaced_at" db:"REPLACED_AT"`
+	// Who replaced this version, and how
+	Actor  *string  `json:"actor" db:"ACTOR"`
+	Role   *string  `json:"role" db:"ROLE"`
+	Action Action   `json:"action" db:"ACTION"`
+	Data   jsonText `json:"data" db:"DATA"`
+}
+
+// Historian is implemented by stores that keep the previous versions of their resources
+type Historian interface {
+	// History returns the previous versions of the resource, newest first
+	History(ctx context.Context, id string) ([]Revision, error)
+	// Revert the resource to the given version
+	Revert(ctx context.Context, id string, version string) error
+}
+
+// WithHistory returns a copy of the resource that saves the previous
+// version of every row changed in the given table.
+func (r SQLResource[T, P]) WithHistory(table string, actor ActorFunc) SQLResource[T, P] {
+	r.history = table
+	r.actor = actor
+	return r
+}
+
+// saveRevision saves the previous version of the resource in the history table
+func (r SQLResource[T, P]) saveRevision(ctx context.Context, action Action, id string, before any) error {
+	data, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	var last sql.NullInt64
+	query := "SELECT MAX(VERSION) FROM " + r.history + " WHERE RESOURCE_ID=?"
+	if err := r.getter(ctx).GetContext(ctx, &last, query, id); err != nil {
+		return QueryError{
+			Message: "failed to get last version",
+			Query:   query,
+			Params:  id,
+			Cause:   err,
+		}
+	}
+	rev := Revision{
+		ResourceID: id,
+		Version:    int(last.Int64) + 1,
+		ReplacedAt: time.Now(),
+		Action:     action,
+		Data:       jsonText(data),
+	}
+	if r.actor != nil {
+		if actor, role := r.actor(ctx); actor != "" {
+			rev.Actor, rev.Role = &actor, &role
+		}
+	}
+	// The row lock taken by audited keeps concurrent changes from
+	// reading the same last version. If some other writer did, the
+	// primary key of the history table rejects the revision.
+	err = r.Batch(ctx, func(ctx context.Context) error {
+		return r.insertRevision(ctx, rev)
+	})
+	if err != nil && r.hasRevision(ctx, id, rev.Version) {
+		return crud.ErrPreconditionFailed
+	}
+	return err
+}
+
+// insertRevision adds the revision to the history table
+func (r SQLResource[T, P]) insertRevision(ctx context.Context, rev Revision) error {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	cols := []string{"RESOURCE_ID", "VERSION", "REPLACED_AT", "ACTOR", "ROLE", "ACTION", "DATA"}
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO ")
+	sb.WriteString(r.history)
+	sb.WriteString(" (")
+	sb.WriteString(strings.Join(cols, ", "))
+	sb.WriteString(") VALUES (:")
+	sb.WriteString(r.dialect.Fold(strings.Join(cols, ", :")))
+	sb.WriteString(")")
+	stmt, args, err := tx.PrepareNamed(ctx, sb.String(), rev)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if _, err := stmt.Execute(ctx, args...); err != nil {
+		return QueryError{
+			Message: "failed to save revision",
+			Query:   stmt.QueryString(),
+			Params:  rev.ResourceID,
+			Cause:   err,
+		}
+	}
+	return tx.Commit()
+}
+
+// hasRevision is true if the version of the resource is already in the history
+func (r SQLResource[T, P]) hasRevision(ctx context.Context, id string, version int) bool {
+	var count int
+	query := "SELECT COUNT(*) FROM " + r.history + " WHERE RESOURCE_ID=? AND VERSION=?"
+	if err := r.getter(ctx).GetContext(ctx, &count, query, id, version); err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// History returns the previous versions of the resource, newest first.
+// Fails with crud.ErrNotFound if there is no history nor resource.
+func (r SQLResource[T, P]) History(ctx context.Context, id string) ([]Revision, error) {
+	if r.history == "" {
+		return nil, crud.ErrNotFound
+	}
+	query := "SELECT * FROM " + r.history + " WHERE RESOURCE_ID=? ORDER BY VERSION DESC"
+	var revs []Revision
+	if err := r.querier.SelectContext(ctx, &revs, query, id); err != nil {
+		return nil, QueryError{
+			Message: "failed to get history",
+			Query:   query,
+			Params:  id,
+			Cause:   err,
+		}
+	}
+	if len(revs) == 0 {
+		if _, err := r.GetById(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, crud.ErrNotFound
+			}
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+// Revert the resource to a previous version. Only the attributes that
+// differ from the current version are changed, like in a patch.
+func (r SQLResource[T, P]) Revert(ctx context.Context, id string, version string) error {
+	if r.history == "" {
+		return crud.ErrNotFound
+	}
+	number, err := strconv.Atoi(version)
+	if err != nil {
+		return crud.ErrNotFound
+	}
+	_, err = r.audited(ctx, ACTION_REVERT, id, func(ctx context.Context) (string, error) {
+		var rev Revision
+		query := "SELECT * FROM " + r.history + " WHERE RESOURCE_ID=? AND VERSION=?"
+		if err := r.getter(ctx).GetContext(ctx, &rev, query, id, number); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return "", crud.ErrNotFound
+			}
+			return "", QueryError{
+				Message: "failed to get revision",
+				Query:   query,
+				Params:  []any{id, number},
+				Cause:   err,
+			}
+		}
+		current, err := r.GetById(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return "", crud.ErrNotFound
+			}
+			return "", err
+		}
+		var previous T
+		if err := json.Unmarshal([]byte(rev.Data), &previous); err != nil {
+			return "", err
+		}
+		changed, err := changedColumns(current, previous)
+		if err != nil || len(changed) == 0 {
+			return id, err
+		}
+		// The historical row is written as it was, not through the
+		// rules for patches made by clients. Only the version is new.
+		if err := setVersion(&previous, time.Now()); err != nil {
+			return "", err
+		}
+		return id, r.update(ctx, previous, append(changed, VersionColumn))
+	})
+	return err
+}
+
+// Columns kept by the store, that are never reverted
+var bookkeeping = map[string]bool{
+	"ID":          true,
+	"CREATED_AT":  true,
+	VersionColumn: true,
+	DeletedColumn: true,
+}
+
+// setVersion sets the version column of the row
+func setVersion[T any](t *T, version time.Time) error {
+	row := reflect.ValueOf(t).Elem()
+	index, ok := fieldsOf(row.Type())[VersionColumn]
+	if !ok {
+		return fmt.Errorf("column %s does not exist", VersionColumn)
+	}
+	row.FieldByIndex(index).Set(reflect.ValueOf(version))
+	return nil
+}
+
+// changedColumns returns the columns with different values in both rows
+func changedColumns[T any](current, previous T) ([]string, error) {
+	currentRow, previousRow := reflect.ValueOf(current), reflect.ValueOf(previous)
+	fields := fieldsOf(currentRow.Type())
+	var changed []string
+	for column := range fields {
+		if bookkeeping[column] {
+			continue
+		}
+		a, err := columnValue(fields, currentRow, column)
+		if err != nil {
+			return nil, err
+		}
+		b, err := columnValue(fields, previousRow, column)
+		if err != nil {
+			return nil, err
+		}
+		if !sameValue(a, b) {
+			changed = append(changed, column)
+		}
+	}
+	return changed, nil
+}
+
+// sameValue compares column values, times by instant
+func sameValue(a, b driver.Value) bool {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Equal(tb)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+type historyResult struct {
+	Data []Revision `json:"data"`
+}
+
+// History implements crud.Historian, if the store supports it
+func (vr Adaptor[T]) History(ctx context.Context, id string) (io.ReadCloser, error) {
+	historian, ok := vr.Resource.(Historian)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	revs, err := historian.History(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if revs == nil {
+		revs = make([]Revision, 0)
+	}
+	data, err := json.Marshal(historyResult{Data: revs})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Revert implements crud.Historian, if the store supports it
+func (vr Adaptor[T]) Revert(ctx context.Context, id string, version string) error {
+	historian, ok := vr.Resource.(Historian)
+	if !ok {
+		return crud.ErrNotFound
+	}
+	return historian.Revert(ctx, id, version)
+}
@@ -0,0 +1,224 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// errDryRun rolls back the import transaction
+var errDryRun = errors.New("dry run")
+
+// Import implements crud.Importer
+func (vr Adaptor[T]) Import(ctx context.Context, rows []crud.ImportRow, opts crud.ImportOptions) (io.ReadCloser, error) {
+	result, err := vr.ImportRows(ctx, rows, opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ImportRows validates all the rows with PrepareCreate, and if all of them
+// are valid, creates (or updates, if opts.Upsert) the resources in a single
+// transaction. Any failure rolls back the whole import.
+func (vr Adaptor[T]) ImportRows(ctx context.Context, rows []crud.ImportRow, opts crud.ImportOptions) (crud.ImportResponse, error) {
+	result := crud.ImportResponse{
+		DryRun:  opts.DryRun,
+		Results: make([]crud.ImportResult, len(rows)),
+	}
+	// Validate all the rows before writing any, to report all the errors
+	values := make([]T, len(rows))
+	seen := make(map[string]int, len(rows))
+	for idx, row := range rows {
+		item := &result.Results[idx]
+		item.Line = row.Line
+		v, err := importValue[T](row)
+		if err == nil {
+			err = validateCreate(v)
+		}
+		if err == nil {
+			item.ID = idOf(v)
+			if prev, ok := seen[item.ID]; ok {
+				err = fmt.Errorf("duplicate id, also in line %d", prev)
+			}
+			seen[item.ID] = row.Line
+		}
+		if err != nil {
+			item.Status, item.Error = rowError(err)
+			result.Failed++
+			continue
+		}
+		values[idx] = v
+	}
+	if result.Failed > 0 {
+		for idx := range result.Results {
+			if item := &result.Results[idx]; item.Error == "" {
+				item.Status, item.Error = crud.ErrorStatus(crud.ErrImportAborted)
+			}
+		}
+		return result, nil
+	}
+	err := vr.Resource.Batch(ctx, func(ctx context.Context) error {
+		for idx, v := range values {
+			item := &result.Results[idx]
+			if err := vr.importApply(ctx, v, opts.Upsert, item); err != nil {
+				item.Status, item.Error = crud.ErrorStatus(err)
+				result.Failed++
+				for next := idx + 1; next < len(values); next++ {
+					skipped := &result.Results[next]
+					skipped.Status, skipped.Error = crud.ErrorStatus(crud.ErrImportAborted)
+				}
+				return crud.ErrImportAborted
+			}
+			if item.Op == crud.BULK_CREATE {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		result.Committed = true
+	case errors.Is(err, errDryRun), errors.Is(err, crud.ErrImportAborted):
+	default:
+		return crud.ImportResponse{}, err
+	}
+	return result, nil
+}
+
+// importApply creates the resource, or updates it if it exists and upsert
+func (vr Adaptor[T]) importApply(ctx context.Context, v T, upsert bool, item *crud.ImportResult) error {
+	id := idOf(v)
+	exists := false
+	if id != "" {
+		if _, err := vr.Resource.GetById(ctx, id); err == nil {
+			exists = true
+		} else if !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, crud.ErrNotFound) {
+			return err
+		}
+	}
+	if !exists {
+		newID, err := vr.Resource.Post(ctx, v)
+		if err != nil {
+			return err
+		}
+		item.ID, item.Op, item.Status = newID, crud.BULK_CREATE, http.StatusCreated
+		return nil
+	}
+	if !upsert {
+		return crud.ErrAlreadyExists
+	}
+	if err := vr.Resource.Put(ctx, id, v); err != nil {
+		return err
+	}
+	item.Op, item.Status = crud.BULK_UPDATE, http.StatusNoContent
+	return nil
+}
+
+// importValue decodes the row into a resource
+func importValue[T any](row crud.ImportRow) (T, error) {
+	var v T
+	data := row.Data
+	if row.Values != nil {
+		var err error
+		if data, err = csvObject[T](row.Values); err != nil {
+			return v, err
+		}
+	}
+	var attribs map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attribs); err != nil || attribs == nil {
+		return v, crud.ErrInvalidJson
+	}
+	known := attribsOf(reflect.TypeOf(v))
+	for name := range attribs {
+		if _, ok := known[name]; !ok {
+			return v, fmt.Errorf("unknown attribute %s", name)
+		}
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// csvObject turns the text of the attributes into a json object.
+// Values that are valid json for the attribute, such as numbers or
+// lists, are kept as they are. Anything else is taken as a string.
+func csvObject[T any](values map[string]string) ([]byte, error) {
+	obj := make(map[string]json.RawMessage, len(values))
+	for name, text := range values {
+		raw := json.RawMessage(text)
+		if text == "null" || !json.Valid(raw) || !decodes[T](name, raw) {
+			quoted, err := json.Marshal(text)
+			if err != nil {
+				return nil, err
+			}
+			raw = quoted
+		}
+		obj[name] = raw
+	}
+	return json.Marshal(obj)
+}
+
+// decodes checks the value can be decoded into the attribute
+func decodes[T any](name string, raw json.RawMessage) bool {
+	data, err := json.Marshal(map[string]json.RawMessage{name: raw})
+	if err != nil {
+		return false
+	}
+	var v T
+	return json.Unmarshal(data, &v) == nil
+}
+
+// CreateValidator is implemented by models whose PrepareCreate is
+// costly, e.g. because it hashes a password. Imports validate all
+// the rows before creating any, and would prepare them twice.
+type CreateValidator interface {
+	ValidateCreate() error
+}
+
+// validateCreate runs ValidateCreate, or PrepareCreate on a copy of the resource
+func validateCreate[T any](v T) error {
+	if validator, ok := any(&v).(CreateValidator); ok {
+		return validator.ValidateCreate()
+	}
+	if editable, ok := any(&v).(interface{ PrepareCreate() ([]string, error) }); ok {
+		_, err := editable.PrepareCreate()
+		return err
+	}
+	return nil
+}
+
+// idOf returns the id of the resource, if it has any
+func idOf[T any](v T) string {
+	if model, ok := any(v).(Model); ok {
+		return model.GetID()
+	}
+	return ""
+}
+
+// rowError returns the status and message for an invalid row
+func rowError(err error) (int, string) {
+	var known crud.Error
+	if errors.As(err, &known) {
+		return known.HttpError()
+	}
+	return http.StatusBadRequest, err.Error()
+}
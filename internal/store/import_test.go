@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// preparedRow counts the calls to PrepareCreate, that would be costly
+type preparedRow struct {
+	ID   string `json:"id" db:"ID"`
+	Name string `json:"name" db:"NAME"`
+}
+
+var prepareCalls int
+
+func (p preparedRow) GetID() string { return p.ID }
+
+func (p *preparedRow) ValidateCreate() error {
+	if p.ID == "" || p.Name == "" {
+		return errors.New("missing mandatory attribute")
+	}
+	return nil
+}
+
+func (p *preparedRow) PrepareCreate() ([]string, error) {
+	prepareCalls++
+	if err := p.ValidateCreate(); err != nil {
+		return nil, err
+	}
+	return []string{"ID", "NAME"}, nil
+}
+
+func (p *preparedRow) PrepareUpdate(id string) ([]string, error)       { return []string{"NAME"}, nil }
+func (p *preparedRow) PreparePatch(string, []string) ([]string, error) { return nil, nil }
+
+func TestImportPreparesOnce(t *testing.T) {
+	memory := NewMemory[preparedRow](FilterSet{"id": StringDbType{}, "name": StringDbType{}})
+	rows := []crud.ImportRow{
+		{Line: 1, Data: []byte(`{"id": "a", "name": "first"}`)},
+		{Line: 2, Data: []byte(`{"id": "b", "name": "second"}`)},
+	}
+	prepareCalls = 0
+	result, err := Adapt[preparedRow](memory).ImportRows(context.Background(), rows, crud.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Committed || result.Created != 2 {
+		t.Fatalf("got %+v, want 2 rows created", result)
+	}
+	if prepareCalls != 2 {
+		t.Errorf("got %d calls to PrepareCreate, want 2", prepareCalls)
+	}
+	// Invalid rows are found by ValidateCreate, before preparing any
+	prepareCalls = 0
+	rows = append(rows, crud.ImportRow{Line: 3, Data: []byte(`{"id": "c"}`)})
+	result, err = Adapt[preparedRow](NewMemory[preparedRow](memory.columns)).ImportRows(context.Background(), rows, crud.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Committed || result.Failed != 1 || prepareCalls != 0 {
+		t.Errorf("got %+v and %d calls to PrepareCreate, want 1 failed row and none", result, prepareCalls)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// compareOp turns the result of a comparison into the outcome of the operator
+func compareOp(cmp int, op crud.Operator) (bool, error) {
+	switch op {
+	case crud.OP_EQ:
+		return cmp == 0, nil
+	case crud.OP_NE:
+		return cmp != 0, nil
+	case crud.OP_GT:
+		return cmp > 0, nil
+	case crud.OP_GE:
+		return cmp >= 0, nil
+	case crud.OP_LT:
+		return cmp < 0, nil
+	case crud.OP_LE:
+		return cmp <= 0, nil
+	default:
+		return false, fmt.Errorf("unsupported operator %s", op)
+	}
+}
+
+// compareValues compares two values as returned by driver.Valuer.
+// NULL values sort after any other value, as they do in oracle and postgres.
+func compareValues(a, b driver.Value) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		default:
+			return -1
+		}
+	}
+	switch va := a.(type) {
+	case int64:
+		switch vb := b.(type) {
+		case int64:
+			return compareOrdered(va, vb)
+		case float64:
+			return compareOrdered(float64(va), vb)
+		}
+	case float64:
+		switch vb := b.(type) {
+		case int64:
+			return compareOrdered(va, float64(vb))
+		case float64:
+			return compareOrdered(va, vb)
+		}
+	case time.Time:
+		if vb, ok := b.(time.Time); ok {
+			return va.Compare(vb)
+		}
+	case bool:
+		if vb, ok := b.(bool); ok {
+			switch {
+			case va == vb:
+				return 0
+			case !va:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+	return strings.Compare(valueString(a), valueString(b))
+}
+
+func compareOrdered[V int64 | float64](a, b V) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// valueString formats a driver.Value as the database would turn it into text
+func valueString(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// likeMatch checks the text against a SQL like pattern,
+// where '%' matches any sequence and '_' any single character.
+func likeMatch(text, pattern string) bool {
+	t, p := []rune(text), []rune(pattern)
+	// Classic wildcard matching with backtracking to the last '%'
+	ti, pi := 0, 0
+	starP, starT := -1, 0
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '_' || p[pi] == t[ti]):
+			ti++
+			pi++
+		case pi < len(p) && p[pi] == '%':
+			starP, starT = pi, ti
+			pi++
+		case starP >= 0:
+			starT++
+			ti, pi = starT, starP+1
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
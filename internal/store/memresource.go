@@ -0,0 +1,726 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// MemoryResource keeps resources in memory, with the same semantics as
+// SQLResource. Intended for tests and for running without database.
+type MemoryResource[T Model, P interface {
+	*T
+	EditableModel
+}] struct {
+	// Properties of the "table"
+	columns map[string]DbType
+	fields  map[string][]int
+	// Rows indexed by id
+	mutex sync.Mutex
+	rows  map[string]T
+}
+
+// NewMemory creates an empty in-memory Resource
+func NewMemory[T Model, P interface {
+	*T
+	EditableModel
+}](columns map[string]DbType) *MemoryResource[T, P] {
+	var zero T
+	return &MemoryResource[T, P]{
+		columns: columns,
+		fields:  fieldsOf(reflect.TypeOf(zero)),
+		rows:    make(map[string]T),
+	}
+}
+
+// value returns the column value of the given row, as the driver would see it
+func (r *MemoryResource[T, P]) value(t *T, column string) (driver.Value, error) {
+	return columnValue(r.fields, reflect.ValueOf(t).Elem(), column)
+}
+
+// copyColumns copies the given columns from src to dst
+func (r *MemoryResource[T, P]) copyColumns(dst, src *T, cols []string) error {
+	dstVal, srcVal := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, col := range cols {
+		index, ok := r.fields[strings.ToUpper(col)]
+		if !ok {
+			return fmt.Errorf("column %s does not exist", col)
+		}
+		dstVal.FieldByIndex(index).Set(srcVal.FieldByIndex(index))
+	}
+	return nil
+}
+
+// GetById searches the table for the given id.
+// Soft deleted resources are not found.
+func (r *MemoryResource[T, P]) GetById(ctx context.Context, id string) (t T, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	t, ok := r.rows[id]
+	if !ok || r.deleted(&t) {
+		return t, QueryError{
+			Message: "failed to get resource",
+			Query:   "GetById",
+			Params:  id,
+			Cause:   sql.ErrNoRows,
+		}
+	}
+	return t, nil
+}
+
+// Get filtered (and possibly paginated) resources
+func (r *MemoryResource[T, P]) Get(ctx context.Context, query crud.Query) ([]T, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result, err := r.where(query)
+	if err != nil {
+		return nil, err
+	}
+	if query.Geo.Near != nil {
+		if err := r.setDistance(result, *query.Geo.Near); err != nil {
+			return nil, err
+		}
+	}
+	key := query.SortKey()
+	if err := checkSort(r.columns, key); err != nil {
+		return nil, err
+	}
+	if query.Cursor != nil && len(query.Cursor.Values) != len(key) {
+		return nil, crud.ErrInvalidCursor
+	}
+	// Same as "ORDER BY a ASC|DESC, b ASC|DESC, id ASC|DESC".
+	// When seeking backwards, sort in reverse and flip the result later.
+	ascending := query.Ascending
+	if query.Cursor != nil && query.Cursor.Backward {
+		ascending = !ascending
+	}
+	sort.Slice(result, func(i, j int) bool {
+		cmp := compareKeys(r.keyOf(&result[i], key), r.keyOf(&result[j], key))
+		if ascending {
+			return cmp < 0
+		}
+		return cmp > 0
+	})
+	offset := query.Offset
+	if query.Cursor != nil {
+		offset = 0
+		result = r.seek(result, key, query.Cursor, ascending)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(result) {
+		return nil, nil
+	}
+	result = result[offset:]
+	if query.Limit >= 0 && query.Limit < len(result) {
+		result = result[:query.Limit]
+	}
+	if query.Cursor != nil && query.Cursor.Backward {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return result, nil
+}
+
+// Stream calls f for every resource matching the filter, in order.
+// Pagination is ignored.
+func (r *MemoryResource[T, P]) Stream(ctx context.Context, query crud.Query, f func(T) error) error {
+	query.Offset, query.Limit, query.Cursor = 0, math.MaxInt, nil
+	rows, err := r.Get(ctx, query)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDistance fills the distance of each row to the point, if the model has it
+func (r *MemoryResource[T, P]) setDistance(rows []T, near crud.GeoPoint) error {
+	index, ok := r.fields[DistanceColumn]
+	if !ok {
+		return nil
+	}
+	for idx := range rows {
+		position, err := r.position(&rows[idx])
+		if err != nil {
+			return err
+		}
+		d := distance(near, position)
+		reflect.ValueOf(&rows[idx]).Elem().FieldByIndex(index).Set(reflect.ValueOf(&d))
+	}
+	return nil
+}
+
+// position returns the latitude and longitude of the row
+func (r *MemoryResource[T, P]) position(t *T) (crud.GeoPoint, error) {
+	latitude, err := r.value(t, LatitudeColumn)
+	if err != nil {
+		return crud.GeoPoint{}, err
+	}
+	longitude, err := r.value(t, LongitudeColumn)
+	if err != nil {
+		return crud.GeoPoint{}, err
+	}
+	lat, latOk := latitude.(float64)
+	lon, lonOk := longitude.(float64)
+	if !latOk || !lonOk {
+		return crud.GeoPoint{}, fmt.Errorf("position must be a float, not %T, %T", latitude, longitude)
+	}
+	return crud.GeoPoint{Latitude: lat, Longitude: lon}, nil
+}
+
+// keyOf returns the values of the sort key columns of a row
+func (r *MemoryResource[T, P]) keyOf(t *T, key []string) []driver.Value {
+	values := make([]driver.Value, 0, len(key))
+	for _, col := range key {
+		v, _ := r.value(t, col)
+		values = append(values, v)
+	}
+	return values
+}
+
+// compareKeys compares sort keys column by column
+func compareKeys(a, b []driver.Value) int {
+	for idx := range a {
+		if cmp := compareValues(a[idx], b[idx]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// seek drops the sorted rows up to the cursor position
+func (r *MemoryResource[T, P]) seek(sorted []T, key []string, cursor *crud.Cursor, ascending bool) []T {
+	for idx := range sorted {
+		cmp := compareKeys(r.keyOf(&sorted[idx], key), cursor.Values)
+		if (ascending && cmp > 0) || (!ascending && cmp < 0) {
+			return sorted[idx:]
+		}
+	}
+	return nil
+}
+
+// Count filtered resources
+func (r *MemoryResource[T, P]) Count(ctx context.Context, query crud.Query) (uint64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result, err := r.where(query)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(result)), nil
+}
+
+// Tags counts the resources with each tag, per camera
+func (r *MemoryResource[T, P]) Tags(ctx context.Context, query crud.Query) ([]TagCount, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	rows, err := r.where(query)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[[2]string]uint64)
+	for idx := range rows {
+		group, err := r.value(&rows[idx], TagsGroupColumn)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := r.value(&rows[idx], TagsColumn)
+		if err != nil {
+			return nil, err
+		}
+		list, err := jsonList(tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range list {
+			counts[[2]string{valueString(group), tag}]++
+		}
+	}
+	result := make([]TagCount, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, TagCount{Camera: key[0], Tag: key[1], Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Camera != result[j].Camera {
+			return result[i].Camera < result[j].Camera
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result, nil
+}
+
+// Stats counts the resources per group and time bucket
+func (r *MemoryResource[T, P]) Stats(ctx context.Context, query crud.Query, agg crud.Aggregation) ([]StatCount, error) {
+	fields, err := checkAggregation(r.columns, agg)
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	rows, err := r.where(query)
+	if err != nil {
+		return nil, err
+	}
+	// Counts indexed by bucket and group values
+	type statKey struct {
+		bucket time.Time
+		groups [3]string
+	}
+	counts := make(map[statKey]uint64)
+	for idx := range rows {
+		// Expand each row to one key per combination of groups
+		keys := []statKey{{}}
+		if agg.Bucket != crud.BUCKET_NONE {
+			column, err := r.value(&rows[idx], BucketColumn)
+			if err != nil {
+				return nil, err
+			}
+			ts, ok := column.(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("column %s is not a time", BucketColumn)
+			}
+			keys[0].bucket = bucketOf(ts, agg.Bucket).Time
+		}
+		for gidx, group := range agg.GroupBy {
+			column, err := r.value(&rows[idx], fields[gidx])
+			if err != nil {
+				return nil, err
+			}
+			values := []string{valueString(column)}
+			if group == crud.GROUP_TAG {
+				if values, err = jsonList(column); err != nil {
+					return nil, err
+				}
+			}
+			expanded := make([]statKey, 0, len(keys)*len(values))
+			for _, key := range keys {
+				for _, v := range values {
+					key.groups[gidx] = v
+					expanded = append(expanded, key)
+				}
+			}
+			keys = expanded
+		}
+		for _, key := range keys {
+			counts[key]++
+		}
+	}
+	// Without groups, there is always a total count
+	if len(agg.GroupBy) == 0 && agg.Bucket == crud.BUCKET_NONE && len(counts) == 0 {
+		counts[statKey{}] = 0
+	}
+	sorted := make([]statKey, 0, len(counts))
+	for key := range counts {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].bucket.Equal(sorted[j].bucket) {
+			return sorted[i].bucket.Before(sorted[j].bucket)
+		}
+		for gidx := range agg.GroupBy {
+			if sorted[i].groups[gidx] != sorted[j].groups[gidx] {
+				return sorted[i].groups[gidx] < sorted[j].groups[gidx]
+			}
+		}
+		return false
+	})
+	result := make([]StatCount, 0, len(sorted))
+	for _, key := range sorted {
+		item := StatCount{Count: counts[key]}
+		if agg.Bucket != crud.BUCKET_NONE {
+			item.Bucket = &Bucket{Time: key.bucket}
+		}
+		for gidx, group := range agg.GroupBy {
+			item.set(group, key.groups[gidx])
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// where returns the rows matching the filter
+func (r *MemoryResource[T, P]) where(query crud.Query) ([]T, error) {
+	if err := checkGeo(r.columns, query.Geo); err != nil {
+		return nil, err
+	}
+	if err := checkDeleted(r.columns, query.Deleted); err != nil {
+		return nil, err
+	}
+	result := make([]T, 0, len(r.rows))
+	for _, row := range r.rows {
+		row := row
+		if softDeletes(r.columns) && query.Deleted != crud.DELETED_INCLUDE {
+			deleted, err := r.value(&row, DeletedColumn)
+			if err != nil {
+				return nil, err
+			}
+			if (deleted != nil) != (query.Deleted == crud.DELETED_ONLY) {
+				continue
+			}
+		}
+		match, err := r.match(&row, query.Filter, query.OuterOp, query.InnerOp)
+		if err != nil {
+			return nil, err
+		}
+		if match && query.Geo.HasFilter() {
+			position, err := r.position(&row)
+			if err != nil {
+				return nil, err
+			}
+			match = matchGeo(query.Geo, position)
+		}
+		if match && query.Expr != nil {
+			var known bool
+			match, known, err = r.matchExpr(&row, *query.Expr)
+			if err != nil {
+				return nil, err
+			}
+			match = match && known
+		}
+		if match {
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+// match evaluates the filter on a single row
+func (r *MemoryResource[T, P]) match(t *T, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) (bool, error) {
+	if len(filter) == 0 {
+		return true, nil
+	}
+	outerMatch := outerOp == crud.OUTER_AND
+	for _, f := range filter {
+		innerMatch := innerOp == crud.INNER_AND
+		for _, v := range f.Values {
+			cond, _, err := r.condition(t, f, filterValues(f.Operator, v))
+			if err != nil {
+				return false, err
+			}
+			if innerOp == crud.INNER_AND {
+				innerMatch = innerMatch && cond
+			} else {
+				innerMatch = innerMatch || cond
+			}
+		}
+		if outerOp == crud.OUTER_AND {
+			outerMatch = outerMatch && innerMatch
+		} else {
+			outerMatch = outerMatch || innerMatch
+		}
+	}
+	return outerMatch, nil
+}
+
+// matchExpr evaluates a filter expression on a single row. Uses three-valued
+// logic like SQL: comparisons with NULL are not known, and neither is their NOT.
+func (r *MemoryResource[T, P]) matchExpr(t *T, e crud.Expr) (match bool, known bool, err error) {
+	if e.Cond != nil {
+		return r.condition(t, *e.Cond, e.Cond.Values)
+	}
+	switch e.Op {
+	case crud.EXPR_NOT:
+		match, known, err = r.matchExpr(t, e.Terms[0])
+		return !match, known, err
+	case crud.EXPR_AND:
+		match, known = true, true
+		for _, term := range e.Terms {
+			termMatch, termKnown, err := r.matchExpr(t, term)
+			if err != nil {
+				return false, false, err
+			}
+			if termKnown && !termMatch {
+				return false, true, nil
+			}
+			known = known && termKnown
+		}
+		return known, known, nil
+	case crud.EXPR_OR:
+		known = true
+		for _, term := range e.Terms {
+			termMatch, termKnown, err := r.matchExpr(t, term)
+			if err != nil {
+				return false, false, err
+			}
+			if termKnown && termMatch {
+				return true, true, nil
+			}
+			known = known && termKnown
+		}
+		return false, known, nil
+	}
+	return false, false, fmt.Errorf("unsupported expression operator %s", e.Op)
+}
+
+// condition evaluates a single value of a filter, or all the values
+// of a list operator, on a row.
+// The result is not known if the column is NULL, unless the type says otherwise.
+func (r *MemoryResource[T, P]) condition(t *T, f crud.Filter, vals []string) (match bool, known bool, err error) {
+	dbtype, ok := r.columns[f.Field]
+	if !ok {
+		return false, false, crud.ErrInvalidColumn
+	}
+	column, err := r.value(t, f.Field)
+	if err != nil {
+		return false, false, err
+	}
+	op := f.Operator
+	// Legacy NULL literal, same as isnull / notnull
+	if isNull(vals) && !op.Unary() {
+		switch op {
+		case crud.OP_EQ:
+			op = crud.OP_ISNULL
+		case crud.OP_NE:
+			op = crud.OP_NOTNULL
+		default:
+			return false, false, crud.ErrInvalidOperator
+		}
+	}
+	match, err = dbtype.Match(column, op, vals)
+	if err != nil {
+		return false, false, err
+	}
+	return match, match || column != nil || knownOnNull(dbtype, op), nil
+}
+
+// Post creates a resource in memory
+func (r *MemoryResource[T, P]) Post(ctx context.Context, t T) (string, error) {
+	cols, err := P(&t).PrepareCreate()
+	if err != nil {
+		return "", err
+	}
+	// Only the prepared columns are stored, the rest are NULL
+	var row T
+	if err := r.copyColumns(&row, &t, cols); err != nil {
+		return "", err
+	}
+	newID := row.GetID()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.rows[newID]; exists {
+		return "", QueryError{
+			Message: "failed to create resource",
+			Query:   "Post",
+			Params:  t,
+			Cause:   fmt.Errorf("duplicate id %s", newID),
+		}
+	}
+	r.rows[newID] = row
+	return newID, nil
+}
+
+// Put updates a resource in memory
+func (r *MemoryResource[T, P]) Put(ctx context.Context, id string, t T) error {
+	if id == "" {
+		return errors.New("cannot update resource with empty id")
+	}
+	cols, err := P(&t).PrepareUpdate(id)
+	if err != nil {
+		return err
+	}
+	return r.update(ctx, id, t, cols)
+}
+
+// Patch updates only the given columns of a resource in memory
+func (r *MemoryResource[T, P]) Patch(ctx context.Context, id string, t T, patched []string) error {
+	if id == "" {
+		return errors.New("cannot update resource with empty id")
+	}
+	cols, err := P(&t).PreparePatch(id, patched)
+	if err != nil {
+		return err
+	}
+	return r.update(ctx, id, t, cols)
+}
+
+// update the given columns of the resource
+func (r *MemoryResource[T, P]) update(ctx context.Context, id string, t T, cols []string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	row, ok := r.rows[id]
+	if err := checkVersion(ctx, row, ok); err != nil {
+		return err
+	}
+	// Resources in the trash can only be restored
+	if !ok || r.deleted(&row) {
+		return crud.ErrNotFound
+	}
+	if err := r.copyColumns(&row, &t, cols); err != nil {
+		return err
+	}
+	r.rows[id] = row
+	return nil
+}
+
+// Delete a resource from memory
+func (r *MemoryResource[T, P]) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("cannot remove resource with empty id")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	row, ok := r.rows[id]
+	if err := checkVersion(ctx, row, ok); err != nil {
+		return err
+	}
+	if !softDeletes(r.columns) {
+		delete(r.rows, id)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	if deleted, err := r.value(&row, DeletedColumn); err != nil || deleted != nil {
+		return err
+	}
+	if err := r.setDeleted(&row, true); err != nil {
+		return err
+	}
+	r.rows[id] = row
+	return nil
+}
+
+// deleted is true if the row is in the trash
+func (r *MemoryResource[T, P]) deleted(t *T) bool {
+	if !softDeletes(r.columns) {
+		return false
+	}
+	deleted, err := r.value(t, DeletedColumn)
+	return err == nil && deleted != nil
+}
+
+// setDeleted marks the row as deleted now, or clears the mark,
+// and updates the VersionColumn.
+func (r *MemoryResource[T, P]) setDeleted(t *T, deleted bool) error {
+	now := time.Now()
+	value := reflect.ValueOf(t).Elem()
+	for _, column := range []string{DeletedColumn, VersionColumn} {
+		index, ok := r.fields[column]
+		if !ok {
+			return fmt.Errorf("column %s does not exist", column)
+		}
+		var v any = now
+		if column == DeletedColumn && !deleted {
+			v = nil
+		}
+		field := value.FieldByIndex(index)
+		if scanner, ok := field.Addr().Interface().(sql.Scanner); ok {
+			if err := scanner.Scan(v); err != nil {
+				return err
+			}
+			continue
+		}
+		field.Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+// Restore a soft deleted resource
+func (r *MemoryResource[T, P]) Restore(ctx context.Context, id string) error {
+	if !softDeletes(r.columns) {
+		return crud.ErrNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	row, ok := r.rows[id]
+	if err := checkVersion(ctx, row, ok); err != nil {
+		return err
+	}
+	if !ok {
+		return crud.ErrNotFound
+	}
+	deleted, err := r.value(&row, DeletedColumn)
+	if err != nil {
+		return err
+	}
+	if deleted == nil {
+		return crud.ErrNotFound
+	}
+	if err := r.setDeleted(&row, false); err != nil {
+		return err
+	}
+	r.rows[id] = row
+	return nil
+}
+
+// Purge removes for good the rows deleted before the given time
+func (r *MemoryResource[T, P]) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	if !softDeletes(r.columns) {
+		return nil, crud.ErrNotFound
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var purged []string
+	for id, row := range r.rows {
+		row := row
+		deleted, err := r.value(&row, DeletedColumn)
+		if err != nil {
+			return purged, err
+		}
+		if at, ok := deleted.(time.Time); ok && at.Before(before) {
+			delete(r.rows, id)
+			purged = append(purged, id)
+		}
+	}
+	sort.Strings(purged)
+	return purged, nil
+}
+
+// Batch runs f and restores the previous rows if it fails.
+// Unlike a database transaction, it is not isolated from
+// other changes made concurrently.
+func (r *MemoryResource[T, P]) Batch(ctx context.Context, f func(context.Context) error) error {
+	r.mutex.Lock()
+	snapshot := make(map[string]T, len(r.rows))
+	for id, row := range r.rows {
+		snapshot[id] = row
+	}
+	r.mutex.Unlock()
+	if err := f(ctx); err != nil {
+		r.mutex.Lock()
+		r.rows = snapshot
+		r.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// checkVersion enforces the If-Match precondition, if any
+func checkVersion[T any](ctx context.Context, row T, exists bool) error {
+	tags, ok := crud.IfMatchFrom(ctx)
+	if !ok {
+		return nil
+	}
+	if !exists {
+		return crud.ErrPreconditionFailed
+	}
+	for _, tag := range tags {
+		if tag == "*" {
+			return nil
+		}
+		if versioned, ok := any(row).(Versioned); ok {
+			version, err := crud.ParseETag(tag)
+			if err == nil && version.Equal(versioned.GetVersion()) {
+				return nil
+			}
+		}
+	}
+	return crud.ErrPreconditionFailed
+}
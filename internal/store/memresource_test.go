@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	_ "modernc.org/sqlite"
+)
+
+// sampleRow has a column of each type, most of them nullable
+type sampleRow struct {
+	ID     string          `db:"ID"`
+	Name   sql.NullString  `db:"NAME"`
+	Score  sql.NullFloat64 `db:"SCORE"`
+	Hits   int64           `db:"HITS"`
+	SeenAt sql.NullTime    `db:"SEEN_AT"`
+}
+
+func (s sampleRow) GetID() string { return s.ID }
+
+var sampleColumns = []string{"ID", "NAME", "SCORE", "HITS", "SEEN_AT"}
+
+func (s *sampleRow) PrepareCreate() ([]string, error)                { return sampleColumns, nil }
+func (s *sampleRow) PrepareUpdate(id string) ([]string, error)       { return sampleColumns[1:], nil }
+func (s *sampleRow) PreparePatch(string, []string) ([]string, error) { return nil, nil }
+
+var sampleFilterSet = FilterSet{
+	"id":      StringDbType{},
+	"name":    StringDbType{},
+	"score":   FloatDbType{},
+	"hits":    IntDbType{},
+	"seen_at": TimeDbType{},
+}
+
+// sqlxQuerier runs the queries in a sqlite database
+type sqlxQuerier struct {
+	db      *sqlx.DB
+	dialect Dialect
+}
+
+func (q sqlxQuerier) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return q.db.GetContext(ctx, dest, q.dialect.Rebind(query), q.dialect.BindArgs(args)...)
+}
+
+func (q sqlxQuerier) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return q.db.SelectContext(ctx, dest, q.dialect.Rebind(query), q.dialect.BindArgs(args)...)
+}
+
+// sampleRows returns rows with duplicates, NULLs and mixed case
+func sampleRows() []sampleRow {
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	name := func(s string) sql.NullString { return sql.NullString{String: s, Valid: s != ""} }
+	score := func(f float64) sql.NullFloat64 { return sql.NullFloat64{Float64: f, Valid: f >= 0} }
+	seen := func(days int) sql.NullTime {
+		return sql.NullTime{Time: day.AddDate(0, 0, days), Valid: days >= 0}
+	}
+	return []sampleRow{
+		{ID: "r01", Name: name("alpha"), Score: score(1), Hits: 3, SeenAt: seen(0)},
+		{ID: "r02", Name: name("Alpha"), Score: score(2.5), Hits: 7, SeenAt: seen(1)},
+		{ID: "r03", Name: name("beta"), Score: score(-1), Hits: 0, SeenAt: seen(-1)},
+		{ID: "r04", Name: name(""), Score: score(3), Hits: 5, SeenAt: seen(2)},
+		{ID: "r05", Name: name("gamma_1"), Score: score(2.5), Hits: 5, SeenAt: seen(-1)},
+		{ID: "r06", Name: name("gamma%1"), Score: score(0), Hits: 1, SeenAt: seen(3)},
+		{ID: "r07", Name: name("Ángel"), Score: score(4), Hits: 9, SeenAt: seen(1)},
+		{ID: "r08", Name: name(""), Score: score(-1), Hits: 2, SeenAt: seen(0)},
+		{ID: "r09", Name: name("beta"), Score: score(1), Hits: 3, SeenAt: seen(5)},
+	}
+}
+
+// newSampleResources returns a SQLResource and a MemoryResource with the same rows
+func newSampleResources(t *testing.T) (SQLResource[sampleRow, *sampleRow], *MemoryResource[sampleRow, *sampleRow]) {
+	t.Helper()
+	dialect := Sqlite()
+	db, err := sqlx.Connect("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// A single connection, each one would have its own in-memory database
+	db.SetMaxOpenConns(1)
+	db.Mapper = reflectx.NewMapperTagFunc("db", strings.ToLower, dialect.Fold)
+	db.MustExec(`CREATE TABLE SAMPLES (
+		ID VARCHAR(64) NOT NULL PRIMARY KEY,
+		NAME VARCHAR(64) NULL,
+		SCORE FLOAT NULL,
+		HITS INTEGER NOT NULL,
+		SEEN_AT TIMESTAMP NULL
+	)`)
+	memory := NewMemory[sampleRow](sampleFilterSet)
+	for _, row := range sampleRows() {
+		args := dialect.BindArgs([]any{row.ID, row.Name, row.Score, row.Hits, row.SeenAt})
+		db.MustExec("INSERT INTO SAMPLES (ID, NAME, SCORE, HITS, SEEN_AT) VALUES (?, ?, ?, ?, ?)", args...)
+		if _, err := memory.Post(context.Background(), row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	querier := sqlxQuerier{db: db, dialect: dialect}
+	return New[sampleRow](querier, nil, "SAMPLES", sampleFilterSet, dialect), memory
+}
+
+func TestMemoryMatchesSQL(t *testing.T) {
+	filter := func(field string, op crud.Operator, values ...string) crud.Filter {
+		return crud.Filter{Field: field, Operator: op, Values: values}
+	}
+	tests := []struct {
+		name  string
+		query crud.Query
+		expr  string
+	}{
+		{name: "sort by id", query: crud.Query{Ascending: true}},
+		{name: "sort descending", query: crud.Query{}},
+		{name: "sort by nullable column", query: crud.Query{Sort: []string{"name"}, Ascending: true}},
+		{name: "sort by nullable column descending", query: crud.Query{Sort: []string{"name"}}},
+		{name: "sort by two columns", query: crud.Query{Sort: []string{"score", "name"}, Ascending: true}},
+		{name: "sort by time", query: crud.Query{Sort: []string{"seen_at", "hits"}}},
+		{name: "eq", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_EQ, "alpha")}}},
+		{name: "ne skips nulls", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_NE, "alpha")}}},
+		{name: "eq NULL", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_EQ, "NULL")}}},
+		{name: "ne NULL", query: crud.Query{Filter: []crud.Filter{filter("score", crud.OP_NE, "NULL")}}},
+		{name: "like", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_LIKE, "a%")}}},
+		{name: "like wildcard", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_LIKE, "gamma_1")}}},
+		{name: "ilike", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_ILIKE, "ALPHA")}}},
+		{name: "startswith", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_STARTSWITH, "gamma%")}}},
+		{name: "startswith unicode", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_STARTSWITH, "Án")}}},
+		{name: "in", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_IN, "alpha,beta")}}},
+		{name: "nin", query: crud.Query{Filter: []crud.Filter{filter("name", crud.OP_NIN, "alpha,beta")}}},
+		{name: "between", query: crud.Query{Filter: []crud.Filter{filter("score", crud.OP_BETWEEN, "1,2.5")}}},
+		{name: "gt float", query: crud.Query{Filter: []crud.Filter{filter("score", crud.OP_GT, "2")}}},
+		{name: "le int", query: crud.Query{Filter: []crud.Filter{filter("hits", crud.OP_LE, "3")}}},
+		{name: "ge time", query: crud.Query{Filter: []crud.Filter{filter("seen_at", crud.OP_GE, "2024-05-02T12:00:00Z")}}},
+		{name: "isnull", query: crud.Query{Filter: []crud.Filter{filter("seen_at", crud.OP_ISNULL, "")}}},
+		{
+			name: "inner or",
+			query: crud.Query{
+				Filter:  []crud.Filter{filter("name", crud.OP_EQ, "alpha", "beta")},
+				InnerOp: crud.INNER_OR,
+			},
+		},
+		{
+			name: "inner and",
+			query: crud.Query{
+				Filter:  []crud.Filter{filter("hits", crud.OP_GT, "1", "4")},
+				InnerOp: crud.INNER_AND,
+			},
+		},
+		{
+			name: "outer or",
+			query: crud.Query{
+				Filter:  []crud.Filter{filter("name", crud.OP_EQ, "beta"), filter("hits", crud.OP_GE, "7")},
+				OuterOp: crud.OUTER_OR,
+			},
+		},
+		{
+			name: "outer and",
+			query: crud.Query{
+				Filter:  []crud.Filter{filter("name", crud.OP_NE, "NULL"), filter("hits", crud.OP_LT, "5")},
+				OuterOp: crud.OUTER_AND,
+			},
+		},
+		{name: "expression", expr: "name eq 'alpha' or (score gt 2 and hits lt 9)"},
+		{name: "not with nulls", expr: "not (name eq 'beta')"},
+		{name: "not of unknown", expr: "not (score lt 2 and seen_at isnull)"},
+		{name: "expression list", expr: "name in ('alpha', 'gamma%1') or hits between (7, 9)"},
+		{name: "offset and limit", query: crud.Query{Sort: []string{"hits"}, Ascending: true, Offset: 2, Limit: 3}},
+		{name: "negative offset", query: crud.Query{Sort: []string{"hits"}, Offset: -1, Limit: 3}},
+		{name: "offset past the end", query: crud.Query{Offset: 20}},
+	}
+	sqlStore, memStore := newSampleResources(t)
+	ctx := context.Background()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := test.query
+			if query.Limit == 0 {
+				query.Limit = 100
+			}
+			if test.expr != "" {
+				expr, err := crud.ParseExpr(test.expr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				query.Expr = expr
+			}
+			want, err := sqlStore.Get(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := memStore.Get(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids(got) != ids(want) {
+				t.Errorf("got %s, want %s", ids(got), ids(want))
+			}
+			count, err := memStore.Count(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantCount, err := sqlStore.Count(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != wantCount {
+				t.Errorf("got count %d, want %d", count, wantCount)
+			}
+		})
+	}
+}
+
+// ids of the rows, in order
+func ids(rows []sampleRow) string {
+	result := make([]string, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.ID)
+	}
+	return strings.Join(result, ",")
+}
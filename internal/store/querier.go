@@ -4,14 +4,22 @@ import (
 	"context"
 )
 
-// Querier is the interface used by GetById and Get
+// Querier is the interface used by GetById, Get and Stream
 type Querier interface {
 	GetContext(ctx context.Context, result interface{}, query string, args ...interface{}) error
 	SelectContext(ctx context.Context, result interface{}, query string, args ...interface{}) error
 }
 
+// getter runs queries that return a single row,
+// implemented by both Querier and Transaction
+type getter interface {
+	GetContext(ctx context.Context, result interface{}, query string, args ...interface{}) error
+}
+
 // Transaction is an interface used by Post, Put and Delete
 type Transaction interface {
+	// GetContext runs a query inside the transaction, like Querier.GetContext
+	GetContext(ctx context.Context, result interface{}, query string, args ...interface{}) error
 	PrepareNamed(ctx context.Context, sql string, mapping any) (Statement, []any, error)
 	Commit() error
 	Rollback()
@@ -30,3 +38,19 @@ type Executor interface {
 
 // Limiter builds a "LIMIT X, OFFSET Y" clause
 type Limiter func(offset, limit int) string
+
+// Key of the context of queries built from the request filters
+type dynamicKey struct{}
+
+// dynamicQuery marks the context of a query built from the request filters
+func dynamicQuery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dynamicKey{}, true)
+}
+
+// IsDynamicQuery is true for queries built from the request filters.
+// Their text changes with every filter, sort and page, so a Querier
+// should not cache their prepared statements.
+func IsDynamicQuery(ctx context.Context) bool {
+	dynamic, _ := ctx.Value(dynamicKey{}).(bool)
+	return dynamic
+}
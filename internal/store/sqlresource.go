@@ -2,9 +2,12 @@ package store
 
 import (
 	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/warpcomdev/videoapi/internal/crud"
 )
@@ -14,10 +17,21 @@ type Model interface {
 	GetID() string
 }
 
+// Versioned models expose the time of their last change,
+// used as entity tag for optimistic concurrency.
+type Versioned interface {
+	GetVersion() time.Time
+}
+
+// VersionColumn is the column behind Versioned.GetVersion
+const VersionColumn = "MODIFIED_AT"
+
 // EditableModel is a pointer to a Model, that allows modifications
 type EditableModel interface {
 	PrepareCreate() ([]string, error)
 	PrepareUpdate(id string) ([]string, error)
+	// PreparePatch receives the columns present in the patch
+	PreparePatch(id string, patched []string) ([]string, error)
 }
 
 // SQLResource manages database operations in a givem table
@@ -32,31 +46,48 @@ type SQLResource[T Model, P interface {
 	tableName string
 	columns   map[string]DbType
 	// Properties of the SQL dialect
-	limiter Limiter
+	dialect Dialect
+	// Optional, records every change
+	auditor Auditor
+	// Optional, table for the previous versions of the rows
+	history string
+	actor   ActorFunc
 }
 
 // New creates a Resource for the given table
 func New[T Model, P interface {
 	*T
 	EditableModel
-}](querier Querier, exec Executor, tableName string, columns map[string]DbType, limiter Limiter) SQLResource[T, P] {
+}](querier Querier, exec Executor, tableName string, columns map[string]DbType, dialect Dialect) SQLResource[T, P] {
 	return SQLResource[T, P]{
 		querier:   querier,
 		executor:  exec,
 		tableName: tableName,
 		columns:   columns,
-		limiter:   limiter,
+		dialect:   dialect,
 	}
 }
 
-// GetById searches the table for the given id
+// GetById searches the table for the given id. Soft deleted
+// resources are not found, they are only listed in the trash.
 func (r SQLResource[T, P]) GetById(ctx context.Context, id string) (t T, err error) {
+	return r.getById(ctx, id, false)
+}
+
+// getById searches the table for the given id,
+// including soft deleted resources if deleted is true
+func (r SQLResource[T, P]) getById(ctx context.Context, id string, deleted bool) (t T, err error) {
 	var sb strings.Builder
 	sb.WriteString("SELECT * FROM ")
 	sb.WriteString(r.tableName)
 	sb.WriteString(" WHERE id=? ")
-	sb.WriteString(r.limiter(0, 1))
-	if err := r.querier.GetContext(ctx, &t, sb.String(), id); err != nil {
+	if !deleted && softDeletes(r.columns) {
+		sb.WriteString("AND ")
+		sb.WriteString(DeletedColumn)
+		sb.WriteString(" IS NULL ")
+	}
+	sb.WriteString(r.dialect.Limiter(0, 1))
+	if err := r.getter(ctx).GetContext(ctx, &t, sb.String(), id); err != nil {
 		return t, QueryError{
 			Message: "failed to get resource",
 			Query:   sb.String(),
@@ -67,47 +98,226 @@ func (r SQLResource[T, P]) GetById(ctx context.Context, id string) (t T, err err
 	return t, nil
 }
 
+// getter returns the transaction of the batch, if any, so that
+// single row queries see the changes made by the batch
+func (r SQLResource[T, P]) getter(ctx context.Context) getter {
+	if tx, ok := ctx.Value(batchKey{}).(batchTx); ok {
+		return tx
+	}
+	return r.querier
+}
+
 // Get filtered (and possibly paginated) resources
-func (r SQLResource[T, P]) Get(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation, sort []string, ascending bool, offset, limit int) ([]T, error) {
+func (r SQLResource[T, P]) Get(ctx context.Context, query crud.Query) ([]T, error) {
+	sql, pp, err := r.selectQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var result []T
+	if err := r.querier.SelectContext(dynamicQuery(ctx), &result, sql, pp...); err != nil {
+		return nil, QueryError{
+			Message: "failed to filter resource",
+			Query:   sql,
+			Params:  pp,
+			Cause:   err,
+		}
+	}
+	if query.Cursor != nil && query.Cursor.Backward {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return result, nil
+}
+
+// Number of rows read at once by Stream
+const streamPageSize = 500
+
+// Stream calls f for every resource matching the filter, in order.
+// Pagination is ignored. Rows are read a page at a time, seeking with
+// a cursor, so that no connection is held while f runs (e.g. writing
+// the rows to a slow client).
+func (r SQLResource[T, P]) Stream(ctx context.Context, query crud.Query, f func(T) error) error {
+	query.Offset, query.Limit, query.Cursor = 0, streamPageSize, nil
+	key := query.SortKey()
+	for {
+		page, err := r.Get(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, t := range page {
+			if err := f(t); err != nil {
+				return err
+			}
+		}
+		if len(page) < streamPageSize {
+			return nil
+		}
+		if query.Cursor, err = cursorAt(&page[len(page)-1], key, false); err != nil {
+			return err
+		}
+	}
+}
+
+// selectQuery builds the query for Get
+func (r SQLResource[T, P]) selectQuery(query crud.Query) (string, []interface{}, error) {
 	var (
 		sb  strings.Builder
 		pp  []interface{} = make([]interface{}, 0, 16)
 		err error
 	)
-	sb.WriteString("SELECT * FROM ")
+	key := query.SortKey()
+	if query.Cursor != nil && len(query.Cursor.Values) != len(key) {
+		return "", nil, crud.ErrInvalidCursor
+	}
+	if err := checkSort(r.columns, key); err != nil {
+		return "", nil, err
+	}
+	if err := checkGeo(r.columns, query.Geo); err != nil {
+		return "", nil, err
+	}
+	t := reflect.TypeOf(*new(T))
+	columns, err := selectColumns(t, query.Fields, key)
+	if err != nil {
+		return "", nil, err
+	}
+	// The distance is not a column, it is computed when there is a near point.
+	var distance string
+	if query.Geo.Near != nil {
+		distance = distanceExpr(*query.Geo.Near)
+		key = replaceColumn(key, DistanceColumn, distance)
+	}
+	columns = replaceColumn(columns, DistanceColumn, "")
+	if _, ok := fieldsOf(t)[DistanceColumn]; ok && distance != "" {
+		if len(columns) == 0 {
+			columns = append(columns, r.tableName+".*")
+		}
+		columns = append(columns, distance+" AS "+DistanceColumn)
+	}
+	sb.WriteString("SELECT ")
+	if len(columns) > 0 {
+		sb.WriteString(strings.Join(columns, ", "))
+	} else {
+		sb.WriteString("*")
+	}
+	sb.WriteString(" FROM ")
 	sb.WriteString(r.tableName)
-	if filter != nil && len(filter) > 0 {
-		pp, err = r.where(&sb, pp, filter, outerOp, innerOp)
+	if r.filtered(query) {
+		pp, err = r.where(&sb, pp, query)
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 	}
-	if sort != nil && len(sort) > 0 {
-		sb.WriteString(" ORDER BY ")
-		sb.WriteString(strings.Join(sort, ", "))
-	} else {
-		sb.WriteString(" ORDER BY id")
+	// When seeking backwards, sort in reverse and flip the result later.
+	ascending := query.Ascending
+	offset := query.Offset
+	if query.Cursor != nil {
+		if query.Cursor.Backward {
+			ascending = !ascending
+		}
+		offset = 0
+		if r.filtered(query) {
+			sb.WriteString(" AND (")
+		} else {
+			sb.WriteString(" WHERE (")
+		}
+		pp = seek(&sb, pp, key, query.Cursor.Values, ascending)
+		sb.WriteString(")")
+	}
+	if offset < 0 {
+		offset = 0
 	}
+	// Explicit NULLS ordering, because the default differs between dialects.
+	// This one is the default in oracle and postgres.
+	sb.WriteString(" ORDER BY ")
+	for idx, col := range key {
+		if idx > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(col)
+		if ascending {
+			sb.WriteString(" ASC NULLS LAST")
+		} else {
+			sb.WriteString(" DESC NULLS FIRST")
+		}
+	}
+	sb.WriteString(" ")
+	sb.WriteString(r.dialect.Limiter(offset, query.Limit))
+	return sb.String(), pp, nil
+}
+
+// replaceColumn replaces the column in the list by the given expression,
+// or removes it if the expression is empty.
+func replaceColumn(columns []string, column, expr string) []string {
+	result := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if strings.EqualFold(col, column) {
+			if expr == "" {
+				continue
+			}
+			col = expr
+		}
+		result = append(result, col)
+	}
+	return result
+}
+
+// seek builds the condition for rows after the given sort key values,
+// i.e. "(a, b, id) > (?, ?, ?)" expanded so that every dialect supports it.
+// NULLs sort last, same as in the ORDER BY clause.
+func seek(sb *strings.Builder, pp []interface{}, key []string, values []driver.Value, ascending bool) []interface{} {
+	col, val := key[0], values[0]
+	// Primary key can not be null
+	nullable := !strings.EqualFold(col, "id")
+	switch {
+	case val == nil && ascending:
+		// Only other NULLs can follow a NULL
+		if len(key) == 1 {
+			sb.WriteString("1=0")
+			return pp
+		}
+		sb.WriteString(col)
+		sb.WriteString(" IS NULL AND (")
+		pp = seek(sb, pp, key[1:], values[1:], ascending)
+		sb.WriteString(")")
+		return pp
+	case val == nil:
+		sb.WriteString(col)
+		sb.WriteString(" IS NOT NULL")
+		if len(key) > 1 {
+			sb.WriteString(" OR (")
+			sb.WriteString(col)
+			sb.WriteString(" IS NULL AND (")
+			pp = seek(sb, pp, key[1:], values[1:], ascending)
+			sb.WriteString("))")
+		}
+		return pp
+	}
+	sb.WriteString(col)
 	if ascending {
-		sb.WriteString(" ASC ")
+		sb.WriteString(" > ?")
 	} else {
-		sb.WriteString(" DESC ")
+		sb.WriteString(" < ?")
 	}
-	sb.WriteString(r.limiter(offset, limit))
-	var result []T
-	if err := r.querier.SelectContext(ctx, &result, sb.String(), pp...); err != nil {
-		return nil, QueryError{
-			Message: "failed to filter resource",
-			Query:   sb.String(),
-			Params:  pp,
-			Cause:   err,
-		}
+	pp = append(pp, val)
+	if ascending && nullable {
+		sb.WriteString(" OR ")
+		sb.WriteString(col)
+		sb.WriteString(" IS NULL")
 	}
-	return result, nil
+	if len(key) > 1 {
+		sb.WriteString(" OR (")
+		sb.WriteString(col)
+		sb.WriteString(" = ? AND (")
+		pp = append(pp, val)
+		pp = seek(sb, pp, key[1:], values[1:], ascending)
+		sb.WriteString("))")
+	}
+	return pp
 }
 
 // Count filtered resources
-func (r SQLResource[T, P]) Count(ctx context.Context, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) (uint64, error) {
+func (r SQLResource[T, P]) Count(ctx context.Context, query crud.Query) (uint64, error) {
 	var (
 		sb  strings.Builder
 		pp  []interface{} = make([]interface{}, 0, 16)
@@ -115,14 +325,14 @@ func (r SQLResource[T, P]) Count(ctx context.Context, filter []crud.Filter, oute
 	)
 	sb.WriteString("SELECT COUNT(*) FROM ")
 	sb.WriteString(r.tableName)
-	if filter != nil && len(filter) > 0 {
-		pp, err = r.where(&sb, pp, filter, outerOp, innerOp)
+	if r.filtered(query) {
+		pp, err = r.where(&sb, pp, query)
 		if err != nil {
 			return 0, err
 		}
 	}
 	var result []uint64
-	if err := r.querier.SelectContext(ctx, &result, sb.String(), pp...); err != nil {
+	if err := r.querier.SelectContext(dynamicQuery(ctx), &result, sb.String(), pp...); err != nil {
 		return 0, QueryError{
 			Message: "failed to filter resource",
 			Query:   sb.String(),
@@ -136,55 +346,257 @@ func (r SQLResource[T, P]) Count(ctx context.Context, filter []crud.Filter, oute
 	return result[0], nil
 }
 
+// Tags counts the resources with each tag, per camera
+func (r SQLResource[T, P]) Tags(ctx context.Context, query crud.Query) ([]TagCount, error) {
+	var (
+		sb  strings.Builder
+		pp  []interface{} = make([]interface{}, 0, 16)
+		err error
+	)
+	elements, element := r.dialect.JsonElements("T." + TagsColumn)
+	sb.WriteString("SELECT T.")
+	sb.WriteString(TagsGroupColumn)
+	sb.WriteString(", ")
+	sb.WriteString(element)
+	sb.WriteString(" AS TAG, COUNT(*) AS TOTAL FROM (SELECT ")
+	sb.WriteString(TagsGroupColumn)
+	sb.WriteString(", ")
+	sb.WriteString(TagsColumn)
+	sb.WriteString(" FROM ")
+	sb.WriteString(r.tableName)
+	if r.filtered(query) {
+		pp, err = r.where(&sb, pp, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sb.WriteString(") T, ")
+	sb.WriteString(elements)
+	sb.WriteString(" GROUP BY T.")
+	sb.WriteString(TagsGroupColumn)
+	sb.WriteString(", ")
+	sb.WriteString(element)
+	sb.WriteString(" ORDER BY T.")
+	sb.WriteString(TagsGroupColumn)
+	sb.WriteString(", ")
+	sb.WriteString(element)
+	var result []TagCount
+	if err := r.querier.SelectContext(dynamicQuery(ctx), &result, sb.String(), pp...); err != nil {
+		return nil, QueryError{
+			Message: "failed to count tags",
+			Query:   sb.String(),
+			Params:  pp,
+			Cause:   err,
+		}
+	}
+	return result, nil
+}
+
+// Stats counts the resources per group and time bucket
+func (r SQLResource[T, P]) Stats(ctx context.Context, query crud.Query, agg crud.Aggregation) ([]StatCount, error) {
+	var (
+		sb  strings.Builder
+		pp  []interface{} = make([]interface{}, 0, 16)
+		err error
+	)
+	fields, err := checkAggregation(r.columns, agg)
+	if err != nil {
+		return nil, err
+	}
+	// Columns of the inner query, and expressions to group by
+	var (
+		columns  []string
+		exprs    []string
+		selected []string
+		from     string
+	)
+	for idx, group := range agg.GroupBy {
+		column := strings.ToUpper(fields[idx])
+		columns = append(columns, column)
+		if group == crud.GROUP_TAG {
+			elements, element := r.dialect.JsonElements("T." + column)
+			from = ", " + elements
+			exprs = append(exprs, element)
+			selected = append(selected, element+" AS TAG")
+			continue
+		}
+		exprs = append(exprs, "T."+column)
+		selected = append(selected, "T."+column+" AS "+column)
+	}
+	if agg.Bucket != crud.BUCKET_NONE {
+		columns = append(columns, BucketColumn)
+		bucket := r.dialect.TimeBucket("T."+BucketColumn, agg.Bucket)
+		exprs = append([]string{bucket}, exprs...)
+		selected = append(selected, bucket+" AS BUCKET")
+	}
+	if len(columns) == 0 {
+		columns = append(columns, "ID")
+	}
+	sb.WriteString("SELECT ")
+	for _, item := range selected {
+		sb.WriteString(item)
+		sb.WriteString(", ")
+	}
+	sb.WriteString("COUNT(*) AS TOTAL FROM (SELECT ")
+	sb.WriteString(strings.Join(columns, ", "))
+	sb.WriteString(" FROM ")
+	sb.WriteString(r.tableName)
+	if r.filtered(query) {
+		pp, err = r.where(&sb, pp, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sb.WriteString(") T")
+	sb.WriteString(from)
+	if len(exprs) > 0 {
+		sb.WriteString(" GROUP BY ")
+		sb.WriteString(strings.Join(exprs, ", "))
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(exprs, ", "))
+	}
+	var result []StatCount
+	if err := r.querier.SelectContext(dynamicQuery(ctx), &result, sb.String(), pp...); err != nil {
+		return nil, QueryError{
+			Message: "failed to compute stats",
+			Query:   sb.String(),
+			Params:  pp,
+			Cause:   err,
+		}
+	}
+	return result, nil
+}
+
+// filtered is true if the query needs a where clause. Soft deleted
+// rows are filtered out, unless the query includes them.
+func (r SQLResource[T, P]) filtered(query crud.Query) bool {
+	if query.HasFilter() || query.Deleted == crud.DELETED_ONLY {
+		return true
+	}
+	return query.Deleted == crud.DELETED_EXCLUDE && softDeletes(r.columns)
+}
+
 // Where builds the where clause of a select or count query
-func (r SQLResource[T, P]) where(sb *strings.Builder, pp []interface{}, filter []crud.Filter, outerOp crud.OuterOperation, innerOp crud.InnerOperation) ([]interface{}, error) {
+func (r SQLResource[T, P]) where(sb *strings.Builder, pp []interface{}, query crud.Query) ([]interface{}, error) {
+	if err := checkGeo(r.columns, query.Geo); err != nil {
+		return nil, err
+	}
+	if err := checkDeleted(r.columns, query.Deleted); err != nil {
+		return nil, err
+	}
 	sb.WriteString(" WHERE (")
-	sep := ""
-	formatedOuterSep := fmt.Sprintf(") %s (", outerOp)
-	formatedInnerSep := fmt.Sprintf(" %s ", innerOp)
-	for _, f := range filter {
-		dbtype, ok := r.columns[f.Field]
-		if !ok {
-			return nil, fmt.Errorf("column %s does not exist", f.Field)
-		}
-		sb.WriteString(sep)
-		sep = formatedOuterSep
-		innerSep := ""
-		for _, v := range f.Values {
-			var (
-				cond string
-				val  interface{}
-				err  error
-			)
-			if v == "NULL" {
-				switch f.Operator {
-				case crud.OP_EQ:
-					cond = f.Field + " IS NULL"
-				case crud.OP_NE:
-					cond = f.Field + " IS NOT NULL"
-				default:
-					return nil, fmt.Errorf("unsupported operador %s for value NULL", f.Operator)
+	// Separator between filters, expression and geo filter
+	and := ""
+	if len(query.Filter) > 0 {
+		sb.WriteString("(")
+		sep := ""
+		formatedOuterSep := fmt.Sprintf(") %s (", query.OuterOp)
+		formatedInnerSep := fmt.Sprintf(" %s ", query.InnerOp)
+		for _, f := range query.Filter {
+			sb.WriteString(sep)
+			sep = formatedOuterSep
+			innerSep := ""
+			for _, v := range f.Values {
+				sb.WriteString(innerSep)
+				innerSep = formatedInnerSep
+				var err error
+				if pp, err = r.condition(sb, pp, f, filterValues(f.Operator, v)); err != nil {
+					return nil, err
 				}
-			} else {
-				cond, val, err = dbtype.Where(f.Field, f.Operator, v)
-			}
-			if err != nil {
-				return nil, err
-			}
-			sb.WriteString(innerSep)
-			innerSep = formatedInnerSep
-			sb.WriteString(cond)
-			if val != nil {
-				pp = append(pp, val)
 			}
 		}
+		sb.WriteString(")")
+		and = " AND "
+	}
+	if query.Expr != nil {
+		sb.WriteString(and)
+		var err error
+		if pp, err = r.expr(sb, pp, *query.Expr); err != nil {
+			return nil, err
+		}
+		and = " AND "
+	}
+	if query.Geo.HasFilter() {
+		sb.WriteString(and)
+		cond, params := whereGeo(query.Geo)
+		sb.WriteString(cond)
+		pp = append(pp, params...)
+		and = " AND "
+	}
+	if softDeletes(r.columns) {
+		switch query.Deleted {
+		case crud.DELETED_EXCLUDE:
+			sb.WriteString(and)
+			sb.WriteString(DeletedColumn + " IS NULL")
+		case crud.DELETED_ONLY:
+			sb.WriteString(and)
+			sb.WriteString(DeletedColumn + " IS NOT NULL")
+		}
 	}
 	sb.WriteString(")")
 	return pp, nil
 }
 
+// expr builds the condition for a filter expression
+func (r SQLResource[T, P]) expr(sb *strings.Builder, pp []interface{}, e crud.Expr) ([]interface{}, error) {
+	if e.Cond != nil {
+		return r.condition(sb, pp, *e.Cond, e.Cond.Values)
+	}
+	if e.Op == crud.EXPR_NOT {
+		sb.WriteString("NOT ")
+	}
+	sb.WriteString("(")
+	for idx, term := range e.Terms {
+		if idx > 0 {
+			sb.WriteString(" ")
+			sb.WriteString(strings.ToUpper(string(e.Op)))
+			sb.WriteString(" ")
+		}
+		var err error
+		if pp, err = r.expr(sb, pp, term); err != nil {
+			return nil, err
+		}
+	}
+	sb.WriteString(")")
+	return pp, nil
+}
+
+// condition builds the condition for a single value of a filter,
+// or all the values of a list operator
+func (r SQLResource[T, P]) condition(sb *strings.Builder, pp []interface{}, f crud.Filter, vals []string) ([]interface{}, error) {
+	dbtype, ok := r.columns[f.Field]
+	if !ok {
+		return nil, crud.ErrInvalidColumn
+	}
+	op := f.Operator
+	// Legacy NULL literal, same as isnull / notnull
+	if isNull(vals) && !op.Unary() {
+		switch op {
+		case crud.OP_EQ:
+			op = crud.OP_ISNULL
+		case crud.OP_NE:
+			op = crud.OP_NOTNULL
+		default:
+			return nil, crud.ErrInvalidOperator
+		}
+	}
+	cond, params, err := dbtype.Where(r.dialect, f.Field, op, vals)
+	if err != nil {
+		return nil, err
+	}
+	sb.WriteString(cond)
+	return append(pp, params...), nil
+}
+
 // Post creates a resource in the database
 func (r SQLResource[T, P]) Post(ctx context.Context, t T) (string, error) {
+	return r.audited(ctx, ACTION_CREATE, "", func(ctx context.Context) (string, error) {
+		return r.create(ctx, t)
+	})
+}
+
+// create inserts the resource
+func (r SQLResource[T, P]) create(ctx context.Context, t T) (string, error) {
 	cols, err := P(&t).PrepareCreate()
 	if err != nil {
 		return "", err
@@ -195,12 +607,13 @@ func (r SQLResource[T, P]) Post(ctx context.Context, t T) (string, error) {
 	sb.WriteString(" (")
 	sb.WriteString(strings.Join(cols, ", "))
 	sb.WriteString(") VALUES (:")
-	sb.WriteString(strings.ToUpper(strings.Join(cols, ", :")))
+	sb.WriteString(r.dialect.Fold(strings.Join(cols, ", :")))
 	sb.WriteString(")")
-	tx, err := r.executor.Begin(ctx)
+	tx, err := r.begin(ctx)
 	if err != nil {
 		return "", err
 	}
+	defer tx.Rollback()
 	stmt, args, err := tx.PrepareNamed(ctx, sb.String(), t)
 	if err != nil {
 		return "", err
@@ -208,7 +621,6 @@ func (r SQLResource[T, P]) Post(ctx context.Context, t T) (string, error) {
 	defer stmt.Close()
 	affected, err := stmt.Execute(ctx, args...)
 	if err != nil {
-		tx.Rollback()
 		return "", QueryError{
 			Message: "failed to create resource",
 			Query:   stmt.QueryString(),
@@ -236,6 +648,30 @@ func (r SQLResource[T, P]) Put(ctx context.Context, id string, t T) error {
 	if err != nil {
 		return err
 	}
+	_, err = r.audited(ctx, ACTION_UPDATE, id, func(ctx context.Context) (string, error) {
+		return id, r.update(ctx, t, cols)
+	})
+	return err
+}
+
+// Patch updates only the given columns of a resource in the database.
+// Nullable columns may be set to NULL.
+func (r SQLResource[T, P]) Patch(ctx context.Context, id string, t T, patched []string) error {
+	if id == "" {
+		return errors.New("cannot update resource with empty id")
+	}
+	cols, err := P(&t).PreparePatch(id, patched)
+	if err != nil {
+		return err
+	}
+	_, err = r.audited(ctx, ACTION_PATCH, id, func(ctx context.Context) (string, error) {
+		return id, r.update(ctx, t, cols)
+	})
+	return err
+}
+
+// update the given columns of the resource
+func (r SQLResource[T, P]) update(ctx context.Context, t T, cols []string) error {
 	var sb strings.Builder
 	sb.WriteString("UPDATE ")
 	sb.WriteString(r.tableName)
@@ -246,13 +682,24 @@ func (r SQLResource[T, P]) Put(ctx context.Context, id string, t T) error {
 		sep = ", "
 		sb.WriteString(col)
 		sb.WriteString("=:")
-		sb.WriteString(strings.ToUpper(col))
+		sb.WriteString(r.dialect.Fold(col))
 	}
-	sb.WriteString(" WHERE id=:ID")
-	tx, err := r.executor.Begin(ctx)
+	sb.WriteString(" WHERE id=:")
+	sb.WriteString(r.dialect.Fold("ID"))
+	// Resources in the trash can only be restored
+	if softDeletes(r.columns) {
+		sb.WriteString(" AND ")
+		sb.WriteString(DeletedColumn)
+		sb.WriteString(" IS NULL")
+	}
+	tx, err := r.begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+	if err := r.checkVersion(ctx, tx, t.GetID()); err != nil {
+		return err
+	}
 	stmt, args, err := tx.PrepareNamed(ctx, sb.String(), t)
 	if err != nil {
 		return err
@@ -260,7 +707,6 @@ func (r SQLResource[T, P]) Put(ctx context.Context, id string, t T) error {
 	defer stmt.Close()
 	affected, err := stmt.Execute(ctx, args...)
 	if err != nil {
-		tx.Rollback()
 		return QueryError{
 			Message: "failed to update resource",
 			Query:   stmt.QueryString(),
@@ -273,7 +719,7 @@ func (r SQLResource[T, P]) Put(ctx context.Context, id string, t T) error {
 		return err
 	}
 	if affected == 0 {
-		return errors.New("resource not found")
+		return crud.ErrNotFound
 	}
 	return nil
 }
@@ -282,32 +728,351 @@ type deleteReq struct {
 	ID string `db:"ID"`
 }
 
-// Delete a resource from the database
+type softDeleteReq struct {
+	ID         string    `db:"ID"`
+	DeletedAt  time.Time `db:"DELETED_AT"`
+	ModifiedAt time.Time `db:"MODIFIED_AT"`
+}
+
+type restoreReq struct {
+	ID         string    `db:"ID"`
+	ModifiedAt time.Time `db:"MODIFIED_AT"`
+}
+
+// Delete a resource from the database. If the table supports
+// soft delete, the row is only marked as deleted.
 func (r SQLResource[T, P]) Delete(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("cannot remove resource with empty id")
 	}
+	_, err := r.audited(ctx, ACTION_DELETE, id, func(ctx context.Context) (string, error) {
+		return id, r.remove(ctx, id)
+	})
+	return err
+}
+
+// remove the resource, or mark it as deleted
+func (r SQLResource[T, P]) remove(ctx context.Context, id string) error {
+	var (
+		sb     strings.Builder
+		params any
+	)
+	if softDeletes(r.columns) {
+		now := time.Now()
+		sb.WriteString("UPDATE ")
+		sb.WriteString(r.tableName)
+		sb.WriteString(" SET ")
+		sb.WriteString(DeletedColumn)
+		sb.WriteString("=:")
+		sb.WriteString(r.dialect.Fold(DeletedColumn))
+		sb.WriteString(", ")
+		sb.WriteString(VersionColumn)
+		sb.WriteString("=:")
+		sb.WriteString(r.dialect.Fold(VersionColumn))
+		sb.WriteString(" WHERE id=:")
+		sb.WriteString(r.dialect.Fold("ID"))
+		sb.WriteString(" AND ")
+		sb.WriteString(DeletedColumn)
+		sb.WriteString(" IS NULL")
+		params = softDeleteReq{ID: id, DeletedAt: now, ModifiedAt: now}
+	} else {
+		sb.WriteString("DELETE FROM ")
+		sb.WriteString(r.tableName)
+		sb.WriteString(" WHERE id=:")
+		sb.WriteString(r.dialect.Fold("ID"))
+		params = deleteReq{ID: id}
+	}
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := r.checkVersion(ctx, tx, id); err != nil {
+		return err
+	}
+	stmt, args, err := tx.PrepareNamed(ctx, sb.String(), params)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if _, err := stmt.Execute(ctx, args...); err != nil {
+		return QueryError{
+			Message: "failed to delete resource",
+			Query:   stmt.QueryString(),
+			Params:  id,
+			Cause:   err,
+		}
+	}
+	return tx.Commit()
+}
+
+// Restore a soft deleted resource. Fails with crud.ErrNotFound
+// if the resource does not exist or is not deleted.
+func (r SQLResource[T, P]) Restore(ctx context.Context, id string) error {
+	if !softDeletes(r.columns) {
+		return crud.ErrNotFound
+	}
+	_, err := r.audited(ctx, ACTION_RESTORE, id, func(ctx context.Context) (string, error) {
+		return id, r.restore(ctx, id)
+	})
+	return err
+}
+
+// restore clears the deletion mark of the resource
+func (r SQLResource[T, P]) restore(ctx context.Context, id string) error {
+	var sb strings.Builder
+	sb.WriteString("UPDATE ")
+	sb.WriteString(r.tableName)
+	sb.WriteString(" SET ")
+	sb.WriteString(DeletedColumn)
+	sb.WriteString("=NULL, ")
+	sb.WriteString(VersionColumn)
+	sb.WriteString("=:")
+	sb.WriteString(r.dialect.Fold(VersionColumn))
+	sb.WriteString(" WHERE id=:")
+	sb.WriteString(r.dialect.Fold("ID"))
+	sb.WriteString(" AND ")
+	sb.WriteString(DeletedColumn)
+	sb.WriteString(" IS NOT NULL")
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := r.checkVersion(ctx, tx, id); err != nil {
+		return err
+	}
+	stmt, args, err := tx.PrepareNamed(ctx, sb.String(), restoreReq{ID: id, ModifiedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	affected, err := stmt.Execute(ctx, args...)
+	if err != nil {
+		return QueryError{
+			Message: "failed to restore resource",
+			Query:   stmt.QueryString(),
+			Params:  id,
+			Cause:   err,
+		}
+	}
+	if affected != 1 {
+		return crud.ErrNotFound
+	}
+	return tx.Commit()
+}
+
+type purgeRow struct {
+	ID string `db:"ID"`
+}
+
+// Purge removes for good the rows deleted before the given time.
+// Rows are removed one by one, so that rows still referenced by
+// other tables do not prevent purging the rest.
+func (r SQLResource[T, P]) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	if !softDeletes(r.columns) {
+		return nil, crud.ErrNotFound
+	}
 	var sb strings.Builder
+	sb.WriteString("SELECT ID FROM ")
+	sb.WriteString(r.tableName)
+	sb.WriteString(" WHERE ")
+	sb.WriteString(DeletedColumn)
+	sb.WriteString(" < ?")
+	var rows []purgeRow
+	if err := r.querier.SelectContext(ctx, &rows, sb.String(), before); err != nil {
+		return nil, QueryError{
+			Message: "failed to list deleted resources",
+			Query:   sb.String(),
+			Params:  before,
+			Cause:   err,
+		}
+	}
+	sb.Reset()
 	sb.WriteString("DELETE FROM ")
 	sb.WriteString(r.tableName)
-	sb.WriteString(" WHERE id=:ID")
+	sb.WriteString(" WHERE id=:")
+	sb.WriteString(r.dialect.Fold("ID"))
+	sb.WriteString(" AND ")
+	sb.WriteString(DeletedColumn)
+	sb.WriteString(" IS NOT NULL")
+	query := sb.String()
+	purged := make([]string, 0, len(rows))
+	var errs error
+	for _, row := range rows {
+		err := r.Batch(ctx, func(ctx context.Context) error {
+			_, err := r.audited(ctx, ACTION_PURGE, row.ID, func(ctx context.Context) (string, error) {
+				tx, err := r.begin(ctx)
+				if err != nil {
+					return "", err
+				}
+				defer tx.Rollback()
+				stmt, args, err := tx.PrepareNamed(ctx, query, deleteReq{ID: row.ID})
+				if err != nil {
+					return "", err
+				}
+				defer stmt.Close()
+				if _, err := stmt.Execute(ctx, args...); err != nil {
+					return "", QueryError{
+						Message: "failed to purge resource",
+						Query:   stmt.QueryString(),
+						Params:  row.ID,
+						Cause:   err,
+					}
+				}
+				return row.ID, nil
+			})
+			return err
+		})
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		purged = append(purged, row.ID)
+	}
+	return purged, errs
+}
+
+// Key of the batch transaction in the context
+type batchKey struct{}
+
+// batchTx is the transaction shared by all the operations in a Batch.
+// Only the Batch may commit it or roll it back.
+type batchTx struct {
+	Transaction
+	depth int
+}
+
+// Commit implements Transaction
+func (tx batchTx) Commit() error {
+	return nil
+}
+
+// Rollback implements Transaction
+func (tx batchTx) Rollback() {}
+
+// begin a transaction, or join the one started by Batch
+func (r SQLResource[T, P]) begin(ctx context.Context) (Transaction, error) {
+	if tx, ok := ctx.Value(batchKey{}).(batchTx); ok {
+		return tx, nil
+	}
+	return r.executor.Begin(ctx)
+}
+
+// Batch runs f in a single transaction, committed only if f succeeds.
+// Nested batches run inside a savepoint, so they can fail
+// without rolling back the whole transaction.
+func (r SQLResource[T, P]) Batch(ctx context.Context, f func(context.Context) error) error {
+	if tx, ok := ctx.Value(batchKey{}).(batchTx); ok {
+		return r.savepoint(ctx, tx, f)
+	}
 	tx, err := r.executor.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	stmt, args, err := tx.PrepareNamed(ctx, sb.String(), deleteReq{ID: id})
+	defer tx.Rollback()
+	if err := f(context.WithValue(ctx, batchKey{}, batchTx{Transaction: tx})); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// savepoint runs f inside a savepoint of the transaction
+func (r SQLResource[T, P]) savepoint(ctx context.Context, tx batchTx, f func(context.Context) error) error {
+	nested := batchTx{Transaction: tx.Transaction, depth: tx.depth + 1}
+	name := fmt.Sprintf("BATCH_%d", nested.depth)
+	if err := r.exec(ctx, tx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	if err := f(context.WithValue(ctx, batchKey{}, nested)); err != nil {
+		if rbErr := r.exec(ctx, tx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return fmt.Errorf("%w (%s)", rbErr, err.Error())
+		}
+		return err
+	}
+	if r.dialect.ReleaseSavepoint {
+		return r.exec(ctx, tx, "RELEASE SAVEPOINT "+name)
+	}
+	return nil
+}
+
+// exec runs a statement without parameters in the transaction
+func (r SQLResource[T, P]) exec(ctx context.Context, tx Transaction, query string) error {
+	stmt, args, err := tx.PrepareNamed(ctx, query, map[string]interface{}{})
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 	if _, err := stmt.Execute(ctx, args...); err != nil {
-		tx.Rollback()
 		return QueryError{
-			Message: "failed to delete resource",
+			Message: "failed to run statement",
+			Query:   query,
+			Cause:   err,
+		}
+	}
+	return nil
+}
+
+// checkVersion enforces the If-Match precondition, if any. It locks the row
+// for the rest of the transaction, and fails with crud.ErrPreconditionFailed
+// if the version of the resource does not match any of the tags.
+func (r SQLResource[T, P]) checkVersion(ctx context.Context, tx Transaction, id string) error {
+	tags, ok := crud.IfMatchFrom(ctx)
+	if !ok {
+		return nil
+	}
+	var sb strings.Builder
+	sb.WriteString("UPDATE ")
+	sb.WriteString(r.tableName)
+	sb.WriteString(" SET ")
+	sb.WriteString(VersionColumn)
+	sb.WriteString("=")
+	sb.WriteString(VersionColumn)
+	sb.WriteString(" WHERE id=:ID")
+	// Map keys are not folded by the mapper, unlike struct tags
+	params := map[string]interface{}{"ID": id}
+	versions := make([]string, 0, len(tags))
+	anyVersion := false
+	for _, tag := range tags {
+		if tag == "*" {
+			anyVersion = true
+			break
+		}
+		version, err := crud.ParseETag(tag)
+		if err != nil {
+			// Not one of ours, can not match
+			continue
+		}
+		name := fmt.Sprintf("V%d", len(versions))
+		params[name] = version
+		versions = append(versions, ":"+name)
+	}
+	if !anyVersion {
+		if len(versions) == 0 {
+			return crud.ErrPreconditionFailed
+		}
+		sb.WriteString(" AND ")
+		sb.WriteString(VersionColumn)
+		sb.WriteString(" IN (")
+		sb.WriteString(strings.Join(versions, ", "))
+		sb.WriteString(")")
+	}
+	stmt, args, err := tx.PrepareNamed(ctx, sb.String(), params)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	affected, err := stmt.Execute(ctx, args...)
+	if err != nil {
+		return QueryError{
+			Message: "failed to check resource version",
 			Query:   stmt.QueryString(),
-			Params:  id,
+			Params:  params,
 			Cause:   err,
 		}
 	}
-	return tx.Commit()
+	if affected == 0 {
+		return crud.ErrPreconditionFailed
+	}
+	return nil
 }
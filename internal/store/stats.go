@@ -0,0 +1,132 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Column that time buckets are computed from
+const BucketColumn = "TIMESTAMP"
+
+// Bucket is the start of a time bucket, in UTC
+type Bucket struct {
+	time.Time
+}
+
+// Scan implements sql.Scanner. Sqlite returns the bucket as text.
+func (b *Bucket) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		b.Time = v.UTC()
+		return nil
+	case []byte:
+		return b.parse(string(v))
+	case string:
+		return b.parse(v)
+	}
+	return fmt.Errorf("unsupported bucket type %T", src)
+}
+
+func (b *Bucket) parse(text string) error {
+	t, err := time.Parse("2006-01-02 15:04:05Z07:00", text)
+	if err != nil {
+		return err
+	}
+	b.Time = t.UTC()
+	return nil
+}
+
+// bucketOf truncates the time to the start of its bucket
+func bucketOf(t time.Time, bucket crud.Bucket) Bucket {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch bucket {
+	case crud.BUCKET_HOUR:
+		return Bucket{Time: t.Truncate(time.Hour)}
+	case crud.BUCKET_WEEK:
+		// Weeks start on monday
+		return Bucket{Time: day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))}
+	}
+	return Bucket{Time: day}
+}
+
+// StatCount is the number of resources in a group and time bucket.
+// Only the attributes in the aggregation are set.
+type StatCount struct {
+	Camera   string  `json:"camera,omitempty" db:"CAMERA"`
+	Severity string  `json:"severity,omitempty" db:"SEVERITY"`
+	Tag      string  `json:"tag,omitempty" db:"TAG"`
+	Bucket   *Bucket `json:"bucket,omitempty" db:"BUCKET"`
+	Count    uint64  `json:"count" db:"TOTAL"`
+}
+
+// set the value of a group attribute
+func (s *StatCount) set(group, value string) {
+	switch group {
+	case crud.GROUP_CAMERA:
+		s.Camera = value
+	case crud.GROUP_SEVERITY:
+		s.Severity = value
+	case crud.GROUP_TAG:
+		s.Tag = value
+	}
+}
+
+// Aggregator is implemented by stores that can count resources in groups
+type Aggregator interface {
+	// Stats counts the resources matching the query filter, per group
+	// and time bucket. Sorting and pagination are ignored.
+	Stats(ctx context.Context, query crud.Query, agg crud.Aggregation) ([]StatCount, error)
+}
+
+// checkAggregation verifies the table has the columns to group by.
+// Returns the column behind each group.
+func checkAggregation(columns map[string]DbType, agg crud.Aggregation) ([]string, error) {
+	result := make([]string, 0, len(agg.GroupBy))
+	for _, group := range agg.GroupBy {
+		field, expected := group, DbType(StringDbType{})
+		if group == crud.GROUP_TAG {
+			field, expected = "tags", JsonDbType{}
+		}
+		if dbtype, ok := columns[field]; !ok || dbtype != expected {
+			return nil, crud.ErrInvalidAggregation
+		}
+		result = append(result, field)
+	}
+	if agg.Bucket != crud.BUCKET_NONE {
+		if dbtype, ok := columns["timestamp"]; !ok || dbtype != DbType(TimeDbType{}) {
+			return nil, crud.ErrInvalidAggregation
+		}
+	}
+	return result, nil
+}
+
+type statsResult struct {
+	Data []StatCount `json:"data"`
+}
+
+// Stats implements crud.Aggregator, if the store supports it
+func (vr Adaptor[T]) Stats(ctx context.Context, query crud.Query, agg crud.Aggregation) (io.ReadCloser, error) {
+	aggregator, ok := vr.Resource.(Aggregator)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	counts, err := aggregator.Stats(ctx, query, agg)
+	if err != nil {
+		return nil, err
+	}
+	if counts == nil {
+		counts = make([]StatCount, 0)
+	}
+	data, err := json.Marshal(statsResult{Data: counts})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
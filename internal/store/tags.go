@@ -0,0 +1,55 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// Columns used by the tag summary: the json array
+// of tags, and the column to group the counts by.
+const (
+	TagsColumn      = "TAGS"
+	TagsGroupColumn = "CAMERA"
+)
+
+// TagCount is the number of resources with a tag, per camera
+type TagCount struct {
+	Camera string `json:"camera" db:"CAMERA"`
+	Tag    string `json:"tag" db:"TAG"`
+	Count  uint64 `json:"count" db:"TOTAL"`
+}
+
+// TagCounter is implemented by stores of resources with tags
+type TagCounter interface {
+	// Tags counts the resources matching the query filter with each tag,
+	// per camera. Sorting and pagination are ignored.
+	Tags(ctx context.Context, query crud.Query) ([]TagCount, error)
+}
+
+type tagsResult struct {
+	Data []TagCount `json:"data"`
+}
+
+// Tags implements crud.TagCounter, if the store supports it
+func (vr Adaptor[T]) Tags(ctx context.Context, query crud.Query) (io.ReadCloser, error) {
+	counter, ok := vr.Resource.(TagCounter)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	counts, err := counter.Tags(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if counts == nil {
+		counts = make([]TagCount, 0)
+	}
+	data, err := json.Marshal(tagsResult{Data: counts})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/crud"
+)
+
+// DeletedColumn marks soft deleted rows, with the time of deletion.
+// Tables with this column keep deleted rows until purged.
+const DeletedColumn = "DELETED_AT"
+
+// SoftDeleter is implemented by stores that keep deleted resources
+type SoftDeleter interface {
+	// Restore a deleted resource
+	Restore(ctx context.Context, id string) error
+	// Purge removes for good the resources deleted before the given time.
+	// Returns the ids of the purged resources.
+	Purge(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// softDeletes is true if the table has the DeletedColumn
+func softDeletes(columns map[string]DbType) bool {
+	_, ok := columns["deleted_at"]
+	return ok
+}
+
+// checkDeleted verifies the table supports the query's deleted mode
+func checkDeleted(columns map[string]DbType, deleted crud.Deleted) error {
+	if deleted == crud.DELETED_ONLY && !softDeletes(columns) {
+		return crud.ErrNotFound
+	}
+	return nil
+}
+
+// Restore implements crud.Trash, if the store supports it
+func (vr Adaptor[T]) Restore(ctx context.Context, id string) error {
+	deleter, ok := vr.Resource.(SoftDeleter)
+	if !ok {
+		return crud.ErrNotFound
+	}
+	return deleter.Restore(ctx, id)
+}
+
+// Purge implements crud.Trash, if the store supports it
+func (vr Adaptor[T]) Purge(ctx context.Context, before time.Time) ([]string, error) {
+	deleter, ok := vr.Resource.(SoftDeleter)
+	if !ok {
+		return nil, crud.ErrNotFound
+	}
+	return deleter.Purge(ctx, before)
+}
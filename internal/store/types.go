@@ -1,23 +1,37 @@
 package store
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/warpcomdev/videoapi/internal/crud"
 )
 
 // DBType represents a database column type that can be filtered
 type DbType interface {
-	Where(field string, op crud.Operator, val string) (string, interface{}, error)
+	// Where builds the SQL condition and the parameters to bind.
+	// List operators take all the values, the rest only the first one.
+	Where(dialect Dialect, field string, op crud.Operator, vals []string) (string, []interface{}, error)
+	// Match evaluates the condition against a column value, without database.
+	// A nil column is NULL, and only matches isnull (just like in SQL),
+	// or ne / nin for json lists, where NULL is an empty list.
+	Match(column driver.Value, op crud.Operator, vals []string) (bool, error)
 }
 
 // Set of all fields that can be used as filter
 type FilterSet map[string]DbType
 
-// StringDbType represents a string column
-type StringDbType struct{}
+// Maximum number of values in a list operator.
+// Oracle does not support more than 1000 items in an IN list.
+const maxListValues = 1000
+
+// parseFunc converts the value of a filter to the column type
+type parseFunc func(val string) (driver.Value, error)
 
 func sqlOp(op crud.Operator) (string, error) {
 	switch op {
@@ -40,54 +54,336 @@ func sqlOp(op crud.Operator) (string, error) {
 	}
 }
 
-func (s StringDbType) Where(field string, op crud.Operator, val string) (string, interface{}, error) {
-	textOp, err := sqlOp(op)
-	if err != nil {
-		return "", nil, err
+// filterValues returns the values of a q- filter parameter.
+// The values of list operators are comma separated there.
+func filterValues(op crud.Operator, val string) []string {
+	if !op.List() {
+		return []string{val}
 	}
-	return fmt.Sprintf("%s %s ?", field, textOp), val, nil
+	var vals []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			vals = append(vals, item)
+		}
+	}
+	return vals
 }
 
-// IntDbType represents an integer column
-type IntDbType struct{}
+// isNull is true for the legacy NULL literal
+func isNull(vals []string) bool {
+	return len(vals) == 1 && vals[0] == "NULL"
+}
 
-func (s IntDbType) Where(field string, op crud.Operator, val string) (string, interface{}, error) {
-	intVal, err := strconv.Atoi(val)
+// listValues converts the values of a list operator
+func listValues(op crud.Operator, vals []string, parse parseFunc) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(vals))
+	for _, item := range vals {
+		v, err := parse(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	switch {
+	case len(values) == 0:
+		return nil, fmt.Errorf("operator %s needs at least one value", op)
+	case len(values) > maxListValues:
+		return nil, fmt.Errorf("operator %s supports up to %d values", op, maxListValues)
+	case op == crud.OP_BETWEEN && len(values) != 2:
+		return nil, fmt.Errorf("operator %s needs exactly two values", op)
+	}
+	return values, nil
+}
+
+// whereOp builds the SQL condition for the operators common to all types
+func whereOp(field string, op crud.Operator, vals []string, parse parseFunc) (string, []interface{}, error) {
+	switch op {
+	case crud.OP_ISNULL:
+		return field + " IS NULL", nil, nil
+	case crud.OP_NOTNULL:
+		return field + " IS NOT NULL", nil, nil
+	case crud.OP_IN, crud.OP_NIN, crud.OP_BETWEEN:
+		values, err := listValues(op, vals, parse)
+		if err != nil {
+			return "", nil, err
+		}
+		if op == crud.OP_BETWEEN {
+			return fmt.Sprintf("%s BETWEEN ? AND ?", field), values, nil
+		}
+		textOp := "IN"
+		if op == crud.OP_NIN {
+			textOp = "NOT IN"
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		return fmt.Sprintf("%s %s (%s)", field, textOp, marks), values, nil
+	}
+	textOp, err := sqlOp(op)
 	if err != nil {
 		return "", nil, err
 	}
-	textOp, err := sqlOp(op)
+	v, err := parse(vals[0])
 	if err != nil {
 		return "", nil, err
 	}
-	return fmt.Sprintf("%s %s ?", field, textOp), intVal, nil
+	return fmt.Sprintf("%s %s ?", field, textOp), []interface{}{v}, nil
 }
 
-// TimeDbType represents a time.Time column
-type TimeDbType struct{}
-
-func (s TimeDbType) Where(field string, op crud.Operator, val string) (string, interface{}, error) {
-	timeVal, err := time.Parse(time.RFC3339, val)
-	if err != nil {
-		return "", nil, err
+// matchOp evaluates the operators common to all types
+func matchOp(column driver.Value, op crud.Operator, vals []string, parse parseFunc) (bool, error) {
+	switch op {
+	case crud.OP_ISNULL:
+		return column == nil, nil
+	case crud.OP_NOTNULL:
+		return column != nil, nil
+	case crud.OP_IN, crud.OP_NIN, crud.OP_BETWEEN:
+		values, err := listValues(op, vals, parse)
+		if err != nil {
+			return false, err
+		}
+		if column == nil {
+			return false, nil
+		}
+		if op == crud.OP_BETWEEN {
+			return compareValues(column, values[0]) >= 0 && compareValues(column, values[1]) <= 0, nil
+		}
+		found := false
+		for _, v := range values {
+			if compareValues(column, v) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (op == crud.OP_IN), nil
 	}
-	textOp, err := sqlOp(op)
+	v, err := parse(vals[0])
 	if err != nil {
-		return "", nil, err
+		return false, err
+	}
+	if column == nil {
+		return false, nil
+	}
+	if op == crud.OP_LIKE {
+		return likeMatch(valueString(column), vals[0]), nil
+	}
+	return compareOp(compareValues(column, v), op)
+}
+
+// StringDbType represents a string column
+type StringDbType struct{}
+
+func parseString(val string) (driver.Value, error) {
+	return val, nil
+}
+
+func (s StringDbType) Where(dialect Dialect, field string, op crud.Operator, vals []string) (string, []interface{}, error) {
+	switch op {
+	case crud.OP_ILIKE:
+		// ILIKE is not supported by oracle
+		return fmt.Sprintf("LOWER(%s) like LOWER(?)", field), []interface{}{vals[0]}, nil
+	case crud.OP_STARTSWITH:
+		if vals[0] == "" {
+			// oracle takes the empty string as NULL
+			return field + " IS NOT NULL", nil, nil
+		}
+		// LIKE is case insensitive in sqlite
+		return fmt.Sprintf("substr(%s, 1, ?) = ?", field), []interface{}{utf8.RuneCountInString(vals[0]), vals[0]}, nil
+	case crud.OP_LIKE:
+		cond, param := dialect.Like(field, vals[0])
+		return cond, []interface{}{param}, nil
 	}
-	return fmt.Sprintf("%s %s ?", field, textOp), timeVal, nil
+	return whereOp(field, op, vals, parseString)
+}
+
+func (s StringDbType) Match(column driver.Value, op crud.Operator, vals []string) (bool, error) {
+	switch op {
+	case crud.OP_ILIKE:
+		if column == nil {
+			return false, nil
+		}
+		return likeMatch(strings.ToLower(valueString(column)), strings.ToLower(vals[0])), nil
+	case crud.OP_STARTSWITH:
+		if column == nil {
+			return false, nil
+		}
+		return strings.HasPrefix(valueString(column), vals[0]), nil
+	}
+	return matchOp(column, op, vals, parseString)
+}
+
+// IntDbType represents an integer column
+type IntDbType struct{}
+
+func parseInt(val string) (driver.Value, error) {
+	return strconv.ParseInt(val, 10, 64)
+}
+
+func (s IntDbType) Where(dialect Dialect, field string, op crud.Operator, vals []string) (string, []interface{}, error) {
+	return whereOp(field, op, vals, parseInt)
+}
+
+func (s IntDbType) Match(column driver.Value, op crud.Operator, vals []string) (bool, error) {
+	return matchOp(column, op, vals, parseInt)
 }
 
-// JsonDbType represents a string column with json format
+// FloatDbType represents a floating point column
+type FloatDbType struct{}
+
+func parseFloat(val string) (driver.Value, error) {
+	return strconv.ParseFloat(val, 64)
+}
+
+func (s FloatDbType) Where(dialect Dialect, field string, op crud.Operator, vals []string) (string, []interface{}, error) {
+	return whereOp(field, op, vals, parseFloat)
+}
+
+func (s FloatDbType) Match(column driver.Value, op crud.Operator, vals []string) (bool, error) {
+	return matchOp(column, op, vals, parseFloat)
+}
+
+// TimeDbType represents a time.Time column
+type TimeDbType struct{}
+
+func parseTime(val string) (driver.Value, error) {
+	return time.Parse(time.RFC3339, val)
+}
+
+func (s TimeDbType) Where(dialect Dialect, field string, op crud.Operator, vals []string) (string, []interface{}, error) {
+	return whereOp(field, op, vals, parseTime)
+}
+
+func (s TimeDbType) Match(column driver.Value, op crud.Operator, vals []string) (bool, error) {
+	return matchOp(column, op, vals, parseTime)
+}
+
+// JsonDbType represents a string column with a json array of strings.
+// eq, ne, in, nin and all compare whole elements, like and ilike
+// match the json text.
 type JsonDbType struct{}
 
-func (s JsonDbType) Where(field string, op crud.Operator, val string) (string, interface{}, error) {
+func (s JsonDbType) Where(dialect Dialect, field string, op crud.Operator, vals []string) (string, []interface{}, error) {
 	switch op {
-	case crud.OP_EQ:
-		fallthrough
 	case crud.OP_LIKE:
-		return fmt.Sprintf("%s like ?", field), fmt.Sprintf("%%%s%%", val), nil
+		cond, param := dialect.Like(field, fmt.Sprintf("%%%s%%", vals[0]))
+		return cond, []interface{}{param}, nil
+	case crud.OP_ILIKE:
+		return fmt.Sprintf("LOWER(%s) like LOWER(?)", field), []interface{}{fmt.Sprintf("%%%s%%", vals[0])}, nil
+	case crud.OP_EQ, crud.OP_NE:
+		cond, param := dialect.JsonContains(field, vals[0])
+		return jsonNull(field, op, cond), []interface{}{param}, nil
+	case crud.OP_IN, crud.OP_NIN, crud.OP_ALL:
+		// Contains any (in), none (nin) or all (all) of the values
+		values, err := listValues(op, vals, parseString)
+		if err != nil {
+			return "", nil, err
+		}
+		conds := make([]string, 0, len(values))
+		for idx, v := range values {
+			var cond string
+			cond, values[idx] = dialect.JsonContains(field, v.(string))
+			conds = append(conds, cond)
+		}
+		sep := " OR "
+		if op == crud.OP_ALL {
+			sep = " AND "
+		}
+		return jsonNull(field, op, "("+strings.Join(conds, sep)+")"), values, nil
+	case crud.OP_ISNULL, crud.OP_NOTNULL:
+		return whereOp(field, op, vals, parseString)
 	default:
 		return "", nil, fmt.Errorf("unsupported operator %s", op)
 	}
 }
+
+func (s JsonDbType) Match(column driver.Value, op crud.Operator, vals []string) (bool, error) {
+	switch op {
+	case crud.OP_LIKE:
+		if column == nil {
+			return false, nil
+		}
+		return likeMatch(valueString(column), fmt.Sprintf("%%%s%%", vals[0])), nil
+	case crud.OP_ILIKE:
+		if column == nil {
+			return false, nil
+		}
+		return likeMatch(strings.ToLower(valueString(column)), strings.ToLower(fmt.Sprintf("%%%s%%", vals[0]))), nil
+	case crud.OP_EQ, crud.OP_NE:
+		elements, err := jsonElements(column)
+		if err != nil {
+			return false, err
+		}
+		_, found := elements[vals[0]]
+		return found == (op == crud.OP_EQ), nil
+	case crud.OP_IN, crud.OP_NIN, crud.OP_ALL:
+		values, err := listValues(op, vals, parseString)
+		if err != nil {
+			return false, err
+		}
+		elements, err := jsonElements(column)
+		if err != nil {
+			return false, err
+		}
+		found := 0
+		for _, v := range values {
+			if _, ok := elements[v.(string)]; ok {
+				found++
+			}
+		}
+		switch op {
+		case crud.OP_IN:
+			return found > 0, nil
+		case crud.OP_NIN:
+			return found == 0, nil
+		}
+		return column != nil && found == len(values), nil
+	case crud.OP_ISNULL, crud.OP_NOTNULL:
+		return matchOp(column, op, vals, parseString)
+	default:
+		return false, fmt.Errorf("unsupported operator %s", op)
+	}
+}
+
+// jsonNull makes NULL behave as an empty list, so that the condition
+// is never NULL. Some dialects return NULL for json functions on NULL
+// values, and some others FALSE.
+func jsonNull(field string, op crud.Operator, cond string) string {
+	if op == crud.OP_NE || op == crud.OP_NIN {
+		return fmt.Sprintf("(%s IS NULL OR NOT %s)", field, cond)
+	}
+	return fmt.Sprintf("(%s IS NOT NULL AND %s)", field, cond)
+}
+
+// knownOnNull is true if the condition is not NULL for a NULL column
+func knownOnNull(dbtype DbType, op crud.Operator) bool {
+	if op.Unary() {
+		return true
+	}
+	if _, ok := dbtype.(JsonDbType); ok {
+		return op != crud.OP_LIKE && op != crud.OP_ILIKE
+	}
+	return false
+}
+
+// jsonElements returns the set of strings in a json array column
+func jsonElements(column driver.Value) (map[string]struct{}, error) {
+	list, err := jsonList(column)
+	if err != nil {
+		return nil, err
+	}
+	elements := make(map[string]struct{}, len(list))
+	for _, item := range list {
+		elements[item] = struct{}{}
+	}
+	return elements, nil
+}
+
+// jsonList returns the strings in a json array column
+func jsonList(column driver.Value) ([]string, error) {
+	if column == nil {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(valueString(column)), &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -1,34 +1,39 @@
+import "strings"
+
 #crud: {
 
 	User: {
 		path:      "user"
 		mediaType: ""
+		groupBy:   []
+		geo:       false
+		trash:     false
 		properties: {
 			id: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			created_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			modified_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			name: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			role: {
 				type:     "string"
@@ -49,44 +54,55 @@
 	Camera: {
 		path:      "camera"
 		mediaType: ""
+		groupBy:   []
+		geo:       true
+		trash:     true
+		history:   true
 		properties: {
 			id: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			created_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			modified_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
+			}
+			deleted_at: {
+				type:     "string"
+				format:   "date-time"
+				required: false
+				readOnly: true
+				filter: []
 			}
 			name: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			latitude: {
 				type:     "number"
 				required: true
 				readOnly: false
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			longitude: {
 				type:     "number"
 				required: true
 				readOnly: false
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			local_path: {
 				type:     "string"
@@ -94,58 +110,100 @@
 				readOnly: false
 				filter: []
 			}
+			// Distance to the near point, only in geo queries
+			distance: {
+				type:     "number"
+				required: false
+				readOnly: true
+				filter: []
+			}
 		}
 	}
 
 	Video: {
 		path:      "video"
-		mediaType: "video/4gpp, video/3gpp2, video/3gp2, video/mpeg, video/mp4, video/ogg, video/quicktime, video/webm"
+		mediaType: "video/4gpp, video/3gpp, video/3gpp2, video/3gp2, video/mpeg, video/mp4, video/ogg, video/quicktime, video/webm"
+		groupBy:   ["camera", "tag"]
+		geo:       false
+		trash:     true
 		properties: {
 			id: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			created_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			modified_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
+			}
+			deleted_at: {
+				type:     "string"
+				format:   "date-time"
+				required: false
+				readOnly: true
+				filter: []
 			}
 			timestamp: {
 				type:     "string"
 				format:   "date-time"
 				required: true
 				readOnly: false
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			camera: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			tags: {
 				type:     "array"
 				required: false
 				readOnly: false
-				filter: ["eq", "ne"]
+				filter: ["eq", "ne", "in", "nin", "all"]
 				repeatable: true
 			}
 			media_url: {
 				type:     "string"
 				required: false
 				readOnly: true
-				filter: ["eq", "ne"]
+				filter: ["eq", "ne", "isnull", "notnull"]
+			}
+			transcode_status: {
+				type:     "string"
+				required: false
+				readOnly: true
+				enum: ["pending", "running", "done", "failed"]
+				filter: ["eq", "ne", "isnull", "notnull"]
+			}
+			transcode_progress: {
+				type:     "integer"
+				required: false
+				readOnly: true
+				filter: []
+			}
+			thumbnail_url: {
+				type:     "string"
+				required: false
+				readOnly: true
+				filter: ["isnull", "notnull"]
+			}
+			preview_url: {
+				type:     "string"
+				required: false
+				readOnly: true
+				filter: ["isnull", "notnull"]
 			}
 		}
 	}
@@ -153,52 +211,68 @@
 	Picture: {
 		path:      "picture"
 		mediaType: "image/jpeg, image/png"
+		groupBy:   ["camera", "tag"]
+		geo:       false
+		trash:     true
 		properties: {
 			id: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			created_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			modified_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
+			}
+			deleted_at: {
+				type:     "string"
+				format:   "date-time"
+				required: false
+				readOnly: true
+				filter: []
 			}
 			timestamp: {
 				type:     "string"
 				format:   "date-time"
 				required: true
 				readOnly: false
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			camera: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			tags: {
 				type:     "array"
 				required: false
 				readOnly: false
-				filter: ["eq", "ne"]
+				filter: ["eq", "ne", "in", "nin", "all"]
 				repeatable: true
 			}
 			media_url: {
 				type:     "string"
 				required: false
 				readOnly: true
-				filter: ["eq", "ne"]
+				filter: ["eq", "ne", "isnull", "notnull"]
+			}
+			thumbnail_url: {
+				type:     "string"
+				required: false
+				readOnly: true
+				filter: ["isnull", "notnull"]
 			}
 		}
 	}
@@ -206,77 +280,161 @@
 	Alert: {
 		path:      "alert"
 		mediaType: ""
+		groupBy:   ["camera", "severity"]
+		geo:       false
+		trash:     false
+		history:   true
 		properties: {
 			id: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			created_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			modified_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: true
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			name: {
 				type:     "string"
 				required: false
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			timestamp: {
 				type:     "string"
 				format:   "date-time"
 				required: true
 				readOnly: false
-				filter: ["lt", "le", "gt", "ge"]
+				filter: ["lt", "le", "gt", "ge", "between"]
 			}
 			camera: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			severity: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			message: {
 				type:     "string"
 				required: true
 				readOnly: false
-				filter: ["eq", "ne", "like"]
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
 			}
 			acknowledged_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: false
-				filter: ["lt", "le", "gt", "ge", "eq", "ne"]
+				filter: ["lt", "le", "gt", "ge", "between", "eq", "ne", "isnull", "notnull"]
 			}
 			resolved_at: {
 				type:     "string"
 				format:   "date-time"
 				required: false
 				readOnly: false
-				filter: ["lt", "le", "gt", "ge", "eq", "ne"]
+				filter: ["lt", "le", "gt", "ge", "between", "eq", "ne", "isnull", "notnull"]
+			}
+		}
+	}
+
+	Audit: {
+		path:      "audit"
+		mediaType: ""
+		groupBy:   []
+		geo:       false
+		trash:     false
+		readOnly:  true
+		properties: {
+			id: {
+				type:     "string"
+				required: true
+				readOnly: true
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
+			}
+			created_at: {
+				type:     "string"
+				format:   "date-time"
+				required: false
+				readOnly: true
+				filter: ["lt", "le", "gt", "ge", "between"]
+			}
+			modified_at: {
+				type:     "string"
+				format:   "date-time"
+				required: false
+				readOnly: true
+				filter: ["lt", "le", "gt", "ge", "between"]
+			}
+			actor: {
+				type:     "string"
+				required: false
+				readOnly: true
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
+			}
+			role: {
+				type:     "string"
+				required: false
+				readOnly: true
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
+			}
+			action: {
+				type:     "string"
+				required: true
+				readOnly: true
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
+				enum: ["create", "update", "patch", "delete", "restore", "purge"]
+			}
+			resource_type: {
+				type:     "string"
+				required: true
+				readOnly: true
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
+			}
+			resource_id: {
+				type:     "string"
+				required: true
+				readOnly: true
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
+			}
+			request_id: {
+				type:     "string"
+				required: false
+				readOnly: true
+				filter: ["eq", "ne", "like", "ilike", "startswith", "in", "nin"]
+			}
+			changes: {
+				type:     "object"
+				required: false
+				readOnly: true
+				filter: []
 			}
 		}
 	}
 }
 #crud: [string]: properties: [string]: repeatable: bool | *false
 
+// Read only resources only support queries
+#crud: [string]: readOnly: bool | *false
+
+// Resources that keep the previous versions of every item
+#crud: [string]: history: bool | *false
+
 openapi: "3.0.0"
 info: {
 	title:       "VideoAPI"
@@ -300,17 +458,254 @@ components: schemas: ResourceId: {
 	properties: id: type: "string"
 }
 
+components: schemas: BulkOperation: {
+	type: "object"
+	properties: {
+		op: {
+			type: "string"
+			enum: ["create", "update", "patch", "delete"]
+		}
+		id: {
+			type:        "string"
+			description: "Resource id, mandatory except for create"
+		}
+		data: {
+			type:        "object"
+			description: "Resource for create and update, merge patch for patch"
+		}
+		if_match: {
+			type:        "string"
+			description: "Only apply if the resource ETag matches"
+		}
+	}
+	required: ["op"]
+}
+
+components: schemas: TagCounts: {
+	type: "object"
+	properties: data: {
+		type: "array"
+		items: {
+			type: "object"
+			properties: {
+				camera: type: "string"
+				tag: type: "string"
+				count: type: "integer"
+			}
+		}
+	}
+}
+
+components: schemas: FeatureCollection: {
+	type:        "object"
+	description: "GeoJSON FeatureCollection, with the attributes of the resources as properties"
+	properties: {
+		type: {
+			type: "string"
+			enum: ["FeatureCollection"]
+		}
+		features: {
+			type: "array"
+			items: {
+				type: "object"
+				properties: {
+					type: {
+						type: "string"
+						enum: ["Feature"]
+					}
+					id: type: "string"
+					geometry: {
+						type: "object"
+						properties: {
+							type: {
+								type: "string"
+								enum: ["Point"]
+							}
+							coordinates: {
+								type:        "array"
+								description: "Longitude and latitude"
+								items: type: "number"
+							}
+						}
+					}
+					properties: type: "object"
+				}
+			}
+		}
+		next: type: "string"
+		prev: type: "string"
+	}
+}
+
+components: schemas: StatCounts: {
+	type: "object"
+	properties: data: {
+		type: "array"
+		items: {
+			type:        "object"
+			description: "Only the attributes in group_by, and bucket if requested, are returned"
+			properties: {
+				camera: type:   "string"
+				severity: type: "string"
+				tag: type:      "string"
+				bucket: {
+					type:        "string"
+					format:      "date-time"
+					description: "Start of the time bucket, in UTC"
+				}
+				count: type: "integer"
+			}
+		}
+	}
+}
+
+components: schemas: BulkResponse: {
+	type: "object"
+	properties: {
+		committed: {
+			type:        "boolean"
+			description: "False if all the operations were rolled back"
+		}
+		results: {
+			type: "array"
+			items: {
+				type: "object"
+				properties: {
+					op: type: "string"
+					id: type: "string"
+					status: {
+						type:        "integer"
+						description: "HTTP status code of the operation"
+					}
+					error: type: "string"
+				}
+			}
+		}
+	}
+}
+
+components: schemas: UploadRequest: {
+	type: "object"
+	properties: {
+		size: {
+			type:        "integer"
+			description: "Size of the file in bytes"
+		}
+		content_type: {
+			type:        "string"
+			description: "Media type of the file"
+		}
+		params: {
+			type:        "object"
+			description: "Saved in the meta file, like the fields of a multipart upload"
+			additionalProperties: type: "string"
+		}
+	}
+	required: ["size", "content_type"]
+}
+
+components: schemas: UploadStatus: {
+	type: "object"
+	properties: {
+		id: type:   "string"
+		size: type: "integer"
+		offset: {
+			type:        "integer"
+			description: "Bytes received so far"
+		}
+		content_type: type: "string"
+		created_at: {
+			type:   "string"
+			format: "date-time"
+		}
+	}
+}
+
+components: schemas: ImportResponse: {
+	type: "object"
+	properties: {
+		dry_run: type: "boolean"
+		committed: {
+			type:        "boolean"
+			description: "False if no row was written, because of errors or the dry run"
+		}
+		created: type: "integer"
+		updated: type: "integer"
+		failed: type:  "integer"
+		results: {
+			type: "array"
+			items: {
+				type: "object"
+				properties: {
+					line: {
+						type:        "integer"
+						description: "Line of the csv file, or position of the json item"
+					}
+					id: type: "string"
+					op: {
+						type: "string"
+						enum: ["create", "update"]
+					}
+					status: {
+						type:        "integer"
+						description: "HTTP status code of the row"
+					}
+					error: type: "string"
+				}
+			}
+		}
+	}
+}
+
+components: schemas: {for resource, data in #crud if data.history {
+	"HistoryOf\(resource)": {
+		type: "object"
+		properties: data: {
+			type: "array"
+			items: {
+				type: "object"
+				properties: {
+					resource_id: type: "string"
+					version: {
+						type:        "integer"
+						description: "Versions are numbered from 1 for each \(resource)"
+					}
+					replaced_at: {
+						type:        "string"
+						format:      "date-time"
+						description: "When this version was replaced"
+					}
+					actor: {
+						type:        "string"
+						nullable:    true
+						description: "Who replaced this version, null for changes not made by an user"
+					}
+					role: {
+						type:     "string"
+						nullable: true
+					}
+					action: {
+						type: "string"
+						enum: ["update", "patch", "delete", "restore", "revert"]
+					}
+					data: "$ref": "#/components/schemas/\(resource)"
+				}
+			}
+		}
+	}
+}}
+
 components: schemas: {for resource, data in #crud {
 	"ListOf\(resource)": {
 		type: "object"
 		properties: {
 			next: {
 				type:    "string"
-				example: "sort=asc&offset=10&limit=10"
+				example: "cursor=eyJrIjpbeyJ0IjoicyIsInYiOiJjMTAifV19&limit=10"
 			}
 			prev: {
 				type:    "string"
-				example: "sort=asc&offset=0&limit=10"
+				example: "cursor=eyJrIjpbeyJ0IjoicyIsInYiOiJjMSJ9XSwiYiI6dHJ1ZX0&limit=10"
 			}
 			data: {
 				type: "array"
@@ -342,26 +737,28 @@ components: schemas: {for resource, data in #crud {
 		required: [ for propname, propdata in data.properties
 			if propdata.required {propname}]
 	}
-	"put_\(resource)": {
-		type: "object"
-		properties: {for propname, propdata in data.properties if propname != "id" && !propdata.readOnly {
-			(propname): {
-				type: propdata.type
-				if (type == "array") {
-					items: type: "string"
-				}
-				if propdata.enum != _|_ {
-					enum: propdata.enum
-				}
-				if propdata.format != _|_ {
-					format: propdata.format
-				}
-				if propdata.readOnly != _|_ {
-					readOnly: propdata.readOnly
+	if !data.readOnly {
+		"put_\(resource)": {
+			type: "object"
+			properties: {for propname, propdata in data.properties if propname != "id" && !propdata.readOnly {
+				(propname): {
+					type: propdata.type
+					if (type == "array") {
+						items: type: "string"
+					}
+					if propdata.enum != _|_ {
+						enum: propdata.enum
+					}
+					if propdata.format != _|_ {
+						format: propdata.format
+					}
+					if propdata.readOnly != _|_ {
+						readOnly: propdata.readOnly
+					}
 				}
-			}
-		}}
-		required: false
+			}}
+			required: false
+		}
 	}
 }}
 
@@ -590,9 +987,17 @@ paths: {for resource, data in #crud {
 				- `gt`: greater than
 				- `ge`: greater or equal
 				- `like`: SQL like
+				- `ilike`: SQL like, ignoring case
+				- `startswith`: starts with the value
+				- `in`: equals any of the comma separated values
+				- `nin`: equals none of the comma separated values
+				- `between`: between two comma separated values, inclusive
+				- `all`: for lists, contains all the comma separated values
+				- `isnull`: is null, the value is ignored
+				- `notnull`: is not null, the value is ignored
 
-				Operators `eq` and `ne` support the special value `NULL` to match
-				non-null values in the DB.
+				Operators `eq` and `ne` also support the special value `NULL` to match
+				null values in the DB.
 				"""
 			#secured
 			#parameters: {for propname, propdata in data.properties if propdata.filter != _|_ {
@@ -635,7 +1040,51 @@ paths: {for resource, data in #crud {
 							description: "Find items where field `\(propname)` is `like` to this value"
 							_repeatable: propdata.repeatable
 						}
+						if op == "ilike" {
+							description: "Find items where field `\(propname)` is `like` to this value, ignoring case"
+						}
+						if op == "startswith" {
+							description: "Find items where field `\(propname)` `starts with` this value"
+						}
+						_plain: bool | *false
+						if op == "in" {
+							if !propdata.repeatable {
+								description: "Find items where field `\(propname)` is `one of` these comma separated values"
+							}
+							if propdata.repeatable {
+								description: "Find items where field `\(propname)` contains `any` of these comma separated values"
+							}
+							_plain: true
+						}
+						if op == "nin" {
+							if !propdata.repeatable {
+								description: "Find items where field `\(propname)` is `none of` these comma separated values"
+							}
+							if propdata.repeatable {
+								description: "Find items where field `\(propname)` contains `none` of these comma separated values"
+							}
+							_plain: true
+						}
+						if op == "all" {
+							description: "Find items where field `\(propname)` contains `all` of these comma separated values"
+							_plain:      true
+						}
+						if op == "between" {
+							description: "Find items where field `\(propname)` is `between` these two comma separated values, inclusive"
+							_plain:      true
+						}
+						if op == "isnull" {
+							description: "Find items where field `\(propname)` `is null`. The value is ignored"
+							_plain:      true
+						}
+						if op == "notnull" {
+							description: "Find items where field `\(propname)` `is not null`. The value is ignored"
+							_plain:      true
+						}
 						schema: {
+							if _plain {
+								type: "string"
+							}
 							if _repeatable {
 								type: "array"
 								items: {
@@ -650,7 +1099,7 @@ paths: {for resource, data in #crud {
 									}
 								}
 							}
-							if !_repeatable {
+							if !_repeatable && !_plain {
 								if propdata.format != _|_ {
 									format: propdata.format
 								}
@@ -688,7 +1137,24 @@ paths: {for resource, data in #crud {
 				required:    false
 				description: "Offset for pagination"
 				schema: {
-					type: "integer"
+					type:    "integer"
+					minimum: 0
+				}
+			}
+			#parameters: cursor: {
+				"in":        "query"
+				required:    false
+				description: "Opaque pagination cursor, as returned in next / prev. Overrides offset"
+				schema: {
+					type: "string"
+				}
+			}
+			#parameters: fields: {
+				"in":        "query"
+				required:    false
+				description: "Comma separated list of attributes to return, all of them by default"
+				schema: {
+					type: "string"
 				}
 			}
 			#parameters: limit: {
@@ -699,6 +1165,57 @@ paths: {for resource, data in #crud {
 					type: "integer"
 				}
 			}
+			#parameters: filter: {
+				"in":        "query"
+				required:    false
+				description: "Boolean expression of conditions, e.g. `(camera eq 'A' and tags eq x) or camera in (B, C)`. Combined with the q- parameters using AND"
+				schema: {
+					type: "string"
+				}
+			}
+			if data.geo {
+				#parameters: near: {
+					"in":        "query"
+					required:    false
+					description: "Point to compute the distance from, as `lat,lon`. Allows sorting by distance"
+					schema: type: "string"
+				}
+				#parameters: radius: {
+					"in":        "query"
+					required:    false
+					description: "Maximum distance to near, in meters. Supports `m` and `km` suffixes, e.g. `500m`"
+					schema: type: "string"
+				}
+				#parameters: bbox: {
+					"in":        "query"
+					required:    false
+					description: "Bounding box as `minLon,minLat,maxLon,maxLat`, same order as GeoJSON"
+					schema: type: "string"
+				}
+			}
+			if data.trash {
+				#parameters: include_deleted: {
+					"in":        "query"
+					required:    false
+					description: "If true, include the \(resource) in the trash. Only for admins"
+					schema: type: "boolean"
+				}
+			}
+			#parameters: format: {
+				"in":     "query"
+				required: false
+				if data.geo {
+					description: "Format of the reply, geojson returns a FeatureCollection. csv and ndjson stream all the matching items, without pagination"
+				}
+				if !data.geo {
+					description: "Format of the reply. csv and ndjson stream all the matching items, without pagination"
+				}
+				schema: {
+					type: "string"
+					enum: ["json", if data.geo {"geojson"}, "csv", "ndjson"]
+					default: "json"
+				}
+			}
 			#parameters: "outer-op": {
 				"in":        "query"
 				required:    false
@@ -742,31 +1259,45 @@ paths: {for resource, data in #crud {
 							schema:
 								"$ref": "#/components/schemas/ListOf\(resource)"
 						}
+						if data.geo {
+							"application/geo+json": {
+								schema:
+									"$ref": "#/components/schemas/FeatureCollection"
+							}
+						}
+						"text/csv": {
+							schema: type: "string"
+						}
+						"application/x-ndjson": {
+							schema: type: "string"
+						}
 					}
 				}
 			}
 		}
-		post: {
-			summary: "Creates a new \(resource)"
-			tags: [resource]
-			#secured
-			requestBody: {
-				description: "Information of the \(resource)"
-				required:    true
-				content: {
-					"application/json": {
-						schema: "$ref": "#/components/schemas/\(resource)"
-					}
-				}
-			}
-			responses: #standardResponses
-			responses: {
-				"200": {
-					description: "New resource created"
+		if !data.readOnly {
+			post: {
+				summary: "Creates a new \(resource)"
+				tags: [resource]
+				#secured
+				requestBody: {
+					description: "Information of the \(resource)"
+					required:    true
 					content: {
 						"application/json": {
-							schema:
-								"$ref": "#/components/schemas/ResourceId"
+							schema: "$ref": "#/components/schemas/\(resource)"
+						}
+					}
+				}
+				responses: #standardResponses
+				responses: {
+					"200": {
+						description: "New resource created"
+						content: {
+							"application/json": {
+								schema:
+									"$ref": "#/components/schemas/ResourceId"
+							}
 						}
 					}
 				}
@@ -780,21 +1311,65 @@ paths: {for resource, data in #crud {
 			required: true
 			schema: type: "string"
 		}]
+		#if_match: {
+			name:        "If-Match"
+			"in":        "header"
+			required:    false
+			description: "Only apply if the resource ETag matches one of these"
+			schema: type: "string"
+		}
+		#param_id_if_match: [{
+			name:     "id"
+			"in":     "path"
+			required: true
+			schema: type: "string"
+		}, #if_match]
 		#empty_response: {
 			"204": {
 				description: "no content returned if success"
 			}
 			#standardResponses
 		}
+		#conditional_response: {
+			#empty_response
+			"412": {
+				description: "Precondition failed, the resource has been modified"
+				content:     #queryErrorReference
+			}
+		}
 		get: {
 			summary: "Queries a \(resource) by id"
 			tags: [resource]
 			#secured
-			parameters: #param_id
-			responses:  #standardResponses
+			parameters: [{
+				name:     "id"
+				"in":     "path"
+				required: true
+				schema: type: "string"
+			}, {
+				name:        "If-None-Match"
+				"in":        "header"
+				required:    false
+				description: "Do not return the resource if its ETag matches one of these"
+				schema: type: "string"
+			}, {
+				name:        "fields"
+				"in":        "query"
+				required:    false
+				description: "Comma separated list of attributes to return, all of them by default"
+				schema: type: "string"
+			}]
+			responses: #standardResponses
 			responses: {
+				"304": {
+					description: "Not modified, the resource ETag matches If-None-Match"
+				}
 				"200": {
 					description: "resource content"
+					headers: ETag: {
+						description: "Version of the resource, for If-Match and If-None-Match"
+						schema: type: "string"
+					}
 					content: {
 						"application/json": {
 							schema:
@@ -843,8 +1418,10 @@ paths: {for resource, data in #crud {
 						description: "Media URL for the file uploaded"
 						content: "application/json": schema: {
 							type: "object"
-							properties: id: type:        "string"
-							properties: media_url: type: "string"
+							properties: id: type:            "string"
+							properties: media_url: type:     "string"
+							properties: thumbnail_url: type: "string"
+							properties: preview_url: type:   "string"
 						}
 					}
 					"301": {
@@ -857,44 +1434,364 @@ paths: {for resource, data in #crud {
 				}
 			}
 		}
-		put: {
-			summary: "Updates a \(resource) by id"
+		if !data.readOnly {
+			put: {
+				summary: "Updates a \(resource) by id"
+				tags: [resource]
+				#secured
+				parameters: #param_id_if_match
+				requestBody: {
+					description: "Information of the \(resource)"
+					required:    true
+					content: {
+						"application/json": {
+							schema: "$ref": "#/components/schemas/put_\(resource)"
+						}
+					}
+				}
+				responses: #conditional_response
+			}
+			patch: {
+				summary:     "Partially updates a \(resource) by id"
+				description: "JSON merge patch (RFC 7396): missing attributes are not changed, null clears nullable attributes"
+				tags: [resource]
+				#secured
+				parameters: #param_id_if_match
+				requestBody: {
+					description: "Attributes of the \(resource) to change"
+					required:    true
+					content: {
+						"application/merge-patch+json": {
+							schema: "$ref": "#/components/schemas/put_\(resource)"
+						}
+					}
+				}
+				responses: #conditional_response
+			}
+			delete: {
+				summary: "Deletes a \(resource) by id"
+				tags: [resource]
+				#secured
+				if data.mediaType == "" {
+					parameters: #param_id_if_match
+				}
+				if data.mediaType != "" {
+					parameters: [{
+						name:     "id"
+						"in":     "path"
+						required: true
+						schema: type: "string"
+					}, {
+						name:     "mediaOnly"
+						"in":     "query"
+						required: false
+						schema: type: "boolean"
+						description: "If true, only the media will be deleted"
+					}, #if_match]
+				}
+				responses: #conditional_response
+			}
+		}
+	}
+	if !data.readOnly {
+		"/v1/api/\(data.path)/_bulk": post: {
+			summary: "Creates, updates or deletes several \(resource) in a single transaction"
 			tags: [resource]
 			#secured
-			parameters: #param_id
+			parameters: [{
+				name:        "atomic"
+				"in":        "query"
+				required:    false
+				description: "If true, any failed operation rolls back all of them"
+				schema: type: "boolean"
+			}]
 			requestBody: {
-				description: "Information of the \(resource)"
+				description: "Array of operations, or newline delimited json"
 				required:    true
 				content: {
-					"application/json": {
-						schema: "$ref": "#/components/schemas/put_\(resource)"
+					"application/json": schema: {
+						type: "array"
+						items: "$ref": "#/components/schemas/BulkOperation"
 					}
+					"application/x-ndjson": schema: "$ref": "#/components/schemas/BulkOperation"
 				}
 			}
-			responses: #empty_response
+			responses: #standardResponses
+			responses: "200": {
+				description: "Result of each operation"
+				content: "application/json": schema: "$ref": "#/components/schemas/BulkResponse"
+			}
+		}
+	}
+	if data.mediaType == "" && !data.readOnly {
+		"/v1/api/\(data.path)/_import": post: {
+			summary: "Creates or updates several \(resource) from a csv or json file"
+			tags: [resource]
+			description: "All the rows are validated before writing any of them, and written in a single transaction"
+			#secured
+			parameters: [{
+				name:        "dry_run"
+				"in":        "query"
+				required:    false
+				description: "If true, validate and write the rows, but roll back the transaction"
+				schema: type: "boolean"
+			}, {
+				name:        "upsert"
+				"in":        "query"
+				required:    false
+				description: "If true, update the \(resource) that already exist instead of failing"
+				schema: type: "boolean"
+			}]
+			requestBody: {
+				description: "csv file with a header line, array of objects, or newline delimited json"
+				required:    true
+				content: {
+					"text/csv": schema: type: "string"
+					"application/json": schema: {
+						type: "array"
+						items: "$ref": "#/components/schemas/\(resource)"
+					}
+					"application/x-ndjson": schema: "$ref": "#/components/schemas/\(resource)"
+				}
+			}
+			responses: #standardResponses
+			responses: "200": {
+				description: "Result of each row"
+				content: "application/json": schema: "$ref": "#/components/schemas/ImportResponse"
+			}
 		}
-		delete: {
-			summary: "Deletes a \(resource) by id"
+	}
+	if data.mediaType != "" {
+		"/v1/api/\(data.path)/_tags": get: {
+			summary: "Counts the \(resource) with each tag, per camera"
 			tags: [resource]
+			description: "Supports the same q- and filter parameters as the list of \(resource)"
 			#secured
-			if data.mediaType == "" {
-				parameters: #param_id
+			responses: #standardResponses
+			responses: "200": {
+				description: "Count of items per camera and tag"
+				content: "application/json": schema: "$ref": "#/components/schemas/TagCounts"
+			}
+		}
+		"/v1/api/\(data.path)/{id}/upload": {
+			post: {
+				summary: "Creates a resumable upload of the file for the \(resource)"
+				tags: [resource]
+				description: "If there is an upload in progress with the same size and content_type, it is returned to be resumed"
+				#secured
+				parameters: [{
+					name:     "id"
+					"in":     "path"
+					required: true
+					schema: type: "string"
+				}]
+				requestBody: {
+					required: true
+					content: "application/json": schema: "$ref": "#/components/schemas/UploadRequest"
+				}
+				responses: #standardResponses
+				responses: {
+					"200": {
+						description: "Status of the upload"
+						content: "application/json": schema: "$ref": "#/components/schemas/UploadStatus"
+					}
+					"404": description: "The \(resource) does not exist"
+				}
 			}
-			if data.mediaType != "" {
+			get: {
+				summary: "Status of the resumable upload for the \(resource)"
+				tags: [resource]
+				#secured
+				parameters: [{
+					name:     "id"
+					"in":     "path"
+					required: true
+					schema: type: "string"
+				}]
+				responses: #standardResponses
+				responses: {
+					"200": {
+						description: "Status of the upload"
+						content: "application/json": schema: "$ref": "#/components/schemas/UploadStatus"
+					}
+					"404": description: "There is no upload in progress"
+				}
+			}
+			patch: {
+				summary: "Appends a chunk to the resumable upload for the \(resource)"
+				tags: [resource]
+				#secured
 				parameters: [{
 					name:     "id"
 					"in":     "path"
 					required: true
 					schema: type: "string"
 				}, {
-					name:     "mediaOnly"
-					"in":     "query"
-					required: false
-					schema: type: "boolean"
-					description: "If true, only the media will be deleted"
+					name:        "Upload-Offset"
+					"in":        "header"
+					required:    true
+					description: "Offset of the chunk, must be the offset of the upload"
+					schema: type: "integer"
 				}]
+				requestBody: {
+					required: true
+					content: "application/offset+octet-stream": schema: {
+						type:   "string"
+						format: "binary"
+					}
+				}
+				responses: #standardResponses
+				responses: {
+					"204": description: "no content returned if success"
+					"404": description: "There is no upload in progress"
+					"409": description: "Upload-Offset does not match the offset of the upload"
+					"413": description: "The chunk exceeds the size of the upload"
+				}
+			}
+			delete: {
+				summary: "Cancels the resumable upload for the \(resource)"
+				tags: [resource]
+				#secured
+				parameters: [{
+					name:     "id"
+					"in":     "path"
+					required: true
+					schema: type: "string"
+				}]
+				responses: #standardResponses
+				responses: {
+					"204": description: "no content returned if success"
+					"404": description: "There is no upload in progress"
+				}
+			}
+		}
+		"/v1/api/\(data.path)/{id}/upload/_commit": post: {
+			summary: "Completes the resumable upload for the \(resource)"
+			tags: [resource]
+			description: "The file is processed like a multipart upload, and the upload removed"
+			#secured
+			parameters: [{
+				name:     "id"
+				"in":     "path"
+				required: true
+				schema: type: "string"
+			}]
+			responses: #standardResponses
+			responses: {
+				"200": {
+					description: "Media URL for the file uploaded"
+					content: "application/json": schema: {
+						type: "object"
+						properties: id: type:            "string"
+						properties: media_url: type:     "string"
+						properties: thumbnail_url: type: "string"
+						properties: preview_url: type:   "string"
+					}
+				}
+				"404": description: "There is no upload in progress"
+				"409": description: "The upload is not complete"
+			}
+		}
+	}
+	if len(data.groupBy) > 0 {
+		"/v1/api/\(data.path)/_stats": get: {
+			summary: "Counts the \(resource) per group and time bucket"
+			tags: [resource]
+			description: "Supports the same q- and filter parameters as the list of \(resource)"
+			#secured
+			parameters: [{
+				name:        "group_by"
+				"in":        "query"
+				required:    false
+				description: "Comma separated list of attributes to group by, among \(strings.Join(data.groupBy, ", "))"
+				schema: type: "string"
+			}, {
+				name:        "bucket"
+				"in":        "query"
+				required:    false
+				description: "Count per time interval, by timestamp"
+				schema: {
+					type: "string"
+					enum: ["hour", "day", "week"]
+				}
+			}]
+			responses: #standardResponses
+			responses: "200": {
+				description: "Count of items per group and bucket"
+				content: "application/json": schema: "$ref": "#/components/schemas/StatCounts"
+			}
+		}
+	}
+	if data.trash {
+		"/v1/api/\(data.path)/_trash": get: {
+			summary: "Lists the \(resource) in the trash"
+			tags: [resource]
+			description: "Supports the same parameters as the list of \(resource). Only for admins"
+			#secured
+			responses: #standardResponses
+			responses: "200": {
+				description: "List of items"
+				content: "application/json": schema: "$ref": "#/components/schemas/ListOf\(resource)"
+			}
+		}
+		"/v1/api/\(data.path)/{id}/_restore": post: {
+			summary: "Restores a \(resource) from the trash"
+			tags: [resource]
+			#secured
+			parameters: [{
+				name:     "id"
+				"in":     "path"
+				required: true
+				schema: type: "string"
+			}]
+			responses: #standardResponses
+			responses: {
+				"204": description: "no content returned if success"
+				"404": description: "The \(resource) is not in the trash"
+			}
+		}
+	}
+	if data.history {
+		"/v1/api/\(data.path)/{id}/_history": get: {
+			summary: "Lists the previous versions of a \(resource), newest first"
+			tags: [resource]
+			#secured
+			parameters: [{
+				name:     "id"
+				"in":     "path"
+				required: true
+				schema: type: "string"
+			}]
+			responses: #standardResponses
+			responses: {
+				"200": {
+					description: "Previous versions of the \(resource)"
+					content: "application/json": schema: "$ref": "#/components/schemas/HistoryOf\(resource)"
+				}
+				"404": description: "The \(resource) has no history"
+			}
+		}
+		"/v1/api/\(data.path)/{id}/_history/{version}/_revert": post: {
+			summary: "Reverts a \(resource) to a previous version"
+			tags: [resource]
+			description: "Only the attributes that differ from the current version are changed. Only for admins"
+			#secured
+			parameters: [{
+				name:     "id"
+				"in":     "path"
+				required: true
+				schema: type: "string"
+			}, {
+				name:     "version"
+				"in":     "path"
+				required: true
+				schema: type: "integer"
+			}]
+			responses: #standardResponses
+			responses: {
+				"204": description: "no content returned if success"
+				"404": description: "The \(resource) or version does not exist"
 			}
-			responses: #empty_response
 		}
 	}
 }}
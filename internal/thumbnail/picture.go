@@ -0,0 +1,136 @@
+// Package thumbnail makes reduced versions of the media files,
+// so that clients can show them without downloading the whole file.
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+
+	// Formats of the pictures
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Size of the longest side of thumbnails and previews, in pixels
+const Size = 320
+
+// Pictures larger than this are not decoded, to bound memory use
+const maxPixels = 100 * 1000 * 1000
+
+// Suffixes of the files made, after the path of the source
+const (
+	thumbnailSuffix = ".thumb.jpg"
+	previewSuffix   = ".preview.gif"
+)
+
+// Pictures makes the thumbnails of pictures, decoding them in Go
+type Pictures struct{}
+
+// Thumbnails implements crud.Thumbnailer. Pictures have no preview.
+func (Pictures) Thumbnails(ctx context.Context, srcPath string) (thumbnail, preview string, err error) {
+	src, err := decode(srcPath)
+	if err != nil {
+		return "", "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	thumbnail = srcPath + thumbnailSuffix
+	if err := save(thumbnail, resize(src, Size)); err != nil {
+		os.Remove(thumbnail)
+		return "", "", err
+	}
+	return thumbnail, "", nil
+}
+
+// decode reads the picture, if it is not too large
+func decode(srcPath string) (image.Image, error) {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, errors.New("picture too large for a thumbnail")
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(file)
+	return src, err
+}
+
+// save writes the image as jpeg
+func save(dstPath string, img image.Image) error {
+	file, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 85}); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// resize reduces the image to fit in a square of the given size,
+// keeping the aspect ratio. Each pixel of the result is the average
+// of the pixels of the source it covers. Transparent pixels are
+// blended over white, since jpeg has no transparency.
+func resize(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := srcWidth, srcHeight
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, srcHeight*size/srcWidth
+		} else {
+			width, height = srcWidth*size/srcHeight, size
+		}
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+	// draw has fast paths from the usual formats to RGBA
+	rgba := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Over)
+	if width == srcWidth && height == srcHeight {
+		return rgba
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, (y+1)*srcHeight/height
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, (x+1)*srcWidth/width
+			var r, g, b, a uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					a += uint64(row[i+3])
+				}
+			}
+			count := uint64((y1 - y0) * (x1 - x0))
+			offset := y*dst.Stride + x*4
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,70 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Length of the animated preview of the videos
+const previewLength = "3"
+
+// Videos makes the poster and the animated preview of videos with ffmpeg
+type Videos struct {
+	FFmpegPath string
+	// Limit for each ffmpeg run, 1 minute by default
+	Timeout time.Duration
+}
+
+// Thumbnails implements crud.Thumbnailer. Returns the files that
+// could be made, even if the other one fails.
+func (v Videos) Thumbnails(ctx context.Context, srcPath string) (thumbnail, preview string, err error) {
+	// Fit in a square of Size, but never enlarge the video
+	scale := fmt.Sprintf("scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease", Size, Size)
+	// The thumbnail filter picks a representative frame among the first ones
+	thumbnail = srcPath + thumbnailSuffix
+	posterErr := v.run(ctx, thumbnail,
+		"-hide_banner", "-nostdin", "-i", srcPath,
+		"-vf", "thumbnail,"+scale, "-frames:v", "1",
+		"-y", thumbnail)
+	if posterErr != nil {
+		thumbnail = ""
+	}
+	// A palette made from the clip itself keeps the gif colors close
+	preview = srcPath + previewSuffix
+	previewErr := v.run(ctx, preview,
+		"-hide_banner", "-nostdin", "-t", previewLength, "-i", srcPath,
+		"-an", "-vf", "fps=10,"+scale+",split[a][b];[a]palettegen[p];[b][p]paletteuse",
+		"-loop", "0", "-y", preview)
+	if previewErr != nil {
+		preview = ""
+	}
+	return thumbnail, preview, errors.Join(posterErr, previewErr)
+}
+
+// run calls ffmpeg to make the output file
+func (v Videos) run(ctx context.Context, outPath string, args ...string) error {
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, v.FFmpegPath, args...).CombinedOutput()
+	if err == nil {
+		// ffmpeg succeeds without output for videos with no frames
+		if info, statErr := os.Stat(outPath); statErr != nil || info.Size() == 0 {
+			err = errors.New("no frames")
+		}
+	}
+	if err != nil {
+		os.Remove(outPath)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg failed to make %s: %w: %s", outPath, err, lines[len(lines)-1])
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package transcode
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lines printed by ffmpeg in stderr, describing the input
+var (
+	durationPattern = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+	videoPattern    = regexp.MustCompile(`Stream #.*: Video: (\w+)`)
+	sizePattern     = regexp.MustCompile(`, (\d{2,5})x(\d{2,5})\b`)
+	audioPattern    = regexp.MustCompile(`Stream #.*: Audio: (\w+)`)
+)
+
+// mediaInfo describes the first video and audio streams of a file
+type mediaInfo struct {
+	duration      time.Duration
+	videoCodec    string
+	width, height int
+	audioCodec    string
+}
+
+// probe reads the streams of the file, from the description
+// that ffmpeg prints when called without output.
+func probe(ctx context.Context, ffmpegPath, srcPath string) (mediaInfo, error) {
+	var info mediaInfo
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-nostdin", "-i", srcPath)
+	// Fails for lack of output, the description is printed anyway
+	output, _ := cmd.CombinedOutput()
+	if err := ctx.Err(); err != nil {
+		return info, err
+	}
+	lastLine := ""
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lastLine = line
+		if match := durationPattern.FindStringSubmatch(line); match != nil && info.duration == 0 {
+			info.duration = parseDuration(match[1], match[2], match[3])
+		}
+		if match := videoPattern.FindStringSubmatch(line); match != nil && info.videoCodec == "" {
+			info.videoCodec = match[1]
+			if size := sizePattern.FindStringSubmatch(line); size != nil {
+				info.width, _ = strconv.Atoi(size[1])
+				info.height, _ = strconv.Atoi(size[2])
+			}
+		}
+		if match := audioPattern.FindStringSubmatch(line); match != nil && info.audioCodec == "" {
+			info.audioCodec = match[1]
+		}
+	}
+	if info.videoCodec == "" {
+		return info, fmt.Errorf("no video stream found: %s", lastLine)
+	}
+	return info, nil
+}
+
+// ffmpeg runs the conversion, calling report with the percentage
+// completed of the given duration. report is called from a single
+// goroutine. args must make ffmpeg write the progress to stdout.
+func ffmpeg(ctx context.Context, ffmpegPath string, args []string, duration time.Duration, report func(int64)) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// stderr has the reason of any failure
+	var (
+		lastLine string
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				lastLine = line
+			}
+		}
+	}()
+	// stdout has the progress, as key=value lines
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		// out_time_ms is also in microseconds, despite the name
+		if !ok || (key != "out_time_us" && key != "out_time_ms") || duration <= 0 {
+			continue
+		}
+		if elapsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			report(elapsed * int64(time.Microsecond) * 100 / int64(duration))
+		}
+	}
+	io.Copy(io.Discard, stdout)
+	<-done
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine)
+	}
+	return nil
+}
+
+// parseDuration builds the duration from hours, minutes and seconds
+func parseDuration(hours, minutes, seconds string) time.Duration {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.ParseFloat(seconds, 64)
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s*float64(time.Second))
+}
@@ -0,0 +1,191 @@
+package transcode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Profile describes how to convert the videos of a mime type
+type Profile struct {
+	// Mime type of the source, e.g. "video/quicktime". Matches
+	// any content type that begins with it, like upload types.
+	MimeType string `json:"mime_type"`
+	// Container of the result, also its extension, e.g. "mp4"
+	Container string `json:"container"`
+	// ffmpeg encoders, e.g. "libx264" and "aac"
+	VideoCodec string `json:"video_codec"`
+	AudioCodec string `json:"audio_codec"`
+	// Videos larger than this are downscaled, keeping the
+	// aspect ratio. 0 means no limit.
+	MaxWidth  int `json:"max_width"`
+	MaxHeight int `json:"max_height"`
+	// Video bitrate, e.g. "4M". Empty lets the encoder decide.
+	VideoBitrate string `json:"video_bitrate"`
+	// Keep the original file next to the converted one
+	KeepOriginal bool `json:"keep_original"`
+}
+
+// Codecs reported by ffmpeg for the streams made by each encoder.
+// Streams already in the codec of the profile are copied.
+var codecOf = map[string]string{
+	"libx264":    "h264",
+	"libx265":    "hevc",
+	"libvpx":     "vp8",
+	"libvpx-vp9": "vp9",
+	"libaom-av1": "av1",
+	"aac":        "aac",
+	"libopus":    "opus",
+	"libvorbis":  "vorbis",
+	"libmp3lame": "mp3",
+}
+
+// DefaultProfiles converts the formats the browsers can not play to
+// H.264 MP4, and downscales MP4 videos larger than 1080p.
+func DefaultProfiles() []Profile {
+	mp4 := func(mimeType string) Profile {
+		return Profile{
+			MimeType:   mimeType,
+			Container:  "mp4",
+			VideoCodec: "libx264",
+			AudioCodec: "aac",
+			MaxWidth:   1920,
+			MaxHeight:  1080,
+		}
+	}
+	return []Profile{
+		mp4("video/x-msvideo"),
+		mp4("video/avi"),
+		mp4("video/quicktime"),
+		mp4("video/3gpp"),
+		mp4("video/3gp2"),
+		mp4("video/4gpp"),
+		mp4("video/mpeg"),
+		mp4("video/mp4"),
+	}
+}
+
+// LoadProfiles reads the profiles from a json file, with a list of profiles
+func LoadProfiles(filePath string) ([]Profile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+	for idx, profile := range profiles {
+		if err := profile.check(); err != nil {
+			return nil, fmt.Errorf("profile %d: %w", idx, err)
+		}
+	}
+	return profiles, nil
+}
+
+// check the profile is complete
+func (p Profile) check() error {
+	if p.MimeType == "" {
+		return errors.New("missing mandatory attribute mime_type")
+	}
+	if p.Container == "" || strings.ContainsAny(p.Container, "./") {
+		return errors.New("container must be an extension without dot, e.g. mp4")
+	}
+	if p.VideoCodec == "" {
+		return errors.New("missing mandatory attribute video_codec")
+	}
+	if p.MaxWidth < 0 || p.MaxHeight < 0 {
+		return errors.New("max_width and max_height can not be negative")
+	}
+	return nil
+}
+
+// profileFor returns the profile of the content type, if any
+func profileFor(profiles []Profile, contentType string) (Profile, bool) {
+	for _, profile := range profiles {
+		if strings.HasPrefix(contentType, profile.MimeType) {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// ext is the extension of the converted files
+func (p Profile) ext() string {
+	return "." + strings.ToLower(p.Container)
+}
+
+// target returns the key of the converted file. If it would replace
+// the source, it gets a different name, so that the source is kept
+// until the conversion is complete.
+func (p Profile) target(source string) string {
+	base := strings.TrimSuffix(source, path.Ext(source))
+	if key := base + p.ext(); key != source {
+		return key
+	}
+	return base + ".transcoded" + p.ext()
+}
+
+// scale returns the size of the video, reduced to fit in the profile
+// limits, and true if it must be reduced. Sizes are rounded to even
+// numbers, as most encoders require.
+func (p Profile) scale(width, height int) (int, int, bool) {
+	if width <= 0 || height <= 0 {
+		return width, height, false
+	}
+	factor := 1.0
+	if p.MaxWidth > 0 && width > p.MaxWidth {
+		factor = float64(p.MaxWidth) / float64(width)
+	}
+	if p.MaxHeight > 0 && height > p.MaxHeight {
+		if byHeight := float64(p.MaxHeight) / float64(height); byHeight < factor {
+			factor = byHeight
+		}
+	}
+	if factor >= 1 {
+		return width, height, false
+	}
+	return int(float64(width)*factor) &^ 1, int(float64(height)*factor) &^ 1, true
+}
+
+// args builds the ffmpeg arguments to convert the probed source.
+// Returns nil if the source already matches the profile.
+func (p Profile) args(source string, info mediaInfo, srcPath, outPath string) []string {
+	width, height, downscale := p.scale(info.width, info.height)
+	copyVideo := !downscale && p.VideoBitrate == "" && info.videoCodec != "" && info.videoCodec == codecOf[p.VideoCodec]
+	copyAudio := p.AudioCodec == "" || info.audioCodec == "" || info.audioCodec == codecOf[p.AudioCodec]
+	if copyVideo && copyAudio && strings.ToLower(path.Ext(source)) == p.ext() {
+		return nil
+	}
+	// See https://superuser.com/questions/710008/how-to-get-rid-of-ffmpeg-pts-has-no-value-error
+	// for an explanation of -fflags
+	// See also https://stackoverflow.com/questions/39426006/after-video-codec-copy-to-mp4-format-with-ffmpeg-new-video-has-no-screen-and-has
+	// for an explanation of transcoding
+	args := []string{"-nostdin", "-fflags", "+genpts", "-i", srcPath}
+	if copyVideo {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args, "-c:v", p.VideoCodec, "-pix_fmt", "yuv420p")
+		if p.VideoCodec == "libx264" || p.VideoCodec == "libx265" {
+			args = append(args, "-preset", "medium")
+		}
+		if p.VideoBitrate != "" {
+			args = append(args, "-b:v", p.VideoBitrate)
+		}
+		if downscale {
+			args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", width, height))
+		}
+	}
+	if copyAudio {
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args, "-c:a", p.AudioCodec)
+	}
+	if ext := p.ext(); ext == ".mp4" || ext == ".mov" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, "-progress", "pipe:1", "-nostats", "-y", outPath)
+}
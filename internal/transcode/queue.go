@@ -0,0 +1,425 @@
+// Package transcode converts the uploaded videos in the background,
+// so that they can be played in the browser.
+package transcode
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/warpcomdev/videoapi/internal/audit"
+	"github.com/warpcomdev/videoapi/internal/crud"
+	"github.com/warpcomdev/videoapi/internal/models"
+	"github.com/warpcomdev/videoapi/internal/store"
+)
+
+// How often to look for jobs ready to run,
+// besides when they are scheduled or finished
+const pollInterval = 30 * time.Second
+
+// Delay before the first retry of a failed job, doubled for every attempt
+const retryBackoff = time.Minute
+
+// Max number of jobs read from the queue at once
+const batchSize = 100
+
+// errDiscarded is returned when the job is no longer
+// needed, e.g. the media was deleted or uploaded again
+var errDiscarded = errors.New("transcode job discarded")
+
+// Config of the Queue
+type Config struct {
+	// Jobs keeps the queue of jobs
+	Jobs store.Resource[models.TranscodeJob]
+	// Media is updated when a job changes status. Progress is updated
+	// while the job runs, it should not be audited.
+	Media    store.Resource[models.Media]
+	Progress store.Resource[models.Media]
+	Blobs    crud.BlobStore
+	// Folder for the files being transcoded
+	TmpFolder  string
+	FFmpegPath string
+	// How to convert each mime type. Other types are not converted.
+	Profiles []Profile
+	// Jobs run at once, 1 by default
+	Workers int
+	// Attempts before a job fails, 3 by default
+	Attempts int
+	// Time limit of each attempt, 1 hour by default
+	Timeout time.Duration
+}
+
+// Queue implements crud.Transcoder. Jobs are kept in the database,
+// so that they survive restarts, and run by a bounded pool of workers.
+type Queue struct {
+	config Config
+	wake   chan struct{}
+	// Running job of each media
+	mutex   sync.Mutex
+	running map[string]runningJob
+}
+
+// runningJob can be stopped when the media is uploaded again
+type runningJob struct {
+	id     string
+	cancel context.CancelFunc
+}
+
+// New creates the queue. Jobs do not run until Run is called.
+func New(config Config) *Queue {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.Attempts <= 0 {
+		config.Attempts = 3
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Hour
+	}
+	return &Queue{
+		config:  config,
+		wake:    make(chan struct{}, 1),
+		running: make(map[string]runningJob),
+	}
+}
+
+// Transcode implements crud.Transcoder
+func (q *Queue) Transcode(ctx context.Context, id, mediaURL, contentType string) error {
+	if err := q.discard(ctx, id); err != nil {
+		return err
+	}
+	if _, ok := profileFor(q.config.Profiles, contentType); !ok {
+		media, err := q.config.Media.GetById(ctx, id)
+		if err != nil {
+			return err
+		}
+		// Clear the status of any previous file
+		if !media.TranscodeStatus.Valid && !media.TranscodeProgress.Valid {
+			return nil
+		}
+		return q.setStatus(ctx, q.config.Media, id, "", -1)
+	}
+	job := models.TranscodeJob{
+		Media:  id,
+		Source: mediaURL,
+	}
+	job.ID = audit.NewID()
+	job.ContentType.String, job.ContentType.Valid = contentType, true
+	if _, err := q.config.Jobs.Post(ctx, job); err != nil {
+		return err
+	}
+	if err := q.setStatus(ctx, q.config.Media, id, models.TRANSCODE_PENDING, 0); err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+// discard removes the jobs of the media, and stops the running one
+func (q *Queue) discard(ctx context.Context, id string) error {
+	q.mutex.Lock()
+	if job, ok := q.running[id]; ok {
+		job.cancel()
+	}
+	q.mutex.Unlock()
+	return q.each(ctx, crud.Filter{Field: "media", Operator: crud.OP_EQ, Values: []string{id}}, func(job models.TranscodeJob) error {
+		return q.config.Jobs.Delete(ctx, job.ID)
+	})
+}
+
+// each calls f for the jobs that match the filter, in order of creation.
+// f must change the jobs so that they no longer match, or the call never ends.
+func (q *Queue) each(ctx context.Context, filter crud.Filter, f func(models.TranscodeJob) error) error {
+	for {
+		jobs, err := q.pending(ctx, batchSize, filter)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if err := f(job); err != nil {
+				return err
+			}
+		}
+		if len(jobs) < batchSize {
+			return nil
+		}
+	}
+}
+
+// pending returns the oldest jobs that match the filters
+func (q *Queue) pending(ctx context.Context, limit int, filters ...crud.Filter) ([]models.TranscodeJob, error) {
+	return q.config.Jobs.Get(ctx, crud.Query{
+		Filter:    filters,
+		OuterOp:   crud.OUTER_AND,
+		InnerOp:   crud.INNER_OR,
+		Sort:      []string{"created_at"},
+		Ascending: true,
+		Limit:     limit,
+	})
+}
+
+// notify wakes up the dispatcher
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches the jobs to the workers, until the context is done.
+// Jobs left running by a previous process are scheduled again.
+func (q *Queue) Run(ctx context.Context) {
+	err := q.each(ctx, crud.Filter{Field: "status", Operator: crud.OP_EQ, Values: []string{models.TRANSCODE_RUNNING}}, func(job models.TranscodeJob) error {
+		job.Status = models.TRANSCODE_PENDING
+		return q.config.Jobs.Patch(ctx, job.ID, job, []string{"STATUS"})
+	})
+	if err != nil {
+		log.Printf("failed to resume transcode jobs: %v", err)
+	}
+	slots := make(chan struct{}, q.config.Workers)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		q.dispatch(ctx, slots)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// dispatch starts as many ready jobs as free workers
+func (q *Queue) dispatch(ctx context.Context, slots chan struct{}) {
+	free := cap(slots) - len(slots)
+	if free <= 0 {
+		return
+	}
+	jobs, err := q.pending(ctx, free,
+		crud.Filter{Field: "status", Operator: crud.OP_EQ, Values: []string{models.TRANSCODE_PENDING}},
+		crud.Filter{Field: "not_before", Operator: crud.OP_LE, Values: []string{time.Now().UTC().Format(time.RFC3339Nano)}},
+	)
+	if err != nil {
+		log.Printf("failed to read transcode jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if !q.claim(ctx, &job) {
+			continue
+		}
+		slots <- struct{}{}
+		go func(job models.TranscodeJob) {
+			defer func() {
+				<-slots
+				q.notify()
+			}()
+			q.run(ctx, job)
+		}(job)
+	}
+}
+
+// claim marks the job as running. Fails if the job changed
+// since it was read, e.g. claimed by another instance.
+func (q *Queue) claim(ctx context.Context, job *models.TranscodeJob) bool {
+	matchCtx := crud.WithIfMatch(ctx, []string{crud.ETag(job.ModifiedAt)})
+	job.Status = models.TRANSCODE_RUNNING
+	job.Attempts++
+	if err := q.config.Jobs.Patch(matchCtx, job.ID, *job, []string{"STATUS", "ATTEMPTS"}); err != nil {
+		if !errors.Is(err, crud.ErrPreconditionFailed) {
+			log.Printf("failed to claim transcode job %s: %v", job.ID, err)
+		}
+		return false
+	}
+	return true
+}
+
+// run the job, and schedule a retry if it fails
+func (q *Queue) run(ctx context.Context, job models.TranscodeJob) {
+	jobCtx, cancel := context.WithTimeout(ctx, q.config.Timeout)
+	defer cancel()
+	q.mutex.Lock()
+	q.running[job.Media] = runningJob{id: job.ID, cancel: cancel}
+	q.mutex.Unlock()
+	defer func() {
+		q.mutex.Lock()
+		if q.running[job.Media].id == job.ID {
+			delete(q.running, job.Media)
+		}
+		q.mutex.Unlock()
+	}()
+	err := q.transcode(jobCtx, job)
+	if err == nil {
+		if err := q.config.Jobs.Delete(ctx, job.ID); err != nil {
+			log.Printf("failed to remove transcode job %s: %v", job.ID, err)
+		}
+		return
+	}
+	// The job is removed when the media is uploaded again
+	if _, getErr := q.config.Jobs.GetById(ctx, job.ID); getErr != nil {
+		if !errors.Is(getErr, sql.ErrNoRows) {
+			log.Printf("failed to read transcode job %s: %v", job.ID, getErr)
+		}
+		return
+	}
+	// The media was deleted, or its file replaced
+	if errors.Is(err, errDiscarded) {
+		q.config.Jobs.Delete(ctx, job.ID)
+		q.setStatus(ctx, q.config.Media, job.Media, "", -1)
+		return
+	}
+	log.Printf("failed to transcode media %s, attempt %d: %v", job.Media, job.Attempts, err)
+	job.Error.String, job.Error.Valid = truncate(err.Error(), 1024), true
+	mediaStatus, progress := models.TRANSCODE_PENDING, int64(0)
+	if job.Attempts < q.config.Attempts {
+		job.Status = models.TRANSCODE_PENDING
+		job.NotBefore = time.Now().Add(retryBackoff << (job.Attempts - 1))
+	} else {
+		job.Status = models.TRANSCODE_FAILED
+		mediaStatus, progress = models.TRANSCODE_FAILED, -1
+	}
+	if err := q.config.Jobs.Patch(ctx, job.ID, job, []string{"STATUS", "NOT_BEFORE", "ERROR"}); err != nil {
+		log.Printf("failed to update transcode job %s: %v", job.ID, err)
+	}
+	if err := q.setStatus(ctx, q.config.Media, job.Media, mediaStatus, progress); err != nil {
+		log.Printf("failed to update transcode status of media %s: %v", job.Media, err)
+	}
+}
+
+// current returns the media of the job, or errDiscarded
+// if the job or the media are gone, or the file changed.
+func (q *Queue) current(ctx context.Context, job models.TranscodeJob) (models.Media, error) {
+	if _, err := q.config.Jobs.GetById(ctx, job.ID); err != nil {
+		return models.Media{}, errDiscarded
+	}
+	media, err := q.config.Media.GetById(ctx, job.Media)
+	if err != nil || media.DeletedAt.Valid || media.MediaURL.String != job.Source {
+		return models.Media{}, errDiscarded
+	}
+	return media, nil
+}
+
+// transcode converts the file and replaces it in the media.
+// The original file is served until the conversion is complete.
+func (q *Queue) transcode(ctx context.Context, job models.TranscodeJob) error {
+	if _, err := q.current(ctx, job); err != nil {
+		return err
+	}
+	// Jobs created before content types were saved are all AVI
+	contentType := job.ContentType.String
+	if !job.ContentType.Valid {
+		contentType = "video/x-msvideo"
+	}
+	// Profiles may have changed since the job was created
+	profile, ok := profileFor(q.config.Profiles, contentType)
+	if !ok {
+		return errDiscarded
+	}
+	srcPath, cleanup, err := q.fetch(ctx, job)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	info, err := probe(ctx, q.config.FFmpegPath, srcPath)
+	if err != nil {
+		return err
+	}
+	outPath := filepath.Join(q.config.TmpFolder, job.ID+profile.ext())
+	defer os.Remove(outPath)
+	args := profile.args(job.Source, info, srcPath, outPath)
+	if args == nil {
+		// Nothing to do, the file already matches the profile
+		return q.setStatus(ctx, q.config.Media, job.Media, "", -1)
+	}
+	if err := q.setStatus(ctx, q.config.Media, job.Media, models.TRANSCODE_RUNNING, 0); err != nil {
+		return err
+	}
+	lastProgress := int64(0)
+	report := func(progress int64) {
+		if progress >= lastProgress+5 && progress < 100 {
+			lastProgress = progress
+			q.setStatus(ctx, q.config.Progress, job.Media, models.TRANSCODE_RUNNING, progress)
+		}
+	}
+	if err := ffmpeg(ctx, q.config.FFmpegPath, args, info.duration, report); err != nil {
+		return err
+	}
+	// The media may have changed while transcoding
+	media, err := q.current(ctx, job)
+	if err != nil {
+		return err
+	}
+	key := profile.target(job.Source)
+	if err := crud.PutFile(ctx, q.config.Blobs, key, outPath); err != nil {
+		return err
+	}
+	media.MediaURL.String, media.MediaURL.Valid = key, true
+	media.TranscodeStatus.String, media.TranscodeStatus.Valid = models.TRANSCODE_DONE, true
+	media.TranscodeProgress.Int64, media.TranscodeProgress.Valid = 100, true
+	matchCtx := crud.WithIfMatch(ctx, []string{crud.ETag(media.ModifiedAt)})
+	if err := q.config.Media.Patch(matchCtx, media.ID, media, []string{"MEDIA_URL", "TRANSCODE_STATUS", "TRANSCODE_PROGRESS"}); err != nil {
+		q.config.Blobs.Delete(ctx, key)
+		return err
+	}
+	log.Printf("transcoded media %s to %s", job.Media, key)
+	if !profile.KeepOriginal {
+		if err := q.config.Blobs.Delete(ctx, job.Source); err != nil {
+			log.Printf("failed to remove transcoded file %s: %v", job.Source, err)
+		}
+	}
+	return nil
+}
+
+// fetch returns the path of a local copy of the source file,
+// and a function to remove it when no longer needed.
+func (q *Queue) fetch(ctx context.Context, job models.TranscodeJob) (string, func(), error) {
+	if local, ok := q.config.Blobs.(crud.LocalBlobStore); ok {
+		if _, err := local.Stat(ctx, job.Source); err != nil {
+			return "", nil, err
+		}
+		return local.Path(job.Source), func() {}, nil
+	}
+	body, _, err := q.config.Blobs.Get(ctx, job.Source)
+	if err != nil {
+		return "", nil, err
+	}
+	defer body.Close()
+	srcPath := filepath.Join(q.config.TmpFolder, job.ID+path.Ext(job.Source))
+	file, err := os.Create(srcPath)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(srcPath)
+		return "", nil, err
+	}
+	return srcPath, func() { os.Remove(srcPath) }, nil
+}
+
+// setStatus updates the transcode attributes of the media.
+// Empty status or negative progress are saved as null.
+func (q *Queue) setStatus(ctx context.Context, media store.Resource[models.Media], id, status string, progress int64) error {
+	var patch models.Media
+	patch.TranscodeStatus.String, patch.TranscodeStatus.Valid = status, status != ""
+	patch.TranscodeProgress.Int64, patch.TranscodeProgress.Valid = progress, progress >= 0
+	return media.Patch(ctx, id, patch, []string{"TRANSCODE_STATUS", "TRANSCODE_PROGRESS"})
+}
+
+// truncate the text to the given number of bytes
+func truncate(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	return text[:size]
+}